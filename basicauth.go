@@ -0,0 +1,379 @@
+package vhttp
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// HeaderWWWAuthenticate is the header used by servers to send an
+// authentication challenge.
+const HeaderWWWAuthenticate = "WWW-Authenticate"
+
+// basicAuth gets the request's basic auth credentials, returning
+// a validation error if they're missing or malformed.
+func basicAuth(req *http.Request, validator string) (string, string, error) {
+	user, pass, ok := req.BasicAuth()
+	if !ok {
+		return "", "", validationErrorf(headerTarget(HeaderAuthorization), validator, CodeMissing, nil, nil,
+			"expected valid basic auth credentials in the %q header", HeaderAuthorization)
+	}
+	return user, pass, nil
+}
+
+// BasicAuthUsernameMatches creates a RequestFunc that checks that the
+// request has basic auth credentials and that the username matches the
+// regular expression re.
+func BasicAuthUsernameMatches(re *regexp.Regexp) RequestFunc {
+	return func(req *http.Request) error {
+		user, _, err := basicAuth(req, "BasicAuthUsernameMatches")
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(user) {
+			return validationErrorf(headerTarget(HeaderAuthorization), "BasicAuthUsernameMatches", CodeNoMatch, re.String(), user,
+				"expected basic auth username to match %q, found %q", re, user)
+		}
+		return nil
+	}
+}
+
+// BasicAuthCredentials creates a RequestFunc that checks that the
+// request's basic auth credentials match one of the username/password
+// pairs in creds.
+//
+// Passwords are compared in constant time.
+func BasicAuthCredentials(creds map[string]string) RequestFunc {
+	return func(req *http.Request) error {
+		user, pass, err := basicAuth(req, "BasicAuthCredentials")
+		if err != nil {
+			return err
+		}
+
+		// Always compare, even for unknown users, so the time taken
+		// doesn't reveal which usernames exist.
+		want, ok := creds[user]
+		if !constantTimeEqual(pass, want) || !ok {
+			return basicAuthInvalid("BasicAuthCredentials", user)
+		}
+		return nil
+	}
+}
+
+// BasicAuthHtpasswd creates a RequestFunc that checks that the request's
+// basic auth credentials are valid according to the htpasswd file h.
+func BasicAuthHtpasswd(h Htpasswd) RequestFunc {
+	return func(req *http.Request) error {
+		user, pass, err := basicAuth(req, "BasicAuthHtpasswd")
+		if err != nil {
+			return err
+		}
+		if !h.Verify(user, pass) {
+			return basicAuthInvalid("BasicAuthHtpasswd", user)
+		}
+		return nil
+	}
+}
+
+// basicAuthInvalid returns the error for invalid credentials. The
+// password is never included.
+func basicAuthInvalid(validator, user string) error {
+	return validationErrorf(headerTarget(HeaderAuthorization), validator, CodeMismatch, nil, user,
+		"invalid basic auth credentials for user %q", user)
+}
+
+// constantTimeEqual reports whether a and b are equal, taking time
+// independent of their contents and lengths.
+func constantTimeEqual(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// Htpasswd maps usernames to password hashes, as stored in an Apache
+// htpasswd file.
+//
+// The supported hash formats are plaintext, "{SHA}" (base64-encoded
+// SHA-1) and "$apr1$" (Apache's MD5-based crypt). Classic DES crypt hashes
+// (13 characters with no prefix) aren't supported, and are never treated
+// as plaintext.
+type Htpasswd map[string]string
+
+// ParseHtpasswd parses htpasswd data from r. Blank lines and lines
+// starting with "#" are ignored. Hashes in unsupported formats (eg
+// bcrypt or DES crypt) result in an error.
+func ParseHtpasswd(r io.Reader) (Htpasswd, error) {
+	h := Htpasswd{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("htpasswd line %d: expected \"user:hash\"", n)
+		}
+		if (strings.HasPrefix(hash, "$") && !strings.HasPrefix(hash, "$apr1$")) || isDESCrypt(hash) {
+			return nil, fmt.Errorf("htpasswd line %d: unsupported hash format for user %q", n, user)
+		}
+		h[user] = hash
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read htpasswd: %w", err)
+	}
+	return h, nil
+}
+
+// LoadHtpasswdFile loads and parses the htpasswd file at name (see
+// ParseHtpasswd).
+func LoadHtpasswdFile(name string) (Htpasswd, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open htpasswd: %w", err)
+	}
+	defer f.Close()
+	return ParseHtpasswd(f)
+}
+
+// Verify reports whether pass is the password for user. It always
+// returns false for hashes in unsupported formats.
+func (h Htpasswd) Verify(user, pass string) bool {
+	hash, ok := h[user]
+	if !ok {
+		return false
+	}
+	var got string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		got = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		got = apr1Crypt(pass, salt)
+	case strings.HasPrefix(hash, "$"), isDESCrypt(hash):
+		return false
+	default:
+		got = pass
+	}
+	return constantTimeEqual(got, hash)
+}
+
+// isDESCrypt reports whether hash looks like a classic DES crypt hash: 13
+// characters from the alphabet [./0-9A-Za-z].
+func isDESCrypt(hash string) bool {
+	if len(hash) != 13 {
+		return false
+	}
+	for _, c := range hash {
+		switch {
+		case c == '.', c == '/', '0' <= c && c <= '9', 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// apr1Crypt hashes password with salt using Apache's variant of the
+// MD5-based crypt algorithm, returning it in "$apr1$salt$hash" form.
+func apr1Crypt(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	d := md5.New()
+	d.Write([]byte(password + magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		d.Write(alt[:n])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	// Stretch it
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 == 1 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 == 1 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(nil)
+	}
+
+	// Encode it with crypt's base64 alphabet
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out strings.Builder
+	enc := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	enc(final[0], final[6], final[12], 4)
+	enc(final[1], final[7], final[13], 4)
+	enc(final[2], final[8], final[14], 4)
+	enc(final[3], final[9], final[15], 4)
+	enc(final[4], final[10], final[5], 4)
+	enc(0, 0, final[11], 2)
+	return magic + salt + "$" + out.String()
+}
+
+// AuthChallenge is an authentication challenge from a WWW-Authenticate
+// header (RFC 9110, section 11.6.1).
+type AuthChallenge struct {
+	Scheme  string            // Auth scheme (eg "Basic")
+	Token68 string            // Token68 credentials, if present
+	Params  map[string]string // Auth parameters, with lowercase names
+}
+
+// authParamRE matches an auth-param's name and value.
+var authParamRE = regexp.MustCompile(`^([!#$%&'*+.^_` + "`" + `|~0-9A-Za-z-]+)\s*=\s*("(?:[^"\\]|\\.)*"|[!#$%&'*+.^_` + "`" + `|~0-9A-Za-z-]+)$`)
+
+// authSchemeRE matches an auth-scheme token.
+var authSchemeRE = regexp.MustCompile(`^[!#$%&'*+.^_` + "`" + `|~0-9A-Za-z-]+$`)
+
+// token68RE matches token68 credentials.
+var token68RE = regexp.MustCompile(`^[A-Za-z0-9._~+/-]+=*$`)
+
+// ParseAuthChallenges parses the challenges in the WWW-Authenticate
+// header values vs.
+func ParseAuthChallenges(vs ...string) ([]AuthChallenge, error) {
+	var cs []AuthChallenge
+	for _, v := range vs {
+		for _, el := range splitHeaderList(v) {
+			el = strings.TrimSpace(el)
+			if el == "" {
+				continue
+			}
+
+			// Does this element start a new challenge?
+			scheme, rest, _ := strings.Cut(el, " ")
+			if authSchemeRE.MatchString(scheme) && !authParamRE.MatchString(el) {
+				cs = append(cs, AuthChallenge{Scheme: scheme, Params: map[string]string{}})
+				el = strings.TrimSpace(rest)
+				if el == "" {
+					continue
+				}
+				if token68RE.MatchString(el) && !authParamRE.MatchString(el) {
+					cs[len(cs)-1].Token68 = el
+					continue
+				}
+			}
+			if len(cs) == 0 {
+				return nil, fmt.Errorf("expected an auth scheme, found %q", el)
+			}
+
+			// Parse the parameter
+			m := authParamRE.FindStringSubmatch(el)
+			if m == nil {
+				return nil, fmt.Errorf("invalid auth parameter %q", el)
+			}
+			name, val := strings.ToLower(m[1]), m[2]
+			if strings.HasPrefix(val, `"`) {
+				val = unquoteAuthParam(val)
+			}
+			if _, dup := cs[len(cs)-1].Params[name]; dup {
+				return nil, fmt.Errorf("duplicate auth parameter %q", name)
+			}
+			cs[len(cs)-1].Params[name] = val
+		}
+	}
+	return cs, nil
+}
+
+// unquoteAuthParam removes the quotes and escapes from a quoted-string.
+func unquoteAuthParam(s string) string {
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// WWWAuthenticateBasic creates a ResponseFunc that checks that 401
+// (Unauthorized) responses carry a well-formed Basic challenge in the
+// WWW-Authenticate header, with a realm parameter. If realm isn't empty,
+// the challenge's realm must equal it. Other responses aren't checked.
+func WWWAuthenticateBasic(realm string) ResponseFunc {
+	return func(res *http.Response) error {
+		if res.StatusCode != http.StatusUnauthorized {
+			return nil
+		}
+		target := headerTarget(HeaderWWWAuthenticate)
+		vs := res.Header.Values(HeaderWWWAuthenticate)
+		if len(vs) == 0 {
+			return validationErrorf(target, "WWWAuthenticateBasic", CodeMissing, nil, nil,
+				"expected a 401 response to have a %q header", HeaderWWWAuthenticate)
+		}
+		cs, err := ParseAuthChallenges(vs...)
+		if err != nil {
+			return &ValidationError{
+				Target:    target,
+				Validator: "WWWAuthenticateBasic",
+				Code:      CodeInvalid,
+				Actual:    vs,
+				Message:   fmt.Sprintf("invalid %q header: %s", HeaderWWWAuthenticate, err),
+				Err:       err,
+			}
+		}
+		for _, c := range cs {
+			if !strings.EqualFold(c.Scheme, "Basic") {
+				continue
+			}
+			got, ok := c.Params["realm"]
+			if !ok || c.Token68 != "" {
+				return validationErrorf(target, "WWWAuthenticateBasic", CodeInvalid, nil, vs,
+					"expected the Basic challenge to have a realm parameter")
+			}
+			if cs, ok := c.Params["charset"]; ok && !strings.EqualFold(cs, "UTF-8") {
+				return validationErrorf(target, "WWWAuthenticateBasic", CodeInvalid, "UTF-8", cs,
+					"expected the Basic challenge's charset to be \"UTF-8\", found %q", cs)
+			}
+			if realm != "" && got != realm {
+				return validationErrorf(target, "WWWAuthenticateBasic", CodeMismatch, realm, got,
+					"expected the Basic challenge's realm to be %q, found %q", realm, got)
+			}
+			return nil
+		}
+		return validationErrorf(target, "WWWAuthenticateBasic", CodeMissing, "Basic", vs,
+			"expected a Basic challenge in the %q header", HeaderWWWAuthenticate)
+	}
+}
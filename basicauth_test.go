@@ -0,0 +1,179 @@
+package vhttp_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestBasicAuthCredentials(t *testing.T) {
+	v := vhttp.BasicAuthCredentials(map[string]string{"alice": "s3cret", "bob": ""})
+	cases := []struct {
+		name string          // Case name
+		user string          // Basic auth username
+		pass string          // Basic auth password
+		auth string          // Raw Authorization header (overrides user/pass)
+		code vhttp.ErrorCode // Expected error code (empty for success)
+	}{
+		{name: "success", user: "alice", pass: "s3cret"},
+		{name: "empty-password", user: "bob", pass: ""},
+		{name: "wrong-password", user: "alice", pass: "s3cret!", code: vhttp.CodeMismatch},
+		{name: "unknown-user", user: "carol", pass: "", code: vhttp.CodeMismatch},
+		{name: "missing", code: vhttp.CodeMissing},
+		{name: "bearer", auth: "Bearer abc", code: vhttp.CodeMissing},
+		{name: "bad-base64", auth: "Basic !!!", code: vhttp.CodeMissing},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+			switch {
+			case c.auth != "":
+				req.Header.Set("Authorization", c.auth)
+			case c.user != "":
+				req.SetBasicAuth(c.user, c.pass)
+			}
+			err := vhttp.ValidateRequest(req, v)
+			if c.code == "" {
+				checkErrCode(t, err, "")
+				return
+			}
+			if !checkErrCode(t, err, c.code) {
+				return
+			}
+			if c.pass != "" && strings.Contains(err.Error(), c.pass) {
+				t.Errorf("expected the error not to contain the password, found %v", err)
+			}
+		})
+	}
+}
+
+func TestBasicAuthUsernameMatches(t *testing.T) {
+	v := vhttp.BasicAuthUsernameMatches(regexp.MustCompile(`^svc-[a-z]+$`))
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	req.SetBasicAuth("svc-billing", "x")
+	if err := vhttp.ValidateRequest(req, v); err != nil {
+		t.Errorf("expected no error, found %v", err)
+	}
+	req.SetBasicAuth("admin", "x")
+	if err := vhttp.ValidateRequest(req, v); err == nil {
+		t.Error("expected an error for a non-matching username")
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	data := strings.Join([]string{
+		"# users",
+		"plain:hunter2",
+		"sha:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=",
+		"apr:$apr1$saltsalt$8ZVuJuE66YPuWXIA2kJ4D0",
+		"",
+		"long:$apr1$abc$ewhTHlwKOxol3qFi4jd3q0",
+	}, "\n")
+	name := filepath.Join(t.TempDir(), ".htpasswd")
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h, err := vhttp.LoadHtpasswdFile(name)
+	if err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+
+	cases := []struct {
+		user, pass string // Credentials
+		valid      bool   // Should they be valid
+	}{
+		{"plain", "hunter2", true},
+		{"plain", "hunter3", false},
+		{"sha", "secret", true},
+		{"sha", "Secret", false},
+		{"apr", "myPassword", true},
+		{"apr", "mypassword", false},
+		{"long", "a-much-longer-password-over-16-bytes", true},
+		{"long", "a-much-longer-password-over-16-bytes!", false},
+		{"nobody", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.user+":"+c.pass, func(t *testing.T) {
+			if got := h.Verify(c.user, c.pass); got != c.valid {
+				t.Errorf("expected Verify to be %t, found %t", c.valid, got)
+			}
+			req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+			req.SetBasicAuth(c.user, c.pass)
+			err := vhttp.ValidateRequest(req, vhttp.BasicAuthHtpasswd(h))
+			if (err == nil) != c.valid {
+				t.Errorf("expected valid to be %t, found error %v", c.valid, err)
+			}
+		})
+	}
+
+	for _, bad := range []string{"bcrypt:$2y$05$abcdefghijklmnopqrstuv", "sha512:$6$salt$hash", "des:rqXexS6ZhobKA", "no-colon", ":nouser"} {
+		if _, err := vhttp.ParseHtpasswd(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+
+	// A DES crypt hash is never accepted as a plaintext password
+	des := vhttp.Htpasswd{"c": "rqXexS6ZhobKA"}
+	if des.Verify("c", "rqXexS6ZhobKA") {
+		t.Error("expected a DES crypt hash not to verify as its own password")
+	}
+}
+
+func TestParseAuthChallenges(t *testing.T) {
+	cs, err := vhttp.ParseAuthChallenges(`Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"`, "Bearer abc123==")
+	if err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+	if len(cs) != 3 {
+		t.Fatalf("expected 3 challenges, found %+v", cs)
+	}
+	if cs[0].Scheme != "Newauth" || cs[0].Params["realm"] != "apps" || cs[0].Params["type"] != "1" || cs[0].Params["title"] != `Login to "apps"` {
+		t.Errorf("unexpected first challenge %+v", cs[0])
+	}
+	if cs[1].Scheme != "Basic" || cs[1].Params["realm"] != "simple" {
+		t.Errorf("unexpected second challenge %+v", cs[1])
+	}
+	if cs[2].Scheme != "Bearer" || cs[2].Token68 != "abc123==" {
+		t.Errorf("unexpected third challenge %+v", cs[2])
+	}
+	for _, bad := range []string{`realm="x"`, `Basic realm="x", realm="y"`, `Basic realm="unterminated`} {
+		if _, err := vhttp.ParseAuthChallenges(bad); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestWWWAuthenticateBasic(t *testing.T) {
+	cases := []struct {
+		name   string          // Case name
+		status int             // Response status
+		values []string        // WWW-Authenticate values
+		realm  string          // Expected realm
+		code   vhttp.ErrorCode // Expected error code (empty for success)
+	}{
+		{name: "success", status: 401, values: []string{`Basic realm="api", charset="UTF-8"`}, realm: "api"},
+		{name: "any-realm", status: 401, values: []string{`Bearer realm="x"`, `basic realm=internal`}},
+		{name: "not-401", status: 200},
+		{name: "missing-header", status: 401, code: vhttp.CodeMissing},
+		{name: "no-basic", status: 401, values: []string{`Bearer realm="api"`}, code: vhttp.CodeMissing},
+		{name: "no-realm", status: 401, values: []string{`Basic charset="UTF-8"`}, code: vhttp.CodeInvalid},
+		{name: "bad-charset", status: 401, values: []string{`Basic realm="api", charset="latin1"`}, code: vhttp.CodeInvalid},
+		{name: "malformed", status: 401, values: []string{`Basic realm="api`}, code: vhttp.CodeInvalid},
+		{name: "wrong-realm", status: 401, values: []string{`Basic realm="admin"`}, realm: "api", code: vhttp.CodeMismatch},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: c.status, Header: http.Header{}}
+			for _, v := range c.values {
+				res.Header.Add(vhttp.HeaderWWWAuthenticate, v)
+			}
+			err := vhttp.ValidateResponse(res, vhttp.WWWAuthenticateBasic(c.realm))
+			checkErrCode(t, err, c.code)
+		})
+	}
+}
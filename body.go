@@ -4,33 +4,71 @@ import (
 	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 
 	"github.com/hashicorp/go-multierror"
 )
 
+// CacheBodyReads controls whether a single read of the request or response
+// body is shared by every BodyValidator (and CachedBodyValidator) run in the
+// same call to ValidateRequest, ValidateRequestFF, ValidateResponse or
+// ValidateResponseFF.
+//
+// When it's false (the default), each body validator reads the body itself
+// and then replaces it with a re-readable copy.
+var CacheBodyReads = false
+
+// MaxBodyBytes is the maximum number of bytes that BodyValidators (and
+// CachedBodyValidators and the other validators that read the whole body)
+// will read from a request or response body. Zero or less (the default)
+// means there is no limit.
+//
+// A body that's larger than the limit isn't validated. Instead, the
+// validator returns a ValidationError with the code CodeTooLarge, wrapping
+// ErrBodyTooLarge, and the body is left so that it can still be read in
+// full. The limit also applies to a body's decoded size when it's decoded
+// according to its "Content-Encoding" header. To check bodies that are too
+// large to hold in memory, use a StreamValidator.
+var MaxBodyBytes int64 = 0
+
+// ErrBodyTooLarge is wrapped by the ValidationError returned when a body is
+// larger than MaxBodyBytes.
+//
+//	if errors.Is(err, vhttp.ErrBodyTooLarge) {
+//		// ...
+//	}
+var ErrBodyTooLarge = errors.New("body exceeds MaxBodyBytes")
+
 // BodyValidator is a validator that validates an http.Request's body.
 //
 // Note that this expects the body to be fully read as a byte slice.
+// After the body has been read, it is replaced with a new reader over the
+// same bytes (and the request's GetBody function is set) so that validators
+// or handlers running afterwards can read it again.
+//
 // If more than one BodyValidator is being used, you should use a
 // CachedBodyValidator instead – which will read the body once and
-// pass the resulting byte slice to all of the BodyValidators.
+// pass the resulting byte slice to all of the BodyValidators – or
+// set CacheBodyReads to true.
+//
+// BodyValidators see the body as it was sent. To validate a body compressed
+// with a "Content-Encoding", wrap them with DecodeBody.
 type BodyValidator func(b []byte) error
 
 func (v BodyValidator) ValidateRequest(req *http.Request) error {
-	b, err := io.ReadAll(req.Body)
+	b, err := readRequestBody(req)
 	if err != nil {
-		return InternalErr(fmt.Errorf("failed to read request body: %s", err))
+		return bodyReadErr("failed to read request body", err)
 	}
 	return v(b)
 }
 
 func (v BodyValidator) ValidateResponse(res *http.Response) error {
-	b, err := io.ReadAll(res.Body)
+	b, err := readResponseBody(res)
 	if err != nil {
-		return InternalErr(fmt.Errorf("failed to read response body: %s", err))
+		return bodyReadErr("failed to read response body", err)
 	}
 	return v(b)
 }
@@ -41,7 +79,8 @@ func (v BodyValidator) ValidateResponse(res *http.Response) error {
 // methods each time).
 //
 // This helps avoid duplicated reads of the body and prevents issues with
-// attempts to read the body after it has been closed.
+// attempts to read the body after it has been closed. As with BodyValidator,
+// the body is replaced with a re-readable copy after it has been read.
 type CachedBodyValidator struct {
 	vs []BodyValidator
 }
@@ -52,9 +91,9 @@ func CacheBody(vs ...BodyValidator) CachedBodyValidator {
 }
 
 func (v CachedBodyValidator) ValidateRequest(req *http.Request) error {
-	b, err := io.ReadAll(req.Body)
+	b, err := readRequestBody(req)
 	if err != nil {
-		return InternalErr(fmt.Errorf("failed to read request body: %s", err))
+		return bodyReadErr("failed to read request body", err)
 	}
 
 	var merr *multierror.Error
@@ -67,9 +106,9 @@ func (v CachedBodyValidator) ValidateRequest(req *http.Request) error {
 }
 
 func (v CachedBodyValidator) ValidateResponse(res *http.Response) error {
-	b, err := io.ReadAll(res.Body)
+	b, err := readResponseBody(res)
 	if err != nil {
-		return InternalErr(fmt.Errorf("failed to read response body: %s", err))
+		return bodyReadErr("failed to read response body", err)
 	}
 
 	var merr *multierror.Error
@@ -85,7 +124,8 @@ func (v CachedBodyValidator) ValidateResponse(res *http.Response) error {
 func BodyIs(b []byte) BodyValidator {
 	return func(b2 []byte) error {
 		if !bytes.Equal(b, b2) {
-			return fmt.Errorf("body is not equal")
+			return validationErrorf("body", "BodyIs", CodeMismatch, b, b2,
+				"body is not equal")
 		}
 		return nil
 	}
@@ -95,7 +135,8 @@ func BodyIs(b []byte) BodyValidator {
 func BodyIsString(s string) BodyValidator {
 	return func(b []byte) error {
 		if string(b) != s {
-			return fmt.Errorf("body is not equal")
+			return validationErrorf("body", "BodyIsString", CodeMismatch, s, string(b),
+				"body is not equal")
 		}
 		return nil
 	}
@@ -106,7 +147,8 @@ func BodyIsString(s string) BodyValidator {
 func BodyIsValidJSON() BodyValidator {
 	return func(b []byte) error {
 		if !json.Valid(b) {
-			return fmt.Errorf("body is not valid JSON")
+			return validationErrorf("body", "BodyIsValidJSON", CodeInvalid, nil, nil,
+				"body is not valid JSON")
 		}
 		return nil
 	}
@@ -116,7 +158,8 @@ func BodyIsValidJSON() BodyValidator {
 func BodyLengthIs(n int) BodyValidator {
 	return func(b []byte) error {
 		if m := len(b); m != n {
-			return fmt.Errorf("expected body length to be %d, got %d", n, m)
+			return validationErrorf("body.length", "BodyLengthIs", CodeMismatch, n, m,
+				"expected body length to be %d, got %d", n, m)
 		}
 		return nil
 	}
@@ -126,7 +169,8 @@ func BodyLengthIs(n int) BodyValidator {
 func BodyIsNil() BodyValidator {
 	return func(b []byte) error {
 		if b != nil {
-			return fmt.Errorf("body is not nil")
+			return validationErrorf("body", "BodyIsNil", CodeUnexpected, nil, b,
+				"body is not nil")
 		}
 		return nil
 	}
@@ -137,7 +181,8 @@ func BodyIsNil() BodyValidator {
 func BodyDetectedTypeIs(t string) BodyValidator {
 	return func(b []byte) error {
 		if res := http.DetectContentType(b); res != t {
-			return fmt.Errorf("body detected type is not %s", t)
+			return validationErrorf("body", "BodyDetectedTypeIs", CodeMismatch, t, res,
+				"body detected type is not %s", t)
 		}
 		return nil
 	}
@@ -148,7 +193,13 @@ func BodyDetectedTypeIs(t string) BodyValidator {
 func BodyJSONUnmarshalsAs(v any) BodyValidator {
 	return func(b []byte) error {
 		if err := json.Unmarshal(b, v); err != nil {
-			return fmt.Errorf("body JSON unmarshal failed: %s", err)
+			return &ValidationError{
+				Target:    "body",
+				Validator: "BodyJSONUnmarshalsAs",
+				Code:      CodeInvalid,
+				Message:   fmt.Sprintf("body JSON unmarshal failed: %s", err),
+				Err:       err,
+			}
 		}
 		return nil
 	}
@@ -159,7 +210,13 @@ func BodyJSONUnmarshalsAs(v any) BodyValidator {
 func BodyXMLUnmarshalsAs(v any) BodyValidator {
 	return func(b []byte) error {
 		if err := xml.Unmarshal(b, v); err != nil {
-			return fmt.Errorf("body JSON unmarshal failed: %s", err)
+			return &ValidationError{
+				Target:    "body",
+				Validator: "BodyXMLUnmarshalsAs",
+				Code:      CodeInvalid,
+				Message:   fmt.Sprintf("body XML unmarshal failed: %s", err),
+				Err:       err,
+			}
 		}
 		return nil
 	}
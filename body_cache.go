@@ -0,0 +1,227 @@
+package vhttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// sharedBody is an io.ReadCloser that wraps a request or response body so
+// that it's only read once. It's swapped in for the body for the duration of
+// a ValidateRequest or ValidateResponse call when CacheBodyReads is true.
+type sharedBody struct {
+	src    io.ReadCloser
+	b      []byte
+	err    error
+	loaded bool
+	r      io.ReadCloser
+}
+
+// load reads the full underlying body (if it hasn't been read already)
+// and returns the cached bytes.
+func (sb *sharedBody) load() ([]byte, error) {
+	if !sb.loaded {
+		sb.loaded = true
+		sb.b, sb.r, sb.err = readLimited(sb.src)
+	}
+	return sb.b, sb.err
+}
+
+func (sb *sharedBody) Read(p []byte) (int, error) {
+	if _, err := sb.load(); err != nil && !isBodyTooLarge(err) {
+		return 0, err
+	}
+	return sb.r.Read(p)
+}
+
+func (sb *sharedBody) Close() error {
+	return nil
+}
+
+// errBodyTooLarge returns the error for a body that's larger than
+// MaxBodyBytes.
+func errBodyTooLarge() error {
+	return &ValidationError{
+		Target:    "body",
+		Validator: "MaxBodyBytes",
+		Code:      CodeTooLarge,
+		Expected:  MaxBodyBytes,
+		Message:   fmt.Sprintf("expected body to be at most %d bytes", MaxBodyBytes),
+		Err:       ErrBodyTooLarge,
+	}
+}
+
+// isBodyTooLarge reports whether err is the error returned when a body is
+// larger than MaxBodyBytes.
+func isBodyTooLarge(err error) bool {
+	return errors.Is(err, ErrBodyTooLarge)
+}
+
+// bodyReadErr returns the error a validator should return when reading a
+// body failed with err: the ValidationError itself if the body was larger
+// than MaxBodyBytes, or an InternalError described by msg otherwise.
+func bodyReadErr(msg string, err error) error {
+	if isBodyTooLarge(err) {
+		return err
+	}
+	return InternalErr(fmt.Errorf("%s: %w", msg, err))
+}
+
+// readLimited reads body, up to MaxBodyBytes (if set), and returns the
+// bytes along with a replacement body.
+//
+// If the whole body was read, body is closed and the replacement reads the
+// same bytes again. If the body is larger than MaxBodyBytes, the error from
+// errBodyTooLarge is returned and the replacement reads the bytes that were
+// read followed by the rest of body, so nothing is lost.
+func readLimited(body io.ReadCloser) ([]byte, io.ReadCloser, error) {
+	if MaxBodyBytes <= 0 {
+		b, err := io.ReadAll(body)
+		body.Close()
+		return b, io.NopCloser(bytes.NewReader(b)), err
+	}
+
+	b, err := io.ReadAll(io.LimitReader(body, MaxBodyBytes+1))
+	if err == nil && int64(len(b)) > MaxBodyBytes {
+		return nil, &partialBody{io.MultiReader(bytes.NewReader(b), body), body}, errBodyTooLarge()
+	}
+	body.Close()
+	return b, io.NopCloser(bytes.NewReader(b)), err
+}
+
+// partialBody is a body that has been partly read: it reads the bytes
+// that were already read followed by the rest of the original body, which
+// it closes.
+type partialBody struct {
+	io.Reader
+	io.Closer
+}
+
+// readBody reads the full body and returns the bytes along with a
+// replacement body that can be read again.
+//
+// A nil body (or http.NoBody) returns a nil byte slice. A body larger than
+// MaxBodyBytes returns the error from errBodyTooLarge (see readLimited).
+func readBody(body io.ReadCloser) ([]byte, io.ReadCloser, error) {
+	// Is there anything to read?
+	if body == nil || body == http.NoBody {
+		return nil, body, nil
+	}
+
+	// Is the body already being shared?
+	if sb, ok := body.(*sharedBody); ok {
+		b, err := sb.load()
+		return b, sb, err
+	}
+
+	// Read the body and replace it with a copy
+	return readLimited(body)
+}
+
+// getBodyFunc returns a function that can be used as an http.Request's
+// GetBody field, returning new readers over b.
+func getBodyFunc(b []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+}
+
+// readRequestBody reads the request's body and replaces it (and the
+// request's GetBody function) so that it can be read again.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	b, body, err := readBody(req.Body)
+	req.Body = body
+	if err == nil && body != nil && body != http.NoBody {
+		req.GetBody = getBodyFunc(b)
+	}
+	return b, err
+}
+
+// readResponseBody reads the response's body and replaces it so
+// that it can be read again.
+func readResponseBody(res *http.Response) ([]byte, error) {
+	b, body, err := readBody(res.Body)
+	res.Body = body
+	return b, err
+}
+
+// shareRequestBody wraps the request's body in a sharedBody (if
+// CacheBodyReads is set) and returns a function that restores it
+// once validation is complete.
+func shareRequestBody(req *http.Request) func() {
+	if !CacheBodyReads || req.Body == nil || req.Body == http.NoBody {
+		return func() {}
+	}
+	if _, ok := req.Body.(*sharedBody); ok {
+		return func() {} // Already shared
+	}
+	sb := &sharedBody{src: req.Body}
+	req.Body = sb
+	return func() {
+		// Was the body replaced by a validator?
+		if req.Body != sb {
+			return
+		}
+
+		// Was the body ever read?
+		if !sb.loaded {
+			req.Body = sb.src
+			return
+		}
+
+		// Was it consumed by a StreamValidator?
+		if errors.Is(sb.err, errBodyStreamed) {
+			req.Body = http.NoBody
+			return
+		}
+
+		// Was it too large to read fully?
+		if isBodyTooLarge(sb.err) {
+			req.Body = sb.r
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(sb.b))
+		req.GetBody = getBodyFunc(sb.b)
+	}
+}
+
+// shareResponseBody wraps the response's body in a sharedBody (if
+// CacheBodyReads is set) and returns a function that restores it
+// once validation is complete.
+func shareResponseBody(res *http.Response) func() {
+	if !CacheBodyReads || res.Body == nil || res.Body == http.NoBody {
+		return func() {}
+	}
+	if _, ok := res.Body.(*sharedBody); ok {
+		return func() {} // Already shared
+	}
+	sb := &sharedBody{src: res.Body}
+	res.Body = sb
+	return func() {
+		// Was the body replaced by a validator?
+		if res.Body != sb {
+			return
+		}
+
+		// Was the body ever read?
+		if !sb.loaded {
+			res.Body = sb.src
+			return
+		}
+
+		// Was it consumed by a StreamValidator?
+		if errors.Is(sb.err, errBodyStreamed) {
+			res.Body = http.NoBody
+			return
+		}
+
+		// Was it too large to read fully?
+		if isBodyTooLarge(sb.err) {
+			res.Body = sb.r
+			return
+		}
+		res.Body = io.NopCloser(bytes.NewReader(sb.b))
+	}
+}
@@ -1,6 +1,15 @@
 package vhttp_test
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
 
 func TestBodyIs(t *testing.T) {
 	t.Errorf("not implemented")
@@ -33,3 +42,184 @@ func TestBodyJSONUnmarshalsAs(t *testing.T) {
 func TestBodyXMLUnmarshalsAs(t *testing.T) {
 	t.Errorf("not implemented")
 }
+
+func TestBodyValidatorRestoresBody(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		body := []byte(`{"hello":"world"}`)
+		req := &http.Request{Body: io.NopCloser(bytes.NewReader(body))}
+
+		err := vhttp.ValidateRequest(req,
+			vhttp.BodyIsValidJSON(),
+			vhttp.BodyIs(body),
+			vhttp.CacheBody(vhttp.BodyLengthIs(len(body))),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		// The body should still be readable
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Fatalf("unexpected error reading body: %s", err)
+		}
+		if !bytes.Equal(b, body) {
+			t.Errorf("expected body %q, got %q", body, b)
+		}
+
+		// ...and so should GetBody
+		if req.GetBody == nil {
+			t.Fatal("expected GetBody to be set")
+		}
+		rc, _ := req.GetBody()
+		b, _ = io.ReadAll(rc)
+		if !bytes.Equal(b, body) {
+			t.Errorf("expected GetBody to return %q, got %q", body, b)
+		}
+	})
+	t.Run("response", func(t *testing.T) {
+		body := []byte(`hello`)
+		res := &http.Response{Body: io.NopCloser(bytes.NewReader(body))}
+
+		err := vhttp.ValidateResponse(res,
+			vhttp.BodyIsString("hello"),
+			vhttp.BodyIsString("hello"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		b, _ := io.ReadAll(res.Body)
+		if !bytes.Equal(b, body) {
+			t.Errorf("expected body %q, got %q", body, b)
+		}
+	})
+	t.Run("nil-body", func(t *testing.T) {
+		req := &http.Request{}
+		if err := vhttp.ValidateRequest(req, vhttp.BodyIsNil()); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if req.Body != nil {
+			t.Errorf("expected body to remain nil")
+		}
+	})
+}
+
+func TestCacheBodyReads(t *testing.T) {
+	body := []byte("hello, world")
+
+	// drain reads the body without restoring it
+	drain := vhttp.RequestFunc(func(req *http.Request) error {
+		_, err := io.ReadAll(req.Body)
+		return err
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		req := &http.Request{Body: io.NopCloser(bytes.NewReader(body))}
+		err := vhttp.ValidateRequest(req, drain, vhttp.BodyIs(body))
+		if err == nil {
+			t.Errorf("expected an error since the body was drained")
+		}
+	})
+	t.Run("enabled", func(t *testing.T) {
+		vhttp.CacheBodyReads = true
+		defer func() { vhttp.CacheBodyReads = false }()
+
+		req := &http.Request{Body: io.NopCloser(bytes.NewReader(body))}
+		err := vhttp.ValidateRequest(req,
+			drain,
+			vhttp.BodyIs(body),
+			vhttp.CacheBody(vhttp.BodyLengthIs(len(body))),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		// The body should still be readable afterwards
+		b, _ := io.ReadAll(req.Body)
+		if !bytes.Equal(b, body) {
+			t.Errorf("expected body %q, got %q", body, b)
+		}
+	})
+	t.Run("enabled-response", func(t *testing.T) {
+		vhttp.CacheBodyReads = true
+		defer func() { vhttp.CacheBodyReads = false }()
+
+		res := &http.Response{Body: io.NopCloser(bytes.NewReader(body))}
+		err := vhttp.ValidateResponse(res,
+			vhttp.BodyIs(body),
+			vhttp.BodyLengthIs(len(body)),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		b, _ := io.ReadAll(res.Body)
+		if !bytes.Equal(b, body) {
+			t.Errorf("expected body %q, got %q", body, b)
+		}
+	})
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	vhttp.MaxBodyBytes = 5
+	defer func() { vhttp.MaxBodyBytes = 0 }()
+
+	cases := []struct {
+		name  string // Case name
+		body  string // Request body
+		cache bool   // Should CacheBodyReads be set
+		isErr bool   // Should the too-large error be returned
+	}{
+		{name: "under", body: "hey"},
+		{name: "at-limit", body: "hello"},
+		{name: "over", body: "hello, world", isErr: true},
+		{name: "cached-under", body: "hey", cache: true},
+		{name: "cached-over", body: "hello, world", cache: true, isErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			vhttp.CacheBodyReads = c.cache
+			defer func() { vhttp.CacheBodyReads = false }()
+
+			req := newBodyRequest(c.body)
+			err := vhttp.ValidateRequest(req,
+				vhttp.BodyIsString(c.body),
+				vhttp.CacheBody(vhttp.BodyLengthIs(len(c.body))),
+			)
+			if !c.isErr {
+				if err != nil {
+					t.Errorf("expected no error, found %v", err)
+				}
+			} else {
+				if !errors.Is(err, vhttp.ErrBodyTooLarge) {
+					t.Errorf("expected a too-large error, found %v", err)
+				}
+				for _, verr := range vhttp.ValidationErrors(err) {
+					if verr.Code != vhttp.CodeTooLarge {
+						t.Errorf("expected code %q, found %q", vhttp.CodeTooLarge, verr.Code)
+					}
+				}
+			}
+
+			// The whole body can still be read
+			if b, _ := io.ReadAll(req.Body); string(b) != c.body {
+				t.Errorf("expected body %q, got %q", c.body, b)
+			}
+		})
+	}
+
+	// Responses are limited too
+	res := &http.Response{Body: io.NopCloser(strings.NewReader("hello, world"))}
+	if err := vhttp.ValidateResponse(res, vhttp.BodyIsValidJSON()); !errors.Is(err, vhttp.ErrBodyTooLarge) {
+		t.Errorf("expected a too-large error, found %v", err)
+	}
+}
+
+// newBodyRequest creates a GET request with the given body.
+func newBodyRequest(body string) *http.Request {
+	return &http.Request{
+		Method: http.MethodGet,
+		Header: http.Header{},
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+}
@@ -0,0 +1,368 @@
+package vhttp
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderCacheControl is the name of the "Cache-Control" header.
+const HeaderCacheControl = "Cache-Control"
+
+// CacheControl is a set of parsed "Cache-Control" directives, mapping each
+// directive's name (in lower case) to its value. Directives without a
+// value map to an empty string.
+type CacheControl map[string]string
+
+// ParseCacheControl parses the "Cache-Control" header values vs. If a
+// directive appears more than once, the first value is used.
+func ParseCacheControl(vs ...string) CacheControl {
+	cc := CacheControl{}
+	for _, v := range vs {
+		for _, d := range splitHeaderList(v) {
+			k, val, _ := strings.Cut(d, "=")
+			k = strings.ToLower(strings.TrimSpace(k))
+			if k == "" {
+				continue
+			}
+			if _, ok := cc[k]; ok {
+				continue
+			}
+			val = strings.TrimSpace(val)
+			if uq, err := strconv.Unquote(val); err == nil && strings.HasPrefix(val, `"`) {
+				val = uq
+			}
+			cc[k] = val
+		}
+	}
+	return cc
+}
+
+// Has reports if the directive d is present.
+func (cc CacheControl) Has(d string) bool {
+	_, ok := cc[strings.ToLower(d)]
+	return ok
+}
+
+// Seconds returns the value of the delta-seconds directive d (eg
+// "max-age") as a duration. If the directive's value is invalid, it's
+// treated as 0 (as per RFC 9111). The second return value reports if
+// the directive is present.
+func (cc CacheControl) Seconds(d string) (time.Duration, bool) {
+	v, ok := cc[strings.ToLower(d)]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, true
+	}
+	if n > maxDeltaSeconds {
+		n = maxDeltaSeconds
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// maxDeltaSeconds is the largest delta-seconds value that a cache needs
+// to support (RFC 9111, section 1.2.2).
+const maxDeltaSeconds = 1 << 31
+
+// String returns the directives, formatted as a "Cache-Control"
+// header value.
+func (cc CacheControl) String() string {
+	ds := make([]string, 0, len(cc))
+	for _, k := range jsSortedKeys(cc) {
+		switch v := cc[k]; {
+		case v == "":
+			ds = append(ds, k)
+		case strings.ContainsAny(v, " ,\"=;"):
+			ds = append(ds, k+"="+strconv.Quote(v))
+		default:
+			ds = append(ds, k+"="+v)
+		}
+	}
+	return strings.Join(ds, ", ")
+}
+
+// CacheControlHas creates a HeaderValidator that checks that the
+// "Cache-Control" header has the directive d.
+//
+//	v := vhttp.CacheControlHas("no-store")
+func CacheControlHas(d string) HeaderValidator {
+	return func(hs http.Header) error {
+		if !ParseCacheControl(hs.Values(HeaderCacheControl)...).Has(d) {
+			return validationErrorf(headerTarget(HeaderCacheControl), "CacheControlHas", CodeMissing, d, hs.Values(HeaderCacheControl),
+				"expected Cache-Control directive %q to be present", d)
+		}
+		return nil
+	}
+}
+
+// CacheControlHasNot creates a HeaderValidator that checks that the
+// "Cache-Control" header doesn't have the directive d.
+func CacheControlHasNot(d string) HeaderValidator {
+	return func(hs http.Header) error {
+		if ParseCacheControl(hs.Values(HeaderCacheControl)...).Has(d) {
+			return validationErrorf(headerTarget(HeaderCacheControl), "CacheControlHasNot", CodeUnexpected, d, hs.Values(HeaderCacheControl),
+				"expected Cache-Control directive %q not to be present", d)
+		}
+		return nil
+	}
+}
+
+// CacheControlMaxAgeAtLeast creates a HeaderValidator that checks that the
+// "Cache-Control" header has a "max-age" directive of at least d.
+func CacheControlMaxAgeAtLeast(d time.Duration) HeaderValidator {
+	return func(hs http.Header) error {
+		ma, ok := ParseCacheControl(hs.Values(HeaderCacheControl)...).Seconds("max-age")
+		if !ok {
+			return validationErrorf(headerTarget(HeaderCacheControl), "CacheControlMaxAgeAtLeast", CodeMissing, d, nil,
+				"expected Cache-Control directive %q to be present", "max-age")
+		}
+		if ma < d {
+			return validationErrorf(headerTarget(HeaderCacheControl), "CacheControlMaxAgeAtLeast", CodeOutOfRange, d, ma,
+				"expected Cache-Control max-age to be at least %s, found %s", d, ma)
+		}
+		return nil
+	}
+}
+
+// CacheControlIsPublic creates a HeaderValidator that checks that the
+// "Cache-Control" header has the "public" directive and doesn't have the
+// "private" or "no-store" directives.
+func CacheControlIsPublic() HeaderValidator {
+	return func(hs http.Header) error {
+		cc := ParseCacheControl(hs.Values(HeaderCacheControl)...)
+		for _, d := range []string{"private", "no-store"} {
+			if cc.Has(d) {
+				return validationErrorf(headerTarget(HeaderCacheControl), "CacheControlIsPublic", CodeUnexpected, "public", cc.String(),
+					"expected Cache-Control to be public, found directive %q", d)
+			}
+		}
+		if !cc.Has("public") {
+			return validationErrorf(headerTarget(HeaderCacheControl), "CacheControlIsPublic", CodeMissing, "public", cc.String(),
+				"expected Cache-Control directive %q to be present", "public")
+		}
+		return nil
+	}
+}
+
+// heuristicStatusCodes are the status codes that are heuristically
+// cacheable by default (RFC 9110, section 15.1).
+var heuristicStatusCodes = map[int]bool{
+	200: true, 203: true, 204: true, 206: true,
+	300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true,
+	501: true,
+}
+
+// CacheAnalyzer determines whether and for how long a cache could store a
+// response, following the rules of RFC 9111.
+type CacheAnalyzer struct {
+	// Shared analyzes the response for a shared cache (eg a CDN or proxy)
+	// rather than a private cache (eg a browser).
+	Shared bool
+
+	// HeuristicFraction is the fraction of the time since the response's
+	// Last-Modified date used as its heuristic freshness lifetime.
+	// Defaults to 0.1.
+	HeuristicFraction float64
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// CacheAnalysis is the result of analyzing a response with a
+// CacheAnalyzer.
+type CacheAnalysis struct {
+	// Storable reports if the cache can store the response.
+	Storable bool
+
+	// Reason explains why the response can't be stored.
+	Reason string
+
+	// Freshness is the response's freshness lifetime: how long after it
+	// was generated it can be reused without validation.
+	Freshness time.Duration
+
+	// Heuristic reports if Freshness was calculated heuristically,
+	// since the response doesn't have an explicit expiration time.
+	Heuristic bool
+
+	// Age is the response's current age.
+	Age time.Duration
+
+	// NoCache reports if the response must be validated with the origin
+	// server before each reuse (the "no-cache" directive).
+	NoCache bool
+
+	// MustRevalidate reports if the response must be validated with the
+	// origin server once it's stale.
+	MustRevalidate bool
+
+	// Vary are the request headers used as part of the cache key.
+	Vary []string
+}
+
+// TTL returns how much longer the response can be reused without
+// validation (its freshness lifetime minus its current age).
+func (a CacheAnalysis) TTL() time.Duration {
+	if !a.Storable || a.NoCache || a.Age >= a.Freshness {
+		return 0
+	}
+	return a.Freshness - a.Age
+}
+
+// Analyze determines whether and for how long the response res could be
+// stored by the cache. The request is taken from res.Request. If it's nil,
+// a GET request without an Authorization header is assumed.
+func (a CacheAnalyzer) Analyze(res *http.Response) CacheAnalysis {
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	method := http.MethodGet
+	var reqHeader http.Header
+	if res.Request != nil {
+		method, reqHeader = res.Request.Method, res.Request.Header
+		if method == "" {
+			method = http.MethodGet
+		}
+	}
+	reqCC := ParseCacheControl(reqHeader.Values(HeaderCacheControl)...)
+	cc := ParseCacheControl(res.Header.Values(HeaderCacheControl)...)
+
+	out := CacheAnalysis{Vary: varyHeaders(res.Header)}
+	notStorable := func(format string, args ...any) CacheAnalysis {
+		out.Reason = fmt.Sprintf(format, args...)
+		return out
+	}
+
+	// Can the response be stored? (RFC 9111, section 3)
+	switch {
+	case method != http.MethodGet && method != http.MethodHead:
+		return notStorable("request method %s is not cacheable", method)
+	case res.StatusCode < 200:
+		return notStorable("status code %d is not final", res.StatusCode)
+	case res.StatusCode == http.StatusPartialContent || res.StatusCode == http.StatusNotModified:
+		return notStorable("status code %d is not cacheable as a complete response", res.StatusCode)
+	case reqCC.Has("no-store"):
+		return notStorable("request has the Cache-Control directive \"no-store\"")
+	case cc.Has("no-store"):
+		return notStorable("response has the Cache-Control directive \"no-store\"")
+	case a.Shared && cc.Has("private"):
+		return notStorable("response has the Cache-Control directive \"private\"")
+	case a.Shared && reqHeader.Get(HeaderAuthorization) != "" && !cc.Has("public") && !cc.Has("must-revalidate") && !cc.Has("s-maxage"):
+		return notStorable("request has an Authorization header and the response doesn't allow shared caching")
+	}
+	for _, v := range out.Vary {
+		if v == "*" {
+			return notStorable("response has the header \"Vary: *\"")
+		}
+	}
+
+	// Find the response's date
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		date = now()
+	}
+
+	// Calculate the freshness lifetime (RFC 9111, section 4.2.1)
+	explicit := true
+	if d, ok := cc.Seconds("s-maxage"); ok && a.Shared {
+		out.Freshness = d
+	} else if d, ok := cc.Seconds("max-age"); ok {
+		out.Freshness = d
+	} else if exp := res.Header.Get("Expires"); exp != "" {
+		if t, err := http.ParseTime(exp); err == nil && t.After(date) {
+			out.Freshness = t.Sub(date)
+		}
+	} else {
+		explicit = false
+	}
+
+	// Is the response cacheable without an explicit expiration time?
+	if !explicit {
+		if !cc.Has("public") && !(cc.Has("private") && !a.Shared) && !heuristicStatusCodes[res.StatusCode] {
+			return notStorable("response has no explicit expiration time and status code %d is not heuristically cacheable", res.StatusCode)
+		}
+		if lm, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil && lm.Before(date) {
+			frac := a.HeuristicFraction
+			if frac == 0 {
+				frac = 0.1
+			}
+			out.Freshness = time.Duration(float64(date.Sub(lm)) * frac).Truncate(time.Second)
+			out.Heuristic = true
+		}
+	}
+
+	// Calculate the current age (RFC 9111, section 4.2.3)
+	if d := now().Sub(date); d > 0 {
+		out.Age = d
+	}
+	if n, err := strconv.ParseInt(strings.TrimSpace(res.Header.Get("Age")), 10, 64); err == nil && n > 0 {
+		if d := time.Duration(n) * time.Second; d > out.Age {
+			out.Age = d
+		}
+	}
+
+	out.Storable = true
+	out.NoCache = cc.Has("no-cache")
+	out.MustRevalidate = cc.Has("must-revalidate") || (a.Shared && cc.Has("proxy-revalidate"))
+	return out
+}
+
+// varyHeaders returns the canonical names of the headers listed in the
+// "Vary" header, sorted.
+func varyHeaders(hs http.Header) []string {
+	var out []string
+	for _, v := range hs.Values("Vary") {
+		for _, h := range splitHeaderList(v) {
+			if h != "*" {
+				h = CanonicalHeaderKey(h)
+			}
+			out = append(out, h)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ResponseCacheable creates a ResponseFunc that checks, using the
+// CacheAnalyzer a, that the response can be stored by a cache and reused
+// without validation for at least min.
+//
+//	v := vhttp.ResponseCacheable(vhttp.CacheAnalyzer{Shared: true}, 5*time.Minute)
+func ResponseCacheable(a CacheAnalyzer, min time.Duration) ResponseFunc {
+	return func(res *http.Response) error {
+		an := a.Analyze(res)
+		if !an.Storable {
+			return validationErrorf("cache", "ResponseCacheable", CodeUnexpected, min, nil,
+				"expected response to be cacheable: %s", an.Reason)
+		}
+		if an.NoCache && min > 0 {
+			return validationErrorf("cache", "ResponseCacheable", CodeOutOfRange, min, time.Duration(0),
+				"expected response to be reusable for at least %s, but it must be revalidated before each reuse", min)
+		}
+		if ttl := an.TTL(); ttl < min {
+			return validationErrorf("cache", "ResponseCacheable", CodeOutOfRange, min, ttl,
+				"expected response to be reusable for at least %s, found %s", min, ttl)
+		}
+		return nil
+	}
+}
+
+// ResponseNotCacheable creates a ResponseFunc that checks, using the
+// CacheAnalyzer a, that the response can't be stored by a cache.
+func ResponseNotCacheable(a CacheAnalyzer) ResponseFunc {
+	return func(res *http.Response) error {
+		if an := a.Analyze(res); an.Storable {
+			return validationErrorf("cache", "ResponseNotCacheable", CodeUnexpected, nil, an.Freshness,
+				"expected response not to be cacheable, found freshness lifetime %s", an.Freshness)
+		}
+		return nil
+	}
+}
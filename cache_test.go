@@ -0,0 +1,234 @@
+package vhttp_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	cc := vhttp.ParseCacheControl(`public, max-age=3600`, `Private="Set-Cookie, X-Token", max-age=60, s-maxage=bad`)
+	if !cc.Has("public") || !cc.Has("PRIVATE") || cc.Has("no-store") {
+		t.Errorf("unexpected directives: %v", cc)
+	}
+	if cc["private"] != "Set-Cookie, X-Token" {
+		t.Errorf("expected quoted value to be unquoted, found %q", cc["private"])
+	}
+	if d, ok := cc.Seconds("max-age"); !ok || d != time.Hour {
+		t.Errorf("expected max-age of 1h, found %s (%t)", d, ok)
+	}
+	if d, ok := cc.Seconds("s-maxage"); !ok || d != 0 {
+		t.Errorf("expected invalid s-maxage to be 0, found %s (%t)", d, ok)
+	}
+	if _, ok := cc.Seconds("min-fresh"); ok {
+		t.Error("expected min-fresh to be missing")
+	}
+	if s := cc.String(); s != `max-age=3600, private="Set-Cookie, X-Token", public, s-maxage=bad` {
+		t.Errorf("unexpected string %q", s)
+	}
+}
+
+func TestCacheControlValidators(t *testing.T) {
+	cases := []struct {
+		name  string                // Case name
+		cc    string                // Cache-Control header
+		v     vhttp.HeaderValidator // Validator to run
+		isErr bool                  // Should an error be returned
+	}{
+		{"has-success", "no-cache, no-store", vhttp.CacheControlHas("no-store"), false},
+		{"has-missing", "no-cache", vhttp.CacheControlHas("no-store"), true},
+		{"has-not-success", "public", vhttp.CacheControlHasNot("no-store"), false},
+		{"has-not-present", "no-store", vhttp.CacheControlHasNot("no-store"), true},
+		{"max-age-success", "max-age=600", vhttp.CacheControlMaxAgeAtLeast(5 * time.Minute), false},
+		{"max-age-too-short", "max-age=60", vhttp.CacheControlMaxAgeAtLeast(5 * time.Minute), true},
+		{"max-age-missing", "public", vhttp.CacheControlMaxAgeAtLeast(5 * time.Minute), true},
+		{"public-success", "public, max-age=60", vhttp.CacheControlIsPublic(), false},
+		{"public-private", "public, private", vhttp.CacheControlIsPublic(), true},
+		{"public-missing", "max-age=60", vhttp.CacheControlIsPublic(), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.v(http.Header{vhttp.HeaderCacheControl: []string{c.cc}})
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error returned: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Error("expected an error to be returned")
+			}
+		})
+	}
+}
+
+func TestCacheAnalyzer(t *testing.T) {
+	now := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Add(-time.Minute).Format(http.TimeFormat)
+	cases := []struct {
+		name      string        // Case name
+		shared    bool          // Analyze for a shared cache?
+		method    string        // Request method
+		auth      bool          // Does the request have an Authorization header?
+		status    int           // Response status code
+		headers   http.Header   // Response headers
+		storable  bool          // Expected Storable
+		freshness time.Duration // Expected Freshness
+		ttl       time.Duration // Expected TTL
+	}{
+		{
+			name:      "max-age",
+			status:    200,
+			headers:   http.Header{"Cache-Control": {"max-age=600"}, "Date": {date}},
+			storable:  true,
+			freshness: 10 * time.Minute,
+			ttl:       9 * time.Minute,
+		},
+		{
+			name:      "s-maxage-shared",
+			shared:    true,
+			status:    200,
+			headers:   http.Header{"Cache-Control": {"max-age=60, s-maxage=3600"}, "Date": {date}},
+			storable:  true,
+			freshness: time.Hour,
+			ttl:       59 * time.Minute,
+		},
+		{
+			name:      "s-maxage-private",
+			status:    200,
+			headers:   http.Header{"Cache-Control": {"max-age=60, s-maxage=3600"}, "Date": {date}},
+			storable:  true,
+			freshness: time.Minute,
+			ttl:       0,
+		},
+		{
+			name:      "expires-and-age",
+			status:    200,
+			headers:   http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}, "Date": {date}, "Age": {"300"}},
+			storable:  true,
+			freshness: 61 * time.Minute,
+			ttl:       56 * time.Minute,
+		},
+		{
+			name:     "invalid-expires",
+			status:   200,
+			headers:  http.Header{"Expires": {"0"}, "Date": {date}},
+			storable: true,
+		},
+		{
+			name:      "heuristic",
+			status:    404,
+			headers:   http.Header{"Last-Modified": {now.Add(-11 * time.Hour).Format(http.TimeFormat)}, "Date": {now.Add(-time.Hour).Format(http.TimeFormat)}},
+			storable:  true,
+			freshness: time.Hour,
+		},
+		{
+			name:    "not-heuristically-cacheable",
+			status:  201,
+			headers: http.Header{"Date": {date}},
+		},
+		{
+			name:    "no-store",
+			status:  200,
+			headers: http.Header{"Cache-Control": {"no-store, max-age=600"}},
+		},
+		{
+			name:    "post",
+			method:  http.MethodPost,
+			status:  200,
+			headers: http.Header{"Cache-Control": {"max-age=600"}},
+		},
+		{
+			name:    "private-shared",
+			shared:  true,
+			status:  200,
+			headers: http.Header{"Cache-Control": {"private, max-age=600"}},
+		},
+		{
+			name:      "private-private",
+			status:    200,
+			headers:   http.Header{"Cache-Control": {"private, max-age=600"}, "Date": {date}},
+			storable:  true,
+			freshness: 10 * time.Minute,
+			ttl:       9 * time.Minute,
+		},
+		{
+			name:    "authorization-shared",
+			shared:  true,
+			auth:    true,
+			status:  200,
+			headers: http.Header{"Cache-Control": {"max-age=600"}},
+		},
+		{
+			name:      "authorization-shared-public",
+			shared:    true,
+			auth:      true,
+			status:    200,
+			headers:   http.Header{"Cache-Control": {"public, max-age=600"}, "Date": {date}},
+			storable:  true,
+			freshness: 10 * time.Minute,
+			ttl:       9 * time.Minute,
+		},
+		{
+			name:    "vary-star",
+			status:  200,
+			headers: http.Header{"Cache-Control": {"max-age=600"}, "Vary": {"*"}},
+		},
+		{
+			name:      "no-cache",
+			status:    200,
+			headers:   http.Header{"Cache-Control": {"no-cache, max-age=600"}, "Date": {date}},
+			storable:  true,
+			freshness: 10 * time.Minute,
+			ttl:       0,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(c.method, "https://example.com/", nil)
+			if c.auth {
+				req.Header.Set(vhttp.HeaderAuthorization, "Bearer abc123")
+			}
+			res := &http.Response{StatusCode: c.status, Header: c.headers, Request: req}
+
+			a := vhttp.CacheAnalyzer{Shared: c.shared, Now: func() time.Time { return now }}
+			an := a.Analyze(res)
+			if an.Storable != c.storable {
+				t.Fatalf("expected storable to be %t, found %t (%s)", c.storable, an.Storable, an.Reason)
+			}
+			if !an.Storable && an.Reason == "" {
+				t.Error("expected a reason to be given")
+			}
+			if an.Freshness != c.freshness {
+				t.Errorf("expected freshness %s, found %s", c.freshness, an.Freshness)
+			}
+			if an.TTL() != c.ttl {
+				t.Errorf("expected TTL %s, found %s", c.ttl, an.TTL())
+			}
+
+			// Check the validators
+			if err := vhttp.ResponseNotCacheable(a)(res); (err == nil) == c.storable {
+				t.Errorf("unexpected ResponseNotCacheable result: %v", err)
+			}
+			if err := vhttp.ResponseCacheable(a, c.ttl)(res); (err == nil) != c.storable {
+				t.Errorf("unexpected ResponseCacheable result: %v", err)
+			}
+		})
+	}
+}
+
+func TestCacheAnalyzerVary(t *testing.T) {
+	res := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Vary": {"accept-encoding, Origin", "Accept"}},
+	}
+	an := vhttp.CacheAnalyzer{}.Analyze(res)
+	want := []string{"Accept", "Accept-Encoding", "Origin"}
+	if len(an.Vary) != len(want) {
+		t.Fatalf("expected vary %v, found %v", want, an.Vary)
+	}
+	for i := range want {
+		if an.Vary[i] != want[i] {
+			t.Errorf("expected vary %v, found %v", want, an.Vary)
+		}
+	}
+}
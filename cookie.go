@@ -0,0 +1,311 @@
+package vhttp
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// CookieValidator is a validator that validates an http.Request object's
+// cookies (as returned by req.Cookies).
+type CookieValidator func([]*http.Cookie) error
+
+func (v CookieValidator) ValidateRequest(req *http.Request) error {
+	return v(req.Cookies())
+}
+
+// SetCookieValidator is a validator that validates the cookies set by an
+// http.Response object's "Set-Cookie" headers (as returned by
+// res.Cookies).
+type SetCookieValidator func([]*http.Cookie) error
+
+func (v SetCookieValidator) ValidateResponse(res *http.Response) error {
+	return v(res.Cookies())
+}
+
+// cookieTarget returns the ValidationError target for the request
+// cookie named name.
+func cookieTarget(name string) string {
+	return fmt.Sprintf("cookie[%q]", name)
+}
+
+// setCookieTarget returns the ValidationError target for the response
+// cookie named name.
+func setCookieTarget(name string) string {
+	return fmt.Sprintf("set-cookie[%q]", name)
+}
+
+// findCookies returns the cookies named name.
+func findCookies(cs []*http.Cookie, name string) []*http.Cookie {
+	var out []*http.Cookie
+	for _, c := range cs {
+		if c.Name == name {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// HasCookie creates a CookieValidator that checks that the request has
+// a cookie named name.
+func HasCookie(name string) CookieValidator {
+	return func(cs []*http.Cookie) error {
+		if len(findCookies(cs, name)) == 0 {
+			return validationErrorf(cookieTarget(name), "HasCookie", CodeMissing, nil, nil,
+				"cookie %q not found", name)
+		}
+		return nil
+	}
+}
+
+// CookieIs creates a CookieValidator that checks that the request has a
+// cookie named name with the value v.
+//
+// If the request has multiple cookies named name, any of them can match.
+func CookieIs(name, v string) CookieValidator {
+	return func(cs []*http.Cookie) error {
+		found := findCookies(cs, name)
+		if len(found) == 0 {
+			return validationErrorf(cookieTarget(name), "CookieIs", CodeMissing, v, nil,
+				"cookie %q not found", name)
+		}
+		vals := make([]string, len(found))
+		for i, c := range found {
+			if c.Value == v {
+				return nil
+			}
+			vals[i] = c.Value
+		}
+		return validationErrorf(cookieTarget(name), "CookieIs", CodeMismatch, v, vals,
+			"expected cookie %q to have value %q", name, v)
+	}
+}
+
+// CookieMatches creates a CookieValidator that checks that the request has
+// a cookie named name whose value matches the regular expression re.
+//
+// If the request has multiple cookies named name, any of them can match.
+func CookieMatches(name string, re *regexp.Regexp) CookieValidator {
+	return func(cs []*http.Cookie) error {
+		found := findCookies(cs, name)
+		if len(found) == 0 {
+			return validationErrorf(cookieTarget(name), "CookieMatches", CodeMissing, re.String(), nil,
+				"cookie %q not found", name)
+		}
+		vals := make([]string, len(found))
+		for i, c := range found {
+			if re.MatchString(c.Value) {
+				return nil
+			}
+			vals[i] = c.Value
+		}
+		return validationErrorf(cookieTarget(name), "CookieMatches", CodeNoMatch, re.String(), vals,
+			"expected cookie %q to match %q", name, re)
+	}
+}
+
+// SetCookieHas creates a SetCookieValidator that checks that the response
+// sets a cookie named name.
+func SetCookieHas(name string) SetCookieValidator {
+	return func(cs []*http.Cookie) error {
+		if len(findCookies(cs, name)) == 0 {
+			return validationErrorf(setCookieTarget(name), "SetCookieHas", CodeMissing, nil, nil,
+				"Set-Cookie for cookie %q not found", name)
+		}
+		return nil
+	}
+}
+
+// CookieAttributes describes the attributes expected of a cookie set by
+// a response. The zero value of each field means that the attribute
+// isn't checked.
+type CookieAttributes struct {
+	// Secure requires the Secure attribute.
+	Secure bool
+
+	// HttpOnly requires the HttpOnly attribute.
+	HttpOnly bool
+
+	// SameSite, if set, is the required SameSite attribute.
+	SameSite http.SameSite
+
+	// Path, if set, is the required Path attribute.
+	Path string
+
+	// Domain, if set, is the required Domain attribute (without
+	// a leading dot).
+	Domain string
+
+	// Persistent requires the cookie to have a positive Max-Age or
+	// (without a Max-Age) an Expires attribute in the future. A cookie that
+	// deletes itself (a Max-Age of zero or less, or an Expires in the past)
+	// isn't persistent.
+	Persistent bool
+
+	// Session requires the cookie not to be persistent (see Persistent),
+	// ie to have neither a Max-Age nor an Expires attribute, or to delete
+	// itself.
+	Session bool
+
+	// MaxLifetime, if set, is the longest the cookie may be kept for,
+	// based on its Max-Age or Expires attribute. A cookie with neither
+	// attribute passes.
+	MaxLifetime time.Duration
+
+	// Now returns the current time, used to check Expires for Persistent,
+	// Session and MaxLifetime. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// SetCookieAttributes creates a SetCookieValidator that checks that the
+// response sets a cookie named name and that each cookie it sets with
+// that name has the attributes described by attrs.
+//
+// The cookie prefix rules are also checked (see SetCookiePrefixRules).
+//
+//	v := vhttp.SetCookieAttributes("session", vhttp.CookieAttributes{
+//		Secure:   true,
+//		HttpOnly: true,
+//		SameSite: http.SameSiteLaxMode,
+//		Path:     "/",
+//	})
+func SetCookieAttributes(name string, attrs CookieAttributes) SetCookieValidator {
+	return func(cs []*http.Cookie) error {
+		found := findCookies(cs, name)
+		if len(found) == 0 {
+			return validationErrorf(setCookieTarget(name), "SetCookieAttributes", CodeMissing, nil, nil,
+				"Set-Cookie for cookie %q not found", name)
+		}
+		var merr *multierror.Error
+		for _, c := range found {
+			for _, err := range attrs.check(c) {
+				merr = multierror.Append(merr, err)
+			}
+			for _, err := range checkCookiePrefix(c, "SetCookieAttributes") {
+				merr = multierror.Append(merr, err)
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// check returns an error for each of the cookie's attributes that doesn't
+// match attrs.
+func (attrs CookieAttributes) check(c *http.Cookie) []error {
+	var errs []error
+	fail := func(code ErrorCode, expected, actual any, format string, args ...any) {
+		errs = append(errs, validationErrorf(setCookieTarget(c.Name), "SetCookieAttributes", code, expected, actual,
+			"expected cookie %q "+format, append([]any{c.Name}, args...)...))
+	}
+
+	if attrs.Secure && !c.Secure {
+		fail(CodeMissing, true, false, "to have the Secure attribute")
+	}
+	if attrs.HttpOnly && !c.HttpOnly {
+		fail(CodeMissing, true, false, "to have the HttpOnly attribute")
+	}
+	if attrs.SameSite != 0 && c.SameSite != attrs.SameSite {
+		fail(CodeMismatch, sameSiteString(attrs.SameSite), sameSiteString(c.SameSite),
+			"to have SameSite=%s, found %q", sameSiteString(attrs.SameSite), sameSiteString(c.SameSite))
+	}
+	if attrs.Path != "" && c.Path != attrs.Path {
+		fail(CodeMismatch, attrs.Path, c.Path, "to have Path %q, found %q", attrs.Path, c.Path)
+	}
+	if attrs.Domain != "" && !strings.EqualFold(strings.TrimPrefix(c.Domain, "."), attrs.Domain) {
+		fail(CodeMismatch, attrs.Domain, c.Domain, "to have Domain %q, found %q", attrs.Domain, c.Domain)
+	}
+
+	// Check the cookie's lifetime (a negative MaxAge or an Expires in the
+	// past deletes the cookie, and MaxAge takes precedence over Expires)
+	now := time.Now
+	if attrs.Now != nil {
+		now = attrs.Now
+	}
+	persistent := c.MaxAge > 0 || (c.MaxAge == 0 && !c.Expires.IsZero() && c.Expires.After(now()))
+	if attrs.Persistent && !persistent {
+		fail(CodeMissing, nil, nil, "to have a Max-Age or Expires attribute")
+	}
+	if attrs.Session && persistent {
+		fail(CodeUnexpected, nil, nil, "to be a session cookie without a positive Max-Age or Expires")
+	}
+	if attrs.MaxLifetime > 0 {
+		switch {
+		case c.MaxAge > 0: // Max-Age takes precedence over Expires
+			if d := time.Duration(c.MaxAge) * time.Second; d > attrs.MaxLifetime {
+				fail(CodeOutOfRange, attrs.MaxLifetime, d, "to have a lifetime of at most %s, found Max-Age=%d", attrs.MaxLifetime, c.MaxAge)
+			}
+		case c.MaxAge == 0 && !c.Expires.IsZero():
+			if d := c.Expires.Sub(now()); d > attrs.MaxLifetime {
+				fail(CodeOutOfRange, attrs.MaxLifetime, d, "to have a lifetime of at most %s, found Expires=%s", attrs.MaxLifetime, c.Expires.UTC().Format(http.TimeFormat))
+			}
+		}
+	}
+	return errs
+}
+
+// SetCookiePrefixRules creates a SetCookieValidator that checks that every
+// cookie set by the response follows the cookie prefix rules:
+//
+//   - Cookies named with the "__Secure-" prefix must be Secure.
+//   - Cookies named with the "__Host-" prefix must be Secure, must have
+//     the Path "/" and must not have a Domain.
+//   - Cookies with SameSite=None must be Secure.
+func SetCookiePrefixRules() SetCookieValidator {
+	return func(cs []*http.Cookie) error {
+		var merr *multierror.Error
+		for _, c := range cs {
+			for _, err := range checkCookiePrefix(c, "SetCookiePrefixRules") {
+				merr = multierror.Append(merr, err)
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// checkCookiePrefix returns an error for each of the cookie prefix rules
+// (see SetCookiePrefixRules) that the cookie breaks.
+func checkCookiePrefix(c *http.Cookie, validator string) []error {
+	var errs []error
+	fail := func(code ErrorCode, format string, args ...any) {
+		errs = append(errs, validationErrorf(setCookieTarget(c.Name), validator, code, nil, nil,
+			"expected cookie %q "+format, append([]any{c.Name}, args...)...))
+	}
+
+	switch {
+	case strings.HasPrefix(c.Name, "__Secure-"):
+		if !c.Secure {
+			fail(CodeMissing, "to have the Secure attribute, as required by the __Secure- prefix")
+		}
+	case strings.HasPrefix(c.Name, "__Host-"):
+		if !c.Secure {
+			fail(CodeMissing, "to have the Secure attribute, as required by the __Host- prefix")
+		}
+		if c.Path != "/" {
+			fail(CodeMismatch, "to have Path \"/\", as required by the __Host- prefix, found %q", c.Path)
+		}
+		if c.Domain != "" {
+			fail(CodeUnexpected, "not to have a Domain attribute, as required by the __Host- prefix, found %q", c.Domain)
+		}
+	}
+	if c.SameSite == http.SameSiteNoneMode && !c.Secure {
+		fail(CodeMissing, "to have the Secure attribute, as required by SameSite=None")
+	}
+	return errs
+}
+
+// sameSiteString returns the attribute value for the SameSite mode s.
+func sameSiteString(s http.SameSite) string {
+	switch s {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package vhttp_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestCookieValidators(t *testing.T) {
+	cases := []struct {
+		name   string                 // Case name
+		cookie string                 // Request's Cookie header
+		v      vhttp.RequestValidator // Validator to run
+		isErr  bool                   // Should an error be returned
+	}{
+		{
+			name:   "has-cookie-success",
+			cookie: "session=abc123; theme=dark",
+			v:      vhttp.HasCookie("theme"),
+		},
+		{
+			name:   "has-cookie-missing",
+			cookie: "session=abc123",
+			v:      vhttp.HasCookie("theme"),
+			isErr:  true,
+		},
+		{
+			name:   "cookie-is-success",
+			cookie: "session=abc123; theme=dark",
+			v:      vhttp.CookieIs("theme", "dark"),
+		},
+		{
+			name:   "cookie-is-mismatch",
+			cookie: "session=abc123; theme=light",
+			v:      vhttp.CookieIs("theme", "dark"),
+			isErr:  true,
+		},
+		{
+			name:   "cookie-is-missing",
+			cookie: "",
+			v:      vhttp.CookieIs("theme", "dark"),
+			isErr:  true,
+		},
+		{
+			name:   "cookie-matches-success",
+			cookie: "session=abc123",
+			v:      vhttp.CookieMatches("session", regexp.MustCompile(`^[a-z0-9]+$`)),
+		},
+		{
+			name:   "cookie-matches-no-match",
+			cookie: "session=ABC-123",
+			v:      vhttp.CookieMatches("session", regexp.MustCompile(`^[a-z0-9]+$`)),
+			isErr:  true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := &http.Request{Header: http.Header{}}
+			if c.cookie != "" {
+				req.Header.Set("Cookie", c.cookie)
+			}
+			err := c.v.ValidateRequest(req)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error returned: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Error("expected an error to be returned")
+			}
+		})
+	}
+}
+
+func TestSetCookieValidators(t *testing.T) {
+	now := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+	strict := vhttp.CookieAttributes{
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    http.SameSiteLaxMode,
+		Path:        "/",
+		Domain:      "example.com",
+		Persistent:  true,
+		MaxLifetime: 24 * time.Hour,
+		Now:         func() time.Time { return now },
+	}
+	cases := []struct {
+		name    string                  // Case name
+		cookies []string                // Response's Set-Cookie headers
+		v       vhttp.ResponseValidator // Validator to run
+		nErrs   int                     // Number of errors expected
+	}{
+		{
+			name:    "has-success",
+			cookies: []string{"session=abc123"},
+			v:       vhttp.SetCookieHas("session"),
+		},
+		{
+			name:    "has-missing",
+			cookies: []string{"theme=dark"},
+			v:       vhttp.SetCookieHas("session"),
+			nErrs:   1,
+		},
+		{
+			name:    "attributes-success",
+			cookies: []string{"session=abc123; Path=/; Domain=.example.com; Max-Age=3600; Secure; HttpOnly; SameSite=Lax"},
+			v:       vhttp.SetCookieAttributes("session", strict),
+		},
+		{
+			name:    "attributes-expires-success",
+			cookies: []string{"session=abc123; Path=/; Domain=example.com; Expires=Tue, 01 Nov 2022 18:00:00 GMT; Secure; HttpOnly; SameSite=Lax"},
+			v:       vhttp.SetCookieAttributes("session", strict),
+		},
+		{
+			name:    "attributes-all-missing",
+			cookies: []string{"session=abc123"},
+			v:       vhttp.SetCookieAttributes("session", strict),
+			nErrs:   6,
+		},
+		{
+			name:    "attributes-lifetime-too-long",
+			cookies: []string{"session=abc123; Path=/; Domain=example.com; Expires=Fri, 01 Dec 2023 00:00:00 GMT; Secure; HttpOnly; SameSite=Lax"},
+			v:       vhttp.SetCookieAttributes("session", strict),
+			nErrs:   1,
+		},
+		{
+			name:    "attributes-session",
+			cookies: []string{"session=abc123; Max-Age=60"},
+			v:       vhttp.SetCookieAttributes("session", vhttp.CookieAttributes{Session: true}),
+			nErrs:   1,
+		},
+		{
+			name:    "attributes-deletion-not-persistent",
+			cookies: []string{"session=; Path=/; Domain=example.com; Max-Age=0; Secure; HttpOnly; SameSite=Lax"},
+			v:       vhttp.SetCookieAttributes("session", strict),
+			nErrs:   1,
+		},
+		{
+			name:    "attributes-deletion-is-session",
+			cookies: []string{"session=; Max-Age=0; Expires=Thu, 01 Jan 1970 00:00:00 GMT"},
+			v:       vhttp.SetCookieAttributes("session", vhttp.CookieAttributes{Session: true}),
+		},
+		{
+			name:    "attributes-expires-deletion-not-persistent",
+			cookies: []string{"session=; Path=/; Domain=example.com; Expires=Thu, 01 Jan 1970 00:00:00 GMT; Secure; HttpOnly; SameSite=Lax"},
+			v:       vhttp.SetCookieAttributes("session", strict),
+			nErrs:   1,
+		},
+		{
+			name:    "attributes-expires-deletion-is-session",
+			cookies: []string{"session=; Expires=Thu, 01 Jan 1970 00:00:00 GMT"},
+			v:       vhttp.SetCookieAttributes("session", vhttp.CookieAttributes{Session: true, Now: strict.Now}),
+		},
+		{
+			name:    "attributes-missing-cookie",
+			cookies: nil,
+			v:       vhttp.SetCookieAttributes("session", strict),
+			nErrs:   1,
+		},
+		{
+			name: "prefix-success",
+			cookies: []string{
+				"__Host-id=1; Path=/; Secure",
+				"__Secure-id=2; Domain=example.com; Secure",
+				"cross=3; SameSite=None; Secure",
+			},
+			v: vhttp.SetCookiePrefixRules(),
+		},
+		{
+			name: "prefix-errors",
+			cookies: []string{
+				"__Host-id=1; Path=/app; Domain=example.com; Secure",
+				"__Secure-id=2",
+				"cross=3; SameSite=None",
+			},
+			v:     vhttp.SetCookiePrefixRules(),
+			nErrs: 4,
+		},
+		{
+			name:    "attributes-check-prefix",
+			cookies: []string{"__Host-session=abc123; Path=/"},
+			v:       vhttp.SetCookieAttributes("__Host-session", vhttp.CookieAttributes{}),
+			nErrs:   1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{"Set-Cookie": c.cookies}}
+			err := vhttp.ValidateResponse(res, c.v)
+			if n := len(vhttp.ValidationErrors(err)); n != c.nErrs {
+				t.Errorf("expected %d errors, found %d: %v", c.nErrs, n, err)
+			}
+		})
+	}
+}
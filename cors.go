@@ -0,0 +1,372 @@
+package vhttp
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// CORS headers
+const (
+	HeaderOrigin                        = "Origin"
+	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
+	HeaderAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	HeaderAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	HeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	HeaderAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	HeaderAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
+	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+)
+
+// CORSPolicy describes the cross-origin requests a server is expected to
+// allow, and is used to validate CORS preflight requests and responses and
+// the responses to actual cross-origin requests.
+//
+//	p := vhttp.CORSPolicy{
+//		AllowedOrigins:   []string{"https://example.com", "https://*.example.com"},
+//		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+//		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+//		AllowCredentials: true,
+//		MaxAge:           10 * time.Minute,
+//	}
+//	err := vhttp.ValidateResponse(res, p.PreflightResponseValidator())
+type CORSPolicy struct {
+	// AllowedOrigins are the origins (eg "https://example.com") allowed to
+	// make cross-origin requests. An origin's host can start with a "*."
+	// wildcard to allow any subdomain (eg "https://*.example.com") and
+	// the origin "*" allows any origin.
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods allowed in cross-origin requests. The
+	// CORS-safelisted methods (GET, HEAD and POST) are always allowed.
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers allowed in cross-origin
+	// requests.
+	AllowedHeaders []string
+
+	// AllowCredentials allows cross-origin requests with credentials (eg
+	// cookies), requiring "Access-Control-Allow-Credentials: true".
+	AllowCredentials bool
+
+	// MaxAge, if set, is the expected "Access-Control-Max-Age" of
+	// preflight responses.
+	MaxAge time.Duration
+
+	// ExposedHeaders are the response headers that responses to actual
+	// cross-origin requests are expected to expose.
+	ExposedHeaders []string
+}
+
+// AllowsOrigin reports if the policy allows cross-origin requests from
+// the origin o.
+func (p CORSPolicy) AllowsOrigin(o string) bool {
+	for _, a := range p.AllowedOrigins {
+		if corsOriginMatches(a, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsMethod reports if the policy allows cross-origin requests with
+// the method m.
+func (p CORSPolicy) AllowsMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+		return true
+	}
+	for _, a := range p.AllowedMethods {
+		if a == m {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsHeader reports if the policy allows cross-origin requests with
+// the request header h.
+func (p CORSPolicy) AllowsHeader(h string) bool {
+	return corsListHas(p.AllowedHeaders, h, false)
+}
+
+// anyOrigin reports if the policy allows any origin.
+func (p CORSPolicy) anyOrigin() bool {
+	for _, a := range p.AllowedOrigins {
+		if a == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// corsOriginMatches reports if the origin o matches the allowed origin
+// pattern pat.
+func corsOriginMatches(pat, o string) bool {
+	if pat == "*" {
+		return true
+	}
+	if strings.EqualFold(pat, o) {
+		return true
+	}
+
+	// Wildcard subdomain?
+	pu, err := url.Parse(pat)
+	if err != nil || !strings.HasPrefix(pu.Host, "*.") {
+		return false
+	}
+	ou, err := url.Parse(o)
+	if err != nil || ou.Host == "" || !strings.EqualFold(pu.Scheme, ou.Scheme) || pu.Port() != ou.Port() {
+		return false
+	}
+	suffix := strings.ToLower(strings.TrimPrefix(pu.Hostname(), "*"))
+	host := strings.ToLower(ou.Hostname())
+	return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+}
+
+// corsListHas reports if the header list vs contains v (compared
+// case-insensitively). If wildcard is set, "*" matches any value.
+func corsListHas(vs []string, v string, wildcard bool) bool {
+	for _, s := range vs {
+		if strings.EqualFold(s, v) || (wildcard && s == "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// corsHeaderList returns the comma-separated values of the header h.
+func corsHeaderList(hs http.Header, h string) []string {
+	var out []string
+	for _, v := range hs.Values(h) {
+		out = append(out, splitHeaderList(v)...)
+	}
+	return out
+}
+
+// PreflightRequestValidator creates a RequestFunc that checks that the
+// request is a CORS preflight request (an OPTIONS request with the
+// "Origin" and "Access-Control-Request-Method" headers) that the policy
+// allows.
+func (p CORSPolicy) PreflightRequestValidator() RequestFunc {
+	const name = "CORSPolicy.PreflightRequestValidator"
+	return func(req *http.Request) error {
+		if req.Method != http.MethodOptions {
+			return validationErrorf("method", name, CodeMismatch, http.MethodOptions, req.Method,
+				"expected method %q, found %q", http.MethodOptions, req.Method)
+		}
+		origin := req.Header.Get(HeaderOrigin)
+		if origin == "" {
+			return validationErrorf(headerTarget(HeaderOrigin), name, CodeMissing, nil, nil,
+				"header %q not found", HeaderOrigin)
+		}
+		method := req.Header.Get(HeaderAccessControlRequestMethod)
+		if method == "" {
+			return validationErrorf(headerTarget(HeaderAccessControlRequestMethod), name, CodeMissing, nil, nil,
+				"header %q not found", HeaderAccessControlRequestMethod)
+		}
+
+		var merr *multierror.Error
+		if !p.AllowsOrigin(origin) {
+			merr = multierror.Append(merr, validationErrorf(headerTarget(HeaderOrigin), name, CodeUnexpected, p.AllowedOrigins, origin,
+				"origin %q is not allowed by the CORS policy", origin))
+		}
+		if !p.AllowsMethod(method) {
+			merr = multierror.Append(merr, validationErrorf(headerTarget(HeaderAccessControlRequestMethod), name, CodeUnexpected, p.AllowedMethods, method,
+				"method %q is not allowed by the CORS policy", method))
+		}
+		for _, h := range corsHeaderList(req.Header, HeaderAccessControlRequestHeaders) {
+			if !p.AllowsHeader(h) {
+				merr = multierror.Append(merr, validationErrorf(headerTarget(HeaderAccessControlRequestHeaders), name, CodeUnexpected, p.AllowedHeaders, h,
+					"request header %q is not allowed by the CORS policy", h))
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// PreflightResponseValidator creates a ResponseFunc that checks that the
+// response to a CORS preflight request (the http.Response's Request field)
+// matches the policy.
+//
+// If the policy allows the request's origin, the response must have an
+// ok status and the "Access-Control-Allow-*" headers must allow the
+// origin and the requested method and headers (and credentials, if the
+// policy allows them). The methods and headers that the policy doesn't
+// allow must not be allowed. If the policy doesn't allow the origin, the
+// response must not allow it either.
+func (p CORSPolicy) PreflightResponseValidator() ResponseFunc {
+	const name = "CORSPolicy.PreflightResponseValidator"
+	return func(res *http.Response) error {
+		if res.Request == nil {
+			return InternalErr(fmt.Errorf("response has no request to check the CORS headers of"))
+		}
+		origin := res.Request.Header.Get(HeaderOrigin)
+		if origin == "" {
+			return validationErrorf(headerTarget(HeaderOrigin), name, CodeMissing, nil, nil,
+				"preflight request has no %q header", HeaderOrigin)
+		}
+
+		// Check the origin
+		var merr *multierror.Error
+		add := func(err error) {
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+		allowed, errs := p.checkOrigin(name, origin, res.Header)
+		for _, err := range errs {
+			add(err)
+		}
+		if !allowed {
+			return merr.ErrorOrNil()
+		}
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			add(validationErrorf("status", name, CodeOutOfRange, [2]int{200, 299}, res.StatusCode,
+				"expected preflight response to have an ok status, found %d", res.StatusCode))
+		}
+		wildcard := !p.AllowCredentials
+
+		// Check the method
+		method := res.Request.Header.Get(HeaderAccessControlRequestMethod)
+		methods := corsHeaderList(res.Header, HeaderAccessControlAllowMethods)
+		covered := corsListHas(methods, method, wildcard) || (method == http.MethodGet || method == http.MethodHead || method == http.MethodPost)
+		if method != "" && p.AllowsMethod(method) && !covered {
+			add(validationErrorf(headerTarget(HeaderAccessControlAllowMethods), name, CodeMissing, method, methods,
+				"expected %s to allow method %q", HeaderAccessControlAllowMethods, method))
+		}
+		if method != "" && !p.AllowsMethod(method) && covered {
+			add(validationErrorf(headerTarget(HeaderAccessControlAllowMethods), name, CodeUnexpected, p.AllowedMethods, method,
+				"expected %s not to allow method %q", HeaderAccessControlAllowMethods, method))
+		}
+
+		// Check the headers
+		headers := corsHeaderList(res.Header, HeaderAccessControlAllowHeaders)
+		for _, h := range corsHeaderList(res.Request.Header, HeaderAccessControlRequestHeaders) {
+			// The "*" wildcard doesn't cover the Authorization header
+			covered := corsListHas(headers, h, wildcard && !strings.EqualFold(h, HeaderAuthorization))
+			if p.AllowsHeader(h) && !covered {
+				add(validationErrorf(headerTarget(HeaderAccessControlAllowHeaders), name, CodeMissing, h, headers,
+					"expected %s to allow request header %q", HeaderAccessControlAllowHeaders, h))
+			}
+			if !p.AllowsHeader(h) && covered {
+				add(validationErrorf(headerTarget(HeaderAccessControlAllowHeaders), name, CodeUnexpected, p.AllowedHeaders, h,
+					"expected %s not to allow request header %q", HeaderAccessControlAllowHeaders, h))
+			}
+		}
+
+		// Check the max age
+		if p.MaxAge > 0 {
+			want := strconv.Itoa(int(p.MaxAge / time.Second))
+			if got := res.Header.Get(HeaderAccessControlMaxAge); got != want {
+				add(validationErrorf(headerTarget(HeaderAccessControlMaxAge), name, CodeMismatch, want, got,
+					"expected %s to be %q, found %q", HeaderAccessControlMaxAge, want, got))
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// ResponseValidator creates a ResponseFunc that checks that the response
+// to an actual cross-origin request (the http.Response's Request field)
+// matches the policy.
+//
+// If the policy allows the request's origin, the response must allow the
+// origin (and credentials, if the policy allows them) and must expose the
+// policy's ExposedHeaders. If the policy doesn't allow the origin, the
+// response must not allow it either. Requests without an "Origin" header
+// aren't checked.
+func (p CORSPolicy) ResponseValidator() ResponseFunc {
+	const name = "CORSPolicy.ResponseValidator"
+	return func(res *http.Response) error {
+		if res.Request == nil {
+			return InternalErr(fmt.Errorf("response has no request to check the CORS headers of"))
+		}
+		origin := res.Request.Header.Get(HeaderOrigin)
+		if origin == "" {
+			return nil
+		}
+
+		// Check the origin
+		var merr *multierror.Error
+		allowed, errs := p.checkOrigin(name, origin, res.Header)
+		for _, err := range errs {
+			merr = multierror.Append(merr, err)
+		}
+		if !allowed {
+			return merr.ErrorOrNil()
+		}
+
+		// Check the exposed headers
+		exposed := corsHeaderList(res.Header, HeaderAccessControlExposeHeaders)
+		for _, h := range p.ExposedHeaders {
+			if !corsListHas(exposed, h, !p.AllowCredentials) {
+				merr = multierror.Append(merr, validationErrorf(headerTarget(HeaderAccessControlExposeHeaders), name, CodeMissing, h, exposed,
+					"expected %s to expose response header %q", HeaderAccessControlExposeHeaders, h))
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// checkOrigin checks the response headers hs that allow the origin and
+// credentials, returning if the policy allows the origin and an error
+// for each problem found.
+func (p CORSPolicy) checkOrigin(name, origin string, hs http.Header) (bool, []error) {
+	var errs []error
+	fail := func(h string, code ErrorCode, expected, actual any, format string, args ...any) {
+		errs = append(errs, validationErrorf(headerTarget(h), name, code, expected, actual, format, args...))
+	}
+	acao := hs.Values(HeaderAccessControlAllowOrigin)
+	acac := hs.Get(HeaderAccessControlAllowCredentials)
+
+	// A wildcard origin can never be used with credentials
+	if len(acao) == 1 && acao[0] == "*" && acac == "true" {
+		fail(HeaderAccessControlAllowOrigin, CodeUnexpected, origin, "*",
+			"%s must not be %q when %s is %q", HeaderAccessControlAllowOrigin, "*", HeaderAccessControlAllowCredentials, "true")
+	}
+
+	// Is the origin allowed?
+	if !p.AllowsOrigin(origin) {
+		for _, v := range acao {
+			if v == "*" || v == origin {
+				fail(HeaderAccessControlAllowOrigin, CodeUnexpected, nil, v,
+					"origin %q is not allowed by the CORS policy, but %s is %q", origin, HeaderAccessControlAllowOrigin, v)
+			}
+		}
+		return false, errs
+	}
+
+	// Check the allowed origin
+	switch {
+	case len(acao) == 0:
+		fail(HeaderAccessControlAllowOrigin, CodeMissing, origin, nil,
+			"header %q not found", HeaderAccessControlAllowOrigin)
+	case len(acao) > 1:
+		fail(HeaderAccessControlAllowOrigin, CodeInvalid, origin, acao,
+			"expected a single %s value, found %q", HeaderAccessControlAllowOrigin, acao)
+	case acao[0] == "*" && !p.AllowCredentials && p.anyOrigin():
+	case acao[0] != origin:
+		fail(HeaderAccessControlAllowOrigin, CodeMismatch, origin, acao[0],
+			"expected %s to be %q, found %q", HeaderAccessControlAllowOrigin, origin, acao[0])
+	}
+
+	// Check the credentials
+	if p.AllowCredentials && acac != "true" {
+		fail(HeaderAccessControlAllowCredentials, CodeMismatch, "true", acac,
+			"expected %s to be %q, found %q", HeaderAccessControlAllowCredentials, "true", acac)
+	}
+
+	// Responses that depend on the origin must vary on it
+	if len(acao) == 1 && acao[0] != "*" && !corsListHas(corsHeaderList(hs, "Vary"), HeaderOrigin, true) {
+		fail("Vary", CodeMissing, HeaderOrigin, hs.Values("Vary"),
+			"expected Vary header to include %q, since %s depends on the origin", HeaderOrigin, HeaderAccessControlAllowOrigin)
+	}
+	return true, errs
+}
@@ -0,0 +1,240 @@
+package vhttp_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/a-poor/vhttp"
+)
+
+var corsPolicy = vhttp.CORSPolicy{
+	AllowedOrigins:   []string{"https://example.com", "https://*.example.com"},
+	AllowedMethods:   []string{http.MethodPut, http.MethodDelete},
+	AllowedHeaders:   []string{"Authorization", "Content-Type"},
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+	ExposedHeaders:   []string{"X-Request-Id"},
+}
+
+func TestCORSPolicyAllowsOrigin(t *testing.T) {
+	cases := []struct {
+		origin  string // Request origin
+		allowed bool   // Should the origin be allowed
+	}{
+		{"https://example.com", true},
+		{"https://api.example.com", true},
+		{"https://a.b.example.com", true},
+		{"http://api.example.com", false},
+		{"https://api.example.com:8443", false},
+		{"https://evil-example.com", false},
+		{"https://example.com.evil.com", false},
+		{"null", false},
+	}
+	for _, c := range cases {
+		t.Run(c.origin, func(t *testing.T) {
+			if got := corsPolicy.AllowsOrigin(c.origin); got != c.allowed {
+				t.Errorf("expected AllowsOrigin to be %t, found %t", c.allowed, got)
+			}
+		})
+	}
+	if !(vhttp.CORSPolicy{AllowedOrigins: []string{"*"}}).AllowsOrigin("https://anything.test") {
+		t.Error("expected the wildcard origin to allow any origin")
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	okHeaders := func() http.Header {
+		return http.Header{
+			vhttp.HeaderAccessControlAllowOrigin:      {"https://api.example.com"},
+			vhttp.HeaderAccessControlAllowCredentials: {"true"},
+			vhttp.HeaderAccessControlAllowMethods:     {"PUT, DELETE"},
+			vhttp.HeaderAccessControlAllowHeaders:     {"Authorization, Content-Type"},
+			vhttp.HeaderAccessControlMaxAge:           {"600"},
+			"Vary":                                    {"Origin"},
+		}
+	}
+	cases := []struct {
+		name       string      // Case name
+		origin     string      // Request's Origin header
+		method     string      // Request's Access-Control-Request-Method header
+		reqHeaders string      // Request's Access-Control-Request-Headers header
+		status     int         // Response status code
+		headers    http.Header // Response headers
+		reqErrs    int         // Expected preflight request errors
+		resErrs    int         // Expected preflight response errors
+	}{
+		{
+			name:       "success",
+			origin:     "https://api.example.com",
+			method:     http.MethodPut,
+			reqHeaders: "content-type, authorization",
+			status:     http.StatusNoContent,
+			headers:    okHeaders(),
+		},
+		{
+			name:   "missing-everything",
+			origin: "https://api.example.com",
+			method: http.MethodPut,
+			status: http.StatusNoContent,
+			headers: http.Header{
+				vhttp.HeaderAccessControlAllowOrigin: {"https://api.example.com"},
+			},
+			resErrs: 4, // credentials, methods, max age, vary
+		},
+		{
+			name:   "wildcard-with-credentials",
+			origin: "https://api.example.com",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			headers: func() http.Header {
+				h := okHeaders()
+				h.Set(vhttp.HeaderAccessControlAllowOrigin, "*")
+				return h
+			}(),
+			resErrs: 2, // "*" with credentials, mismatched origin
+		},
+		{
+			name:       "disallowed-method-and-header",
+			origin:     "https://example.com",
+			method:     http.MethodPatch,
+			reqHeaders: "X-Debug",
+			status:     http.StatusNoContent,
+			headers: func() http.Header {
+				h := okHeaders()
+				h.Set(vhttp.HeaderAccessControlAllowOrigin, "https://example.com")
+				h.Set(vhttp.HeaderAccessControlAllowMethods, "PUT, DELETE, PATCH")
+				h.Set(vhttp.HeaderAccessControlAllowHeaders, "X-Debug")
+				return h
+			}(),
+			reqErrs: 2,
+			resErrs: 2,
+		},
+		{
+			name:    "disallowed-origin-rejected",
+			origin:  "https://evil.com",
+			method:  http.MethodPut,
+			status:  http.StatusForbidden,
+			headers: http.Header{},
+			reqErrs: 1,
+		},
+		{
+			name:   "disallowed-origin-allowed",
+			origin: "https://evil.com",
+			method: http.MethodPut,
+			status: http.StatusNoContent,
+			headers: func() http.Header {
+				h := okHeaders()
+				h.Set(vhttp.HeaderAccessControlAllowOrigin, "https://evil.com")
+				return h
+			}(),
+			reqErrs: 1,
+			resErrs: 1,
+		},
+		{
+			name:    "bad-status",
+			origin:  "https://api.example.com",
+			method:  http.MethodPut,
+			status:  http.StatusMethodNotAllowed,
+			headers: okHeaders(),
+			resErrs: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodOptions, "https://api.example.com/users/1", nil)
+			req.Header.Set(vhttp.HeaderOrigin, c.origin)
+			req.Header.Set(vhttp.HeaderAccessControlRequestMethod, c.method)
+			if c.reqHeaders != "" {
+				req.Header.Set(vhttp.HeaderAccessControlRequestHeaders, c.reqHeaders)
+			}
+			res := &http.Response{StatusCode: c.status, Header: c.headers, Request: req}
+
+			err := vhttp.ValidateRequest(req, corsPolicy.PreflightRequestValidator())
+			if n := len(vhttp.ValidationErrors(err)); n != c.reqErrs {
+				t.Errorf("expected %d request errors, found %d: %v", c.reqErrs, n, err)
+			}
+			err = vhttp.ValidateResponse(res, corsPolicy.PreflightResponseValidator())
+			if n := len(vhttp.ValidationErrors(err)); n != c.resErrs {
+				t.Errorf("expected %d response errors, found %d: %v", c.resErrs, n, err)
+			}
+		})
+	}
+}
+
+func TestCORSResponse(t *testing.T) {
+	public := vhttp.CORSPolicy{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Request-Id"}}
+	cases := []struct {
+		name    string           // Case name
+		policy  vhttp.CORSPolicy // Policy to check
+		origin  string           // Request's Origin header
+		headers http.Header      // Response headers
+		nErrs   int              // Expected errors
+	}{
+		{
+			name:   "success",
+			policy: corsPolicy,
+			origin: "https://example.com",
+			headers: http.Header{
+				vhttp.HeaderAccessControlAllowOrigin:      {"https://example.com"},
+				vhttp.HeaderAccessControlAllowCredentials: {"true"},
+				vhttp.HeaderAccessControlExposeHeaders:    {"X-Request-Id"},
+				"Vary":                                    {"Accept-Encoding, Origin"},
+			},
+		},
+		{
+			name:    "no-origin",
+			policy:  corsPolicy,
+			headers: http.Header{},
+		},
+		{
+			name:   "missing-vary-and-exposed",
+			policy: corsPolicy,
+			origin: "https://example.com",
+			headers: http.Header{
+				vhttp.HeaderAccessControlAllowOrigin:      {"https://example.com"},
+				vhttp.HeaderAccessControlAllowCredentials: {"true"},
+			},
+			nErrs: 2,
+		},
+		{
+			name:   "public-wildcard",
+			policy: public,
+			origin: "https://anything.test",
+			headers: http.Header{
+				vhttp.HeaderAccessControlAllowOrigin:   {"*"},
+				vhttp.HeaderAccessControlExposeHeaders: {"*"},
+			},
+		},
+		{
+			name:    "public-missing",
+			policy:  public,
+			origin:  "https://anything.test",
+			headers: http.Header{},
+			nErrs:   2,
+		},
+		{
+			name:   "multiple-origins",
+			policy: public,
+			origin: "https://anything.test",
+			headers: http.Header{
+				vhttp.HeaderAccessControlAllowOrigin:   {"https://anything.test", "*"},
+				vhttp.HeaderAccessControlExposeHeaders: {"X-Request-Id"},
+			},
+			nErrs: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+			if c.origin != "" {
+				req.Header.Set(vhttp.HeaderOrigin, c.origin)
+			}
+			res := &http.Response{StatusCode: http.StatusOK, Header: c.headers, Request: req}
+			err := vhttp.ValidateResponse(res, c.policy.ResponseValidator())
+			if n := len(vhttp.ValidationErrors(err)); n != c.nErrs {
+				t.Errorf("expected %d errors, found %d: %v", c.nErrs, n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package vhttp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Headers used for content codings.
+const (
+	HeaderContentEncoding = "Content-Encoding"
+	HeaderAcceptEncoding  = "Accept-Encoding"
+)
+
+// contentCodings returns the lowercase content codings in the
+// "Content-Encoding" headers of hs, in the order they were applied.
+func contentCodings(hs http.Header) []string {
+	var cs []string
+	for _, v := range hs.Values(HeaderContentEncoding) {
+		for _, c := range splitHeaderList(v) {
+			cs = append(cs, strings.ToLower(c))
+		}
+	}
+	return cs
+}
+
+// DecodeContentEncoding decodes b, which was encoded with the content
+// codings cs in the order given (as listed in a "Content-Encoding"
+// header), by removing them in reverse order.
+//
+// The supported codings are "gzip" (and "x-gzip"), "deflate" (zlib
+// wrapped, falling back to raw deflate) and "identity".
+//
+// If MaxBodyBytes is set, each coding's decoded output is limited to it
+// and the error from a larger output wraps ErrBodyTooLarge, so that a
+// small, highly compressed body can't expand without bound.
+func DecodeContentEncoding(b []byte, cs ...string) ([]byte, error) {
+	for i := len(cs) - 1; i >= 0; i-- {
+		var r io.ReadCloser
+		var err error
+		switch c := strings.ToLower(strings.TrimSpace(cs[i])); c {
+		case "identity":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(b))
+		case "deflate":
+			r, err = zlib.NewReader(bytes.NewReader(b))
+			if err != nil {
+				// Some servers send raw deflate data without the zlib wrapper
+				r, err = flate.NewReader(bytes.NewReader(b)), nil
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content coding %q", c)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %q content: %w", cs[i], err)
+		}
+		var lr io.Reader = r
+		if MaxBodyBytes > 0 {
+			lr = io.LimitReader(r, MaxBodyBytes+1)
+		}
+		b, err = io.ReadAll(lr)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %q content: %w", cs[i], err)
+		}
+		if MaxBodyBytes > 0 && int64(len(b)) > MaxBodyBytes {
+			return nil, errBodyTooLarge()
+		}
+	}
+	return b, nil
+}
+
+// DecodedBodyValidator is a RequestValidator/ResponseValidator that reads
+// the body, decodes it according to the "Content-Encoding" header and
+// passes the decoded bytes to each of its BodyValidators.
+//
+// As with BodyValidator, the body is replaced with a re-readable copy. The
+// copy is of the original (encoded) body.
+type DecodedBodyValidator struct {
+	vs []BodyValidator
+}
+
+// DecodeBody creates a new DecodedBodyValidator.
+//
+//	v := vhttp.DecodeBody(vhttp.BodyIsValidJSON())
+func DecodeBody(vs ...BodyValidator) DecodedBodyValidator {
+	return DecodedBodyValidator{vs}
+}
+
+// ContentEncodingDecodes creates a DecodedBodyValidator that only checks
+// that the body can be decoded according to its "Content-Encoding" header.
+func ContentEncodingDecodes() DecodedBodyValidator {
+	return DecodeBody()
+}
+
+func (v DecodedBodyValidator) ValidateRequest(req *http.Request) error {
+	b, err := readRequestBody(req)
+	if err != nil {
+		return bodyReadErr("failed to read request body", err)
+	}
+	return v.validate(b, req.Header)
+}
+
+func (v DecodedBodyValidator) ValidateResponse(res *http.Response) error {
+	b, err := readResponseBody(res)
+	if err != nil {
+		return bodyReadErr("failed to read response body", err)
+	}
+	return v.validate(b, res.Header)
+}
+
+// validate decodes the body b according to the headers hs and runs the
+// validators on it.
+func (v DecodedBodyValidator) validate(b []byte, hs http.Header) error {
+	cs := contentCodings(hs)
+	if len(b) > 0 {
+		var err error
+		if b, err = DecodeContentEncoding(b, cs...); isBodyTooLarge(err) {
+			return err
+		} else if err != nil {
+			return &ValidationError{
+				Target:    headerTarget(HeaderContentEncoding),
+				Validator: "DecodeBody",
+				Code:      CodeInvalid,
+				Actual:    cs,
+				Message:   fmt.Sprintf("body doesn't decode with content codings %q: %s", cs, err),
+				Err:       err,
+			}
+		}
+	}
+
+	var merr *multierror.Error
+	for _, v := range v.vs {
+		if err := v(b); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return merr.ErrorOrNil()
+}
+
+// acceptEncodingQuality returns the quality value that the
+// "Accept-Encoding" header values vs assign to the content coding c
+// (RFC 9110, section 12.5.3).
+func acceptEncodingQuality(vs []string, c string) (float64, error) {
+	if c == "x-gzip" {
+		c = "gzip"
+	}
+	qs := map[string]float64{}
+	for _, v := range vs {
+		for _, part := range splitHeaderList(v) {
+			params := strings.Split(part, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name == "x-gzip" {
+				name = "gzip"
+			}
+			q := 1.0
+			for _, p := range params[1:] {
+				k, v, _ := strings.Cut(p, "=")
+				if strings.EqualFold(strings.TrimSpace(k), "q") {
+					f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+					if err != nil || f < 0 || f > 1 {
+						return 0, fmt.Errorf("invalid quality value in %q", part)
+					}
+					q = f
+				}
+			}
+			qs[name] = q
+		}
+	}
+	if q, ok := qs[c]; ok {
+		return q, nil
+	}
+	if q, ok := qs["*"]; ok {
+		return q, nil
+	}
+	if c == "identity" {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// ContentEncodingAccepted creates a ResponseFunc that checks that each
+// content coding in the response's "Content-Encoding" header is accepted
+// by the "Accept-Encoding" header of the response's request (the
+// http.Response's Request field). If the request has no
+// "Accept-Encoding" header, any coding is accepted.
+func ContentEncodingAccepted() ResponseFunc {
+	return func(res *http.Response) error {
+		if res.Request == nil {
+			return InternalErr(fmt.Errorf("response has no request to check the Accept-Encoding header of"))
+		}
+		vs := res.Request.Header.Values(HeaderAcceptEncoding)
+		if len(vs) == 0 {
+			return nil
+		}
+		for _, c := range contentCodings(res.Header) {
+			q, err := acceptEncodingQuality(vs, c)
+			if err != nil {
+				return &ValidationError{
+					Target:    headerTarget(HeaderAcceptEncoding),
+					Validator: "ContentEncodingAccepted",
+					Code:      CodeInvalid,
+					Actual:    vs,
+					Message:   fmt.Sprintf("invalid %q header: %s", HeaderAcceptEncoding, err),
+					Err:       err,
+				}
+			}
+			if q == 0 {
+				return validationErrorf(headerTarget(HeaderContentEncoding), "ContentEncodingAccepted", CodeUnexpected, vs, c,
+					"response content coding %q is not accepted by the request's %q header", c, HeaderAcceptEncoding)
+			}
+		}
+		return nil
+	}
+}
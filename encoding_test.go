@@ -0,0 +1,170 @@
+package vhttp_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+// encodeBody encodes b with the content codings cs, in order.
+func encodeBody(t *testing.T, b []byte, cs ...string) []byte {
+	t.Helper()
+	for _, c := range cs {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch c {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		default:
+			t.Fatalf("unknown coding %q", c)
+		}
+		w.Write(b)
+		w.Close()
+		b = buf.Bytes()
+	}
+	return b
+}
+
+func TestDecodeBody(t *testing.T) {
+	body := []byte(`{"hello": "world"}`)
+	cases := []struct {
+		name     string   // Case name
+		body     []byte   // Encoded body
+		encoding []string // Content-Encoding header values
+		nErrs    int      // Expected errors
+	}{
+		{name: "none", body: body},
+		{name: "identity", body: body, encoding: []string{"identity"}},
+		{name: "gzip", body: encodeBody(t, body, "gzip"), encoding: []string{"gzip"}},
+		{name: "x-gzip", body: encodeBody(t, body, "gzip"), encoding: []string{"X-GZIP"}},
+		{name: "deflate", body: encodeBody(t, body, "deflate"), encoding: []string{"deflate"}},
+		{name: "raw-deflate", body: encodeBody(t, body, "raw-deflate"), encoding: []string{"deflate"}},
+		{name: "stacked", body: encodeBody(t, body, "deflate", "gzip"), encoding: []string{"deflate, gzip"}},
+		{name: "stacked-headers", body: encodeBody(t, body, "gzip", "deflate"), encoding: []string{"gzip", "deflate"}},
+		{name: "stacked-wrong-order", body: encodeBody(t, body, "deflate", "gzip"), encoding: []string{"gzip, deflate"}, nErrs: 1},
+		{name: "not-encoded", body: body, encoding: []string{"gzip"}, nErrs: 1},
+		{name: "unsupported", body: body, encoding: []string{"br"}, nErrs: 1},
+		{name: "encoded-not-declared", body: encodeBody(t, body, "gzip"), nErrs: 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &http.Response{
+				Header: http.Header{"Content-Encoding": c.encoding},
+				Body:   io.NopCloser(bytes.NewReader(c.body)),
+			}
+			err := vhttp.ValidateResponse(res, vhttp.DecodeBody(vhttp.BodyIsValidJSON()))
+			if n := len(vhttp.ValidationErrors(err)); n != c.nErrs {
+				t.Errorf("expected %d errors, found %d: %v", c.nErrs, n, err)
+			}
+
+			// The original body is still readable
+			if b, _ := io.ReadAll(res.Body); !bytes.Equal(b, c.body) {
+				t.Error("expected the encoded body to be readable after validation")
+			}
+		})
+	}
+
+	// Requests are decoded too
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", bytes.NewReader(encodeBody(t, body, "gzip")))
+	req.Header.Set("Content-Encoding", "gzip")
+	if err := vhttp.ValidateRequest(req, vhttp.ContentEncodingDecodes(), vhttp.DecodeBody(vhttp.BodyIsString(string(body)))); err != nil {
+		t.Errorf("expected no error, found %v", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader([]byte("not gzip")))
+	if err := vhttp.ValidateRequest(req, vhttp.ContentEncodingDecodes()); err == nil {
+		t.Error("expected an error for a body that doesn't decode")
+	}
+}
+
+func TestDecodeBodyMaxBodyBytes(t *testing.T) {
+	vhttp.MaxBodyBytes = 64 << 10
+	defer func() { vhttp.MaxBodyBytes = 0 }()
+
+	// A decompression bomb: a small body that decodes to 16 MiB
+	bomb := bytes.Repeat([]byte{0}, 16<<20)
+	cases := []struct {
+		name     string          // Case name
+		body     []byte          // Encoded body
+		encoding []string        // Content-Encoding header values
+		code     vhttp.ErrorCode // Expected error code
+	}{
+		{name: "under", body: encodeBody(t, []byte(`{"hello": "world"}`), "gzip"), encoding: []string{"gzip"}},
+		{name: "gzip-bomb", body: encodeBody(t, bomb, "gzip"), encoding: []string{"gzip"}, code: vhttp.CodeTooLarge},
+		{name: "deflate-bomb", body: encodeBody(t, bomb, "deflate"), encoding: []string{"deflate"}, code: vhttp.CodeTooLarge},
+		{name: "stacked-bomb", body: encodeBody(t, bomb, "gzip", "gzip"), encoding: []string{"gzip", "gzip"}, code: vhttp.CodeTooLarge},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if int64(len(c.body)) > vhttp.MaxBodyBytes {
+				t.Fatalf("expected the encoded body to be under the limit, found %d bytes", len(c.body))
+			}
+			res := &http.Response{
+				Header: http.Header{"Content-Encoding": c.encoding},
+				Body:   io.NopCloser(bytes.NewReader(c.body)),
+			}
+			err := vhttp.ValidateResponse(res, vhttp.ContentEncodingDecodes())
+			if !checkErrCode(t, err, c.code) {
+				return
+			}
+			if c.code != "" && !errors.Is(err, vhttp.ErrBodyTooLarge) {
+				t.Errorf("expected the error to wrap ErrBodyTooLarge, found %v", err)
+			}
+			if _, err := vhttp.DecodeContentEncoding(c.body, c.encoding...); (c.code != "") != errors.Is(err, vhttp.ErrBodyTooLarge) {
+				t.Errorf("expected DecodeContentEncoding too-large error to be %t, found %v", c.code != "", err)
+			}
+		})
+	}
+}
+
+func TestContentEncodingAccepted(t *testing.T) {
+	cases := []struct {
+		name     string   // Case name
+		accept   []string // Request's Accept-Encoding header values
+		encoding string   // Response's Content-Encoding header
+		isErr    bool     // Should an error be returned
+	}{
+		{name: "no-accept-encoding", encoding: "br"},
+		{name: "accepted", accept: []string{"gzip, deflate"}, encoding: "gzip"},
+		{name: "x-gzip", accept: []string{"x-gzip"}, encoding: "gzip"},
+		{name: "stacked", accept: []string{"gzip", "deflate;q=0.5"}, encoding: "deflate, gzip"},
+		{name: "not-accepted", accept: []string{"gzip"}, encoding: "br", isErr: true},
+		{name: "stacked-partly", accept: []string{"gzip"}, encoding: "deflate, gzip", isErr: true},
+		{name: "zero-quality", accept: []string{"gzip;q=0, deflate"}, encoding: "gzip", isErr: true},
+		{name: "wildcard", accept: []string{"*"}, encoding: "br"},
+		{name: "wildcard-excluded", accept: []string{"*;q=0.5, br;q=0"}, encoding: "br", isErr: true},
+		{name: "identity", accept: []string{"gzip"}},
+		{name: "identity-explicit", accept: []string{"gzip"}, encoding: "identity"},
+		{name: "identity-refused", accept: []string{"gzip, identity;q=0"}, encoding: "identity", isErr: true},
+		{name: "empty-only-identity", accept: []string{""}, encoding: "gzip", isErr: true},
+		{name: "invalid-quality", accept: []string{"gzip;q=2"}, encoding: "gzip", isErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+			req.Header["Accept-Encoding"] = c.accept
+			res := &http.Response{Header: http.Header{}, Request: req}
+			if c.encoding != "" {
+				res.Header.Set("Content-Encoding", c.encoding)
+			}
+			if err := vhttp.ValidateResponse(res, vhttp.ContentEncodingAccepted()); (err != nil) != c.isErr {
+				t.Errorf("expected error to be %t, found %v", c.isErr, err)
+			}
+		})
+	}
+
+	// The request is required
+	if err := vhttp.ValidateResponse(&http.Response{Header: http.Header{}}, vhttp.ContentEncodingAccepted()); err == nil {
+		t.Error("expected an error without the response's request")
+	}
+}
@@ -0,0 +1,172 @@
+package vhttp
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// MimeForm is the media type of URL-encoded form bodies.
+const MimeForm = "application/x-www-form-urlencoded"
+
+// FormValidator is a validator that validates the URL-encoded form values
+// in an http.Request object's body.
+//
+// The values are only parsed if the request's Content-Type is
+// "application/x-www-form-urlencoded". Otherwise, the form is empty. Unlike
+// req.ParseForm, the URL's query parameters aren't included and the body
+// is left readable for later validators and handlers.
+type FormValidator func(url.Values) error
+
+func (v FormValidator) ValidateRequest(req *http.Request) error {
+	// Is the body a URL-encoded form?
+	vs := url.Values{}
+	if mt, _, _ := mime.ParseMediaType(req.Header.Get(HeaderContentType)); mt != MimeForm {
+		return v(vs)
+	}
+
+	// Read and parse the body
+	b, err := readRequestBody(req)
+	if err != nil {
+		return bodyReadErr("failed to read request body", err)
+	}
+	vs, err = url.ParseQuery(string(b))
+	if err != nil {
+		return &ValidationError{
+			Target:    "body",
+			Validator: "FormValidator",
+			Code:      CodeInvalid,
+			Message:   fmt.Sprintf("body is not a valid URL-encoded form: %s", err),
+			Err:       err,
+		}
+	}
+	return v(vs)
+}
+
+// formTarget returns the ValidationError target for the form field k.
+func formTarget(k string) string {
+	return fmt.Sprintf("form[%q]", k)
+}
+
+// FormHas creates a FormValidator that checks that the form contains
+// the given key k.
+func FormHas(k string) FormValidator {
+	return func(vs url.Values) error {
+		if !vs.Has(k) {
+			return validationErrorf(formTarget(k), "FormHas", CodeMissing, nil, nil,
+				"expected value for form field %q to be present", k)
+		}
+		return nil
+	}
+}
+
+// FormIs creates a FormValidator that checks that the form contains the
+// given key k with the value v.
+func FormIs(k, v string) FormValidator {
+	return func(vs url.Values) error {
+		// Check each of the values for the key
+		for _, s := range vs[k] {
+			if s == v {
+				return nil
+			}
+		}
+
+		// Not found...
+		return validationErrorf(formTarget(k), "FormIs", CodeMismatch, v, vs[k],
+			"expected at least one value for form field %q to be %q", k, v)
+	}
+}
+
+// FormMatches creates a FormValidator that checks that the form contains
+// the given key k with a value that matches the regular expression re.
+func FormMatches(k string, re *regexp.Regexp) FormValidator {
+	return func(vs url.Values) error {
+		// Check each of the values for the key
+		for _, s := range vs[k] {
+			if re.MatchString(s) {
+				return nil
+			}
+		}
+
+		// Not found...
+		return validationErrorf(formTarget(k), "FormMatches", CodeNoMatch, re.String(), vs[k],
+			"expected at least one value for form field %q to match %q", k, re)
+	}
+}
+
+// FormValueValidator creates a FormValidator that applies the validator
+// function vfn to the first value for the given key in the form.
+func FormValueValidator(k string, vfn func(string) error) FormValidator {
+	return func(vs url.Values) error {
+		// Get the first value for the given key
+		v := vs.Get(k)
+
+		// Run the validator function
+		err := vfn(v)
+		if err != nil {
+			return &ValidationError{
+				Target:    formTarget(k),
+				Validator: "FormValueValidator",
+				Code:      CodeInvalid,
+				Actual:    v,
+				Message:   fmt.Sprintf("error validating form field %q=%q: %v", k, v, err),
+				Err:       err,
+			}
+		}
+		return nil
+	}
+}
+
+// FormRequired creates a FormValidator that checks that the form contains
+// each of the keys ks. An error is returned for each missing key.
+func FormRequired(ks ...string) FormValidator {
+	return func(vs url.Values) error {
+		var merr *multierror.Error
+		for _, k := range ks {
+			if !vs.Has(k) {
+				merr = multierror.Append(merr, validationErrorf(formTarget(k), "FormRequired", CodeMissing, nil, nil,
+					"expected value for form field %q to be present", k))
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// FormForbidden creates a FormValidator that checks that the form doesn't
+// contain any of the keys ks. An error is returned for each key found.
+func FormForbidden(ks ...string) FormValidator {
+	return func(vs url.Values) error {
+		var merr *multierror.Error
+		for _, k := range ks {
+			if vs.Has(k) {
+				merr = multierror.Append(merr, validationErrorf(formTarget(k), "FormForbidden", CodeUnexpected, nil, vs[k],
+					"expected form field %q not to be present", k))
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// FormNoUnknownFields creates a FormValidator that checks that the form
+// only contains the keys ks. An error is returned for each other key.
+func FormNoUnknownFields(ks ...string) FormValidator {
+	known := make(map[string]bool, len(ks))
+	for _, k := range ks {
+		known[k] = true
+	}
+	return func(vs url.Values) error {
+		// Sort the keys so the errors are in a stable order
+		var merr *multierror.Error
+		for _, k := range jsSortedKeys(vs) {
+			if !known[k] {
+				merr = multierror.Append(merr, validationErrorf(formTarget(k), "FormNoUnknownFields", CodeUndeclared, ks, k,
+					"unknown form field %q", k))
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
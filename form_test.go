@@ -0,0 +1,145 @@
+package vhttp_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestFormValidators(t *testing.T) {
+	isInt := func(s string) error {
+		_, err := strconv.Atoi(s)
+		return err
+	}
+	cases := []struct {
+		name  string              // Case name
+		ct    string              // Request's Content-Type
+		body  string              // Request's body
+		v     vhttp.FormValidator // Validator to run
+		nErrs int                 // Number of errors expected
+	}{
+		{
+			name: "has-success",
+			ct:   vhttp.MimeForm,
+			body: "name=Austin&age=30",
+			v:    vhttp.FormHas("name"),
+		},
+		{
+			name:  "has-missing",
+			ct:    vhttp.MimeForm,
+			body:  "age=30",
+			v:     vhttp.FormHas("name"),
+			nErrs: 1,
+		},
+		{
+			name:  "has-wrong-content-type",
+			ct:    vhttp.MimeJSON,
+			body:  "name=Austin",
+			v:     vhttp.FormHas("name"),
+			nErrs: 1,
+		},
+		{
+			name: "is-success-with-charset",
+			ct:   vhttp.MimeForm + "; charset=utf-8",
+			body: "tag=a&tag=b",
+			v:    vhttp.FormIs("tag", "b"),
+		},
+		{
+			name:  "is-mismatch",
+			ct:    vhttp.MimeForm,
+			body:  "tag=a&tag=b",
+			v:     vhttp.FormIs("tag", "c"),
+			nErrs: 1,
+		},
+		{
+			name: "matches-success",
+			ct:   vhttp.MimeForm,
+			body: "email=austin%40example.com",
+			v:    vhttp.FormMatches("email", regexp.MustCompile(`^[^@]+@[^@]+$`)),
+		},
+		{
+			name:  "matches-no-match",
+			ct:    vhttp.MimeForm,
+			body:  "email=austin",
+			v:     vhttp.FormMatches("email", regexp.MustCompile(`^[^@]+@[^@]+$`)),
+			nErrs: 1,
+		},
+		{
+			name: "value-validator-success",
+			ct:   vhttp.MimeForm,
+			body: "age=30",
+			v:    vhttp.FormValueValidator("age", isInt),
+		},
+		{
+			name:  "value-validator-error",
+			ct:    vhttp.MimeForm,
+			body:  "age=thirty",
+			v:     vhttp.FormValueValidator("age", isInt),
+			nErrs: 1,
+		},
+		{
+			name:  "required",
+			ct:    vhttp.MimeForm,
+			body:  "name=Austin",
+			v:     vhttp.FormRequired("name", "email", "age"),
+			nErrs: 2,
+		},
+		{
+			name:  "forbidden",
+			ct:    vhttp.MimeForm,
+			body:  "name=Austin&admin=true",
+			v:     vhttp.FormForbidden("admin", "role"),
+			nErrs: 1,
+		},
+		{
+			name:  "no-unknown-fields",
+			ct:    vhttp.MimeForm,
+			body:  "name=Austin&admin=true&role=owner",
+			v:     vhttp.FormNoUnknownFields("name", "email"),
+			nErrs: 2,
+		},
+		{
+			name:  "invalid-body",
+			ct:    vhttp.MimeForm,
+			body:  "name=%zz",
+			v:     vhttp.FormHas("name"),
+			nErrs: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := newBodyRequest(c.body)
+			req.Method = http.MethodPost
+			req.Header.Set(vhttp.HeaderContentType, c.ct)
+
+			err := vhttp.ValidateRequest(req, c.v)
+			if n := len(vhttp.ValidationErrors(err)); n != c.nErrs {
+				t.Errorf("expected %d errors, found %d: %v", c.nErrs, n, err)
+			}
+
+			// Was the body left readable?
+			b, _ := io.ReadAll(req.Body)
+			if string(b) != c.body {
+				t.Errorf("expected body %q to be readable, found %q", c.body, b)
+			}
+		})
+	}
+}
+
+func TestFormValueValidatorUnwrap(t *testing.T) {
+	errNotInt := errors.New("not an integer")
+	req := newBodyRequest("age=thirty")
+	req.Header.Set(vhttp.HeaderContentType, vhttp.MimeForm)
+
+	err := vhttp.ValidateRequest(req, vhttp.FormValueValidator("age", func(string) error {
+		return errNotInt
+	}))
+	if !errors.Is(err, errNotInt) {
+		t.Errorf("expected error to wrap %q, found %v", errNotInt, err)
+	}
+}
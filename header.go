@@ -18,6 +18,11 @@ func (v HeaderValidator) ValidateResponse(res *http.Response) error {
 	return v(res.Header)
 }
 
+// headerTarget returns the ValidationError target for the header h.
+func headerTarget(h string) string {
+	return fmt.Sprintf("header[%q]", h)
+}
+
 // HasHeader creates a request validator that checks that the header h
 // is present in the request object.
 //
@@ -32,7 +37,8 @@ func HasHeader(h string) HeaderValidator {
 
 		// Check if the header is present.
 		if _, ok := hs[h]; !ok {
-			return fmt.Errorf("header %q not found", h)
+			return validationErrorf(headerTarget(h), "HasHeader", CodeMissing, nil, nil,
+				"header %q not found", h)
 		}
 
 		// Found!
@@ -73,7 +79,8 @@ func HeaderIs(h, v string) HeaderValidator {
 		// Get the header values
 		vs, ok := hs[h]
 		if !ok {
-			return fmt.Errorf("header %q not found", h)
+			return validationErrorf(headerTarget(h), "HeaderIs", CodeMissing, v, nil,
+				"header %q not found", h)
 		}
 
 		// Check if the header is present.
@@ -84,7 +91,8 @@ func HeaderIs(h, v string) HeaderValidator {
 		}
 
 		// Not found.
-		return fmt.Errorf("expected header %q to have value %q", h, v)
+		return validationErrorf(headerTarget(h), "HeaderIs", CodeMismatch, v, vs,
+			"expected header %q to have value %q", h, v)
 	}
 }
 
@@ -96,20 +104,24 @@ func HeaderAuthorizationIs(t string) HeaderValidator {
 
 // HeaderContentTypeIs creates a request validator that checks that at least
 // one of the "Content-Type" header values are equal to t.
+//
+// See ContentTypeIs for a validator that parses the media type.
 func HeaderContentTypeIs(ct string) HeaderValidator {
 	return HeaderIs("Content-Type", ct)
 }
 
-// HeaderContentTypeJSON creates a request validator that checks that at
-// least one of the "Content-Type" header values are equal to "application/json".
+// HeaderContentTypeJSON creates a request validator that checks that the
+// "Content-Type" header's media type is "application/json". Parameters
+// (eg "charset") are ignored.
 func HeaderContentTypeJSON() HeaderValidator {
-	return HeaderIs("Content-Type", "application/json")
+	return ContentTypeIs("application/json")
 }
 
-// HeaderContentTypeXML creates a request validator that checks that at
-// least one of the "Content-Type" header values are equal to "application/xml".
+// HeaderContentTypeXML creates a request validator that checks that the
+// "Content-Type" header's media type is "application/xml". Parameters
+// (eg "charset") are ignored.
 func HeaderContentTypeXML() HeaderValidator {
-	return HeaderIs("Content-Type", "application/xml")
+	return ContentTypeIs("application/xml")
 }
 
 // HeaderMatches creates a request validator that checks that at least one
@@ -127,7 +139,8 @@ func HeaderMatches(h string, re *regexp.Regexp) HeaderValidator {
 		// Get the header values
 		vs, ok := hs[h]
 		if !ok {
-			return fmt.Errorf("header %q not found", h)
+			return validationErrorf(headerTarget(h), "HeaderMatches", CodeMissing, re.String(), nil,
+				"header %q not found", h)
 		}
 
 		// Check if the header is present.
@@ -138,7 +151,8 @@ func HeaderMatches(h string, re *regexp.Regexp) HeaderValidator {
 		}
 
 		// Not found.
-		return fmt.Errorf("expected header %q to match %q", h, re)
+		return validationErrorf(headerTarget(h), "HeaderMatches", CodeNoMatch, re.String(), vs,
+			"expected header %q to match %q", h, re)
 	}
 }
 
@@ -147,7 +161,8 @@ func HeaderMatches(h string, re *regexp.Regexp) HeaderValidator {
 // expression for a basic authentication header.
 //
 // The regular expression is defined in the variable vhttp.BasicAuthMatch
-// as `^Basic .+`.
+// as `^Basic .+`. See BasicAuthCredentials and BasicAuthHtpasswd for
+// validators that check the decoded credentials.
 func HeaderAuthorizationMatchesBasic() HeaderValidator {
 	return HeaderMatches("Authorization", BasicAuthMatch)
 }
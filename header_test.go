@@ -239,11 +239,95 @@ func TestHeaderContentTypeIs(t *testing.T) {
 }
 
 func TestHeaderContentTypeJSON(t *testing.T) {
-	t.Errorf("not implemented")
+	cases := []struct {
+		name    string      // Case name
+		headers http.Header // Request's headers
+		isErr   bool        // Should an error be returned
+	}{
+		{
+			name: "success",
+			headers: http.Header{
+				vhttp.HeaderContentType: []string{"application/json"},
+			},
+			isErr: false,
+		},
+		{
+			name: "success-with-charset",
+			headers: http.Header{
+				vhttp.HeaderContentType: []string{"application/json; charset=utf-8"},
+			},
+			isErr: false,
+		},
+		{
+			name: "wrong-type-error",
+			headers: http.Header{
+				vhttp.HeaderContentType: []string{"application/xml"},
+			},
+			isErr: true,
+		},
+		{
+			name:    "missing-error",
+			headers: http.Header{},
+			isErr:   true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := vhttp.HeaderContentTypeJSON()(c.headers)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error returned: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Error("expected an error to be returned")
+			}
+		})
+	}
 }
 
 func TestHeaderContentTypeXML(t *testing.T) {
-	t.Errorf("not implemented")
+	cases := []struct {
+		name    string      // Case name
+		headers http.Header // Request's headers
+		isErr   bool        // Should an error be returned
+	}{
+		{
+			name: "success",
+			headers: http.Header{
+				vhttp.HeaderContentType: []string{"application/xml"},
+			},
+			isErr: false,
+		},
+		{
+			name: "success-with-charset",
+			headers: http.Header{
+				vhttp.HeaderContentType: []string{"application/xml; charset=utf-8"},
+			},
+			isErr: false,
+		},
+		{
+			name: "wrong-type-error",
+			headers: http.Header{
+				vhttp.HeaderContentType: []string{"application/json"},
+			},
+			isErr: true,
+		},
+		{
+			name:    "missing-error",
+			headers: http.Header{},
+			isErr:   true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := vhttp.HeaderContentTypeXML()(c.headers)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error returned: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Error("expected an error to be returned")
+			}
+		})
+	}
 }
 
 func TestHeaderMatches(t *testing.T) {
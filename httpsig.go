@@ -0,0 +1,638 @@
+package vhttp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers used by HTTP Message Signatures (RFC 9421) and Digest Fields
+// (RFC 9530).
+const (
+	HeaderSignature      = "Signature"
+	HeaderSignatureInput = "Signature-Input"
+	HeaderContentDigest  = "Content-Digest"
+)
+
+// HTTP Message Signature algorithms (RFC 9421, section 3.3) supported
+// by HTTPSigVerifier.
+const (
+	HTTPSigRSAPSSSHA512    = "rsa-pss-sha512"
+	HTTPSigRSAv15SHA256    = "rsa-v1_5-sha256"
+	HTTPSigHMACSHA256      = "hmac-sha256"
+	HTTPSigECDSAP256SHA256 = "ecdsa-p256-sha256"
+	HTTPSigEd25519         = "ed25519"
+)
+
+// HTTPSigKey is a key used to verify HTTP message signatures.
+type HTTPSigKey struct {
+	// Algorithm is the key's signature algorithm (eg HTTPSigEd25519).
+	// If empty, it is inferred from the key's type, with RSA keys
+	// using HTTPSigRSAPSSSHA512.
+	Algorithm string
+
+	// Key is the key itself: an ed25519.PublicKey, an *ecdsa.PublicKey
+	// on the P-256 curve, an *rsa.PublicKey or a []byte HMAC secret.
+	Key any
+}
+
+// algorithm returns the key's algorithm.
+func (k HTTPSigKey) algorithm() string {
+	if k.Algorithm != "" {
+		return k.Algorithm
+	}
+	switch k.Key.(type) {
+	case ed25519.PublicKey:
+		return HTTPSigEd25519
+	case *ecdsa.PublicKey:
+		return HTTPSigECDSAP256SHA256
+	case *rsa.PublicKey:
+		return HTTPSigRSAPSSSHA512
+	case []byte:
+		return HTTPSigHMACSHA256
+	}
+	return ""
+}
+
+// verify verifies the signature sig of base.
+func (k HTTPSigKey) verify(base, sig []byte) error {
+	alg := k.algorithm()
+	ok := false
+	switch alg {
+	case HTTPSigEd25519:
+		pub, isKey := k.Key.(ed25519.PublicKey)
+		ok = isKey && ed25519.Verify(pub, base, sig)
+	case HTTPSigECDSAP256SHA256:
+		pub, isKey := k.Key.(*ecdsa.PublicKey)
+		if isKey && pub.Curve == elliptic.P256() && len(sig) == 64 {
+			sum := sha256.Sum256(base)
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			ok = ecdsa.Verify(pub, sum[:], r, s)
+		}
+	case HTTPSigRSAPSSSHA512:
+		if pub, isKey := k.Key.(*rsa.PublicKey); isKey {
+			sum := sha512.Sum512(base)
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			ok = rsa.VerifyPSS(pub, crypto.SHA512, sum[:], sig, opts) == nil
+		}
+	case HTTPSigRSAv15SHA256:
+		if pub, isKey := k.Key.(*rsa.PublicKey); isKey {
+			sum := sha256.Sum256(base)
+			ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+		}
+	case HTTPSigHMACSHA256:
+		if secret, isKey := k.Key.([]byte); isKey {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(base)
+			ok = hmac.Equal(mac.Sum(nil), sig)
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if !ok {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// HTTPSigKeyResolver returns the key with the ID keyID (the signature's
+// "keyid" parameter, which may be empty).
+type HTTPSigKeyResolver func(keyID string) (HTTPSigKey, error)
+
+// StaticHTTPSigKeys creates an HTTPSigKeyResolver that looks up keys
+// by ID in keys.
+func StaticHTTPSigKeys(keys map[string]HTTPSigKey) HTTPSigKeyResolver {
+	return func(keyID string) (HTTPSigKey, error) {
+		k, ok := keys[keyID]
+		if !ok {
+			return HTTPSigKey{}, fmt.Errorf("unknown key %q", keyID)
+		}
+		return k, nil
+	}
+}
+
+// HTTPSigVerifier verifies HTTP Message Signatures (RFC 9421).
+//
+// The supported derived components are "@method", "@target-uri",
+// "@authority", "@scheme", "@request-target", "@path", "@query" and (for
+// responses) "@status". Components of a response's request can be covered
+// using the "req" parameter. If the "content-digest" header is covered, it
+// is also checked against the message's body (supporting "sha-256" and
+// "sha-512").
+type HTTPSigVerifier struct {
+	// Keys resolves the keys used to verify signatures.
+	Keys HTTPSigKeyResolver
+
+	// Label, if set, is the label of the signature to verify. Otherwise,
+	// every signature in the message is verified.
+	Label string
+
+	// Required are the components (eg "@method" or "content-digest")
+	// that signatures must cover.
+	Required []string
+
+	// MaxAge, if non-zero, requires signatures to have a "created"
+	// parameter no older than MaxAge.
+	MaxAge time.Duration
+
+	// Leeway is the clock skew allowed when checking the "created" and
+	// "expires" parameters.
+	Leeway time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// RequestValidator creates a RequestFunc that verifies the request's
+// signatures.
+func (v HTTPSigVerifier) RequestValidator() RequestFunc {
+	return func(req *http.Request) error {
+		return v.verify("HTTPSigVerifier.RequestValidator", &sigMessage{
+			header: req.Header,
+			req:    req,
+			body:   func() ([]byte, error) { return readRequestBody(req) },
+		})
+	}
+}
+
+// ResponseValidator creates a ResponseFunc that verifies the response's
+// signatures.
+func (v HTTPSigVerifier) ResponseValidator() ResponseFunc {
+	return func(res *http.Response) error {
+		return v.verify("HTTPSigVerifier.ResponseValidator", &sigMessage{
+			header: res.Header,
+			req:    res.Request,
+			res:    res,
+			body:   func() ([]byte, error) { return readResponseBody(res) },
+		})
+	}
+}
+
+// verify verifies the message's signatures.
+func (v HTTPSigVerifier) verify(validator string, m *sigMessage) error {
+	target := headerTarget(HeaderSignature)
+	inputs, labels, err := parseSFDictionary(m.header.Values(HeaderSignatureInput))
+	if err != nil {
+		return validationErrorf(headerTarget(HeaderSignatureInput), validator, CodeInvalid, nil, nil,
+			"invalid %q header: %s", HeaderSignatureInput, err)
+	}
+	sigs, _, err := parseSFDictionary(m.header.Values(HeaderSignature))
+	if err != nil {
+		return validationErrorf(target, validator, CodeInvalid, nil, nil,
+			"invalid %q header: %s", HeaderSignature, err)
+	}
+	if len(inputs) == 0 || len(sigs) == 0 {
+		return validationErrorf(target, validator, CodeMissing, nil, nil,
+			"expected %q and %q headers", HeaderSignatureInput, HeaderSignature)
+	}
+	if v.Label != "" {
+		if _, ok := inputs[v.Label]; !ok {
+			return validationErrorf(target, validator, CodeMissing, v.Label, labels,
+				"expected a signature labeled %q", v.Label)
+		}
+		labels = []string{v.Label}
+	}
+	for _, l := range labels {
+		if err := v.verifyOne(validator, m, l, inputs[l], sigs[l]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyOne verifies the signature labeled l, with the serialized
+// Signature-Input and Signature dictionary values input and sig.
+func (v HTTPSigVerifier) verifyOne(validator string, m *sigMessage, l, input, sig string) error {
+	target := headerTarget(HeaderSignature)
+	fail := func(code ErrorCode, format string, args ...any) error {
+		return validationErrorf(target, validator, code, nil, nil,
+			"invalid signature %q: "+format, append([]any{l}, args...)...)
+	}
+
+	// Parse the signature and its parameters
+	if sig == "" {
+		return fail(CodeMissing, "no matching %q value", HeaderSignature)
+	}
+	raw, rest, err := parseSFBareItem(sig)
+	sigBytes, ok := raw.([]byte)
+	if err != nil || !ok || rest != "" {
+		return fail(CodeInvalid, "expected a byte sequence")
+	}
+	items, params, err := parseSFInnerList(input)
+	if err != nil {
+		return fail(CodeInvalid, "%s", err)
+	}
+
+	// Are the required components covered?
+	covered := map[string]bool{}
+	for _, it := range items {
+		if name, ok := it.value.(string); ok {
+			covered[name] = true
+		}
+	}
+	for _, c := range v.Required {
+		if !covered[strings.ToLower(c)] {
+			return validationErrorf(target, validator, CodeMissing, c, nil,
+				"invalid signature %q: expected component %q to be covered", l, c)
+		}
+	}
+
+	// Check the time window
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	t := now()
+	created, hasCreated := params["created"].(int64)
+	if v.MaxAge > 0 && !hasCreated {
+		return fail(CodeMissing, "expected a %q parameter", "created")
+	}
+	if hasCreated {
+		c := time.Unix(created, 0)
+		if c.After(t.Add(v.Leeway)) {
+			return fail(CodeOutOfRange, "created in the future at %s", c.UTC().Format(time.RFC3339))
+		}
+		if v.MaxAge > 0 && t.Sub(c) > v.MaxAge+v.Leeway {
+			return fail(CodeOutOfRange, "created at %s, more than %s ago", c.UTC().Format(time.RFC3339), v.MaxAge)
+		}
+	}
+	if expires, ok := params["expires"].(int64); ok {
+		if e := time.Unix(expires, 0); !t.Before(e.Add(v.Leeway)) {
+			return fail(CodeOutOfRange, "expired at %s", e.UTC().Format(time.RFC3339))
+		}
+	}
+
+	// Build the signature base
+	base, err := m.signatureBase(items, input)
+	if err != nil {
+		var ierr InternalError
+		if errors.As(err, &ierr) {
+			return ierr
+		}
+		return fail(CodeInvalid, "%s", err)
+	}
+
+	// Get the key and verify
+	if v.Keys == nil {
+		return InternalErr(fmt.Errorf("no key resolver configured"))
+	}
+	keyID, _ := params["keyid"].(string)
+	key, err := v.Keys(keyID)
+	if err != nil {
+		return fail(CodeInvalid, "%s", err)
+	}
+	if alg, ok := params["alg"].(string); ok && alg != key.algorithm() {
+		return fail(CodeInvalid, "algorithm %q doesn't match key %q", alg, keyID)
+	}
+	if err := key.verify(base, sigBytes); err != nil {
+		return fail(CodeInvalid, "%s", err)
+	}
+
+	// Check the covered content digest
+	for _, it := range items {
+		if it.value == "content-digest" && it.params["req"] == nil {
+			return m.checkContentDigest(validator)
+		}
+	}
+	return nil
+}
+
+// sigMessage is a request or response being verified.
+type sigMessage struct {
+	header http.Header
+	req    *http.Request  // The request (or the response's request)
+	res    *http.Response // The response, if verifying one
+	body   func() ([]byte, error)
+}
+
+// signatureBase builds the signature base (RFC 9421, section 2.5) for
+// the covered components items and serialized signature parameters.
+func (m *sigMessage) signatureBase(items []sfItem, params string) ([]byte, error) {
+	var b bytes.Buffer
+	seen := map[string]bool{}
+	for _, it := range items {
+		if seen[it.raw] {
+			return nil, fmt.Errorf("component %s is covered more than once", it.raw)
+		}
+		seen[it.raw] = true
+		v, err := m.component(it)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%s: %s\n", it.raw, v)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", params)
+	return b.Bytes(), nil
+}
+
+// component returns the value of the covered component it.
+func (m *sigMessage) component(it sfItem) (string, error) {
+	name, ok := it.value.(string)
+	if !ok || name != strings.ToLower(name) {
+		return "", fmt.Errorf("invalid component identifier %s", it.raw)
+	}
+	for p := range it.params {
+		if p != "req" {
+			return "", fmt.Errorf("unsupported component parameter %q", p)
+		}
+	}
+
+	// Which message is the component from?
+	header, isReq := m.header, m.res == nil
+	if it.params["req"] != nil {
+		if m.res == nil {
+			return "", fmt.Errorf("component %s: the %q parameter is only valid for responses", it.raw, "req")
+		}
+		if m.req == nil {
+			return "", InternalErr(fmt.Errorf("response has no request to get component %s from", it.raw))
+		}
+		header, isReq = m.req.Header, true
+	}
+
+	// Derived components
+	if strings.HasPrefix(name, "@") {
+		if name == "@status" {
+			if isReq {
+				return "", fmt.Errorf("component %s is only valid for responses", it.raw)
+			}
+			return fmt.Sprintf("%03d", m.res.StatusCode), nil
+		}
+		if !isReq {
+			return "", fmt.Errorf("component %s is only valid for requests", it.raw)
+		}
+		req := m.req
+		switch name {
+		case "@method":
+			return req.Method, nil
+		case "@target-uri":
+			return requestScheme(req) + "://" + requestAuthority(req) + req.URL.RequestURI(), nil
+		case "@authority":
+			return requestAuthority(req), nil
+		case "@scheme":
+			return requestScheme(req), nil
+		case "@request-target":
+			return req.URL.RequestURI(), nil
+		case "@path":
+			if p := req.URL.EscapedPath(); p != "" {
+				return p, nil
+			}
+			return "/", nil
+		case "@query":
+			return "?" + req.URL.RawQuery, nil
+		}
+		return "", fmt.Errorf("unsupported derived component %s", it.raw)
+	}
+
+	// Header fields
+	vs := header.Values(name)
+	if len(vs) == 0 && name == "host" && isReq {
+		vs = []string{requestAuthority(m.req)}
+	}
+	if len(vs) == 0 {
+		return "", fmt.Errorf("covered header %q not found", name)
+	}
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(out, ", "), nil
+}
+
+// checkContentDigest checks that the message's Content-Digest header
+// (RFC 9530) matches its body.
+func (m *sigMessage) checkContentDigest(validator string) error {
+	target := headerTarget(HeaderContentDigest)
+	digests, _, err := parseSFDictionary(m.header.Values(HeaderContentDigest))
+	if err != nil {
+		return validationErrorf(target, validator, CodeInvalid, nil, nil,
+			"invalid %q header: %s", HeaderContentDigest, err)
+	}
+	body, err := m.body()
+	if err != nil {
+		return bodyReadErr("failed to read body", err)
+	}
+	checked := false
+	for alg, v := range digests {
+		var sum []byte
+		switch alg {
+		case "sha-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "sha-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		got, _, err := parseSFBareItem(v)
+		if b, ok := got.([]byte); err != nil || !ok || !bytes.Equal(b, sum) {
+			return validationErrorf(target, validator, CodeMismatch, nil, v,
+				"%q digest in the %q header doesn't match the body", alg, HeaderContentDigest)
+		}
+		checked = true
+	}
+	if !checked {
+		return validationErrorf(target, validator, CodeInvalid, nil, nil,
+			"expected a %q or %q digest in the %q header", "sha-256", "sha-512", HeaderContentDigest)
+	}
+	return nil
+}
+
+// requestScheme returns the request's lowercase URI scheme.
+func requestScheme(req *http.Request) string {
+	if req.URL.Scheme != "" {
+		return strings.ToLower(req.URL.Scheme)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestAuthority returns the request's lowercase authority, without
+// the scheme's default port.
+func requestAuthority(req *http.Request) string {
+	a := req.Host
+	if a == "" {
+		a = req.URL.Host
+	}
+	a = strings.ToLower(a)
+	switch s := requestScheme(req); {
+	case s == "http" && strings.HasSuffix(a, ":80"):
+		a = strings.TrimSuffix(a, ":80")
+	case s == "https" && strings.HasSuffix(a, ":443"):
+		a = strings.TrimSuffix(a, ":443")
+	}
+	return a
+}
+
+// sfItem is a structured field (RFC 8941) item in an inner list.
+type sfItem struct {
+	raw    string         // The serialized item, as it appeared
+	value  any            // The bare item
+	params map[string]any // The item's parameters
+}
+
+// parseSFDictionary parses the structured field dictionary in the header
+// values vs, returning its members' serialized values by key and the keys
+// in order.
+func parseSFDictionary(vs []string) (map[string]string, []string, error) {
+	d := map[string]string{}
+	var keys []string
+	for _, m := range splitHeaderList(strings.Join(vs, ",")) {
+		k, v, ok := strings.Cut(m, "=")
+		if !ok || k == "" || strings.TrimLeft(k, "abcdefghijklmnopqrstuvwxyz0123456789_-.*") != "" {
+			return nil, nil, fmt.Errorf("invalid dictionary member %q", m)
+		}
+		if _, dup := d[k]; !dup {
+			keys = append(keys, k)
+		}
+		d[k] = strings.TrimSpace(v)
+	}
+	return d, keys, nil
+}
+
+// parseSFInnerList parses a structured field inner list with parameters.
+func parseSFInnerList(s string) ([]sfItem, map[string]any, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, nil, fmt.Errorf("expected an inner list")
+	}
+	s = s[1:]
+	var items []sfItem
+	for {
+		s = strings.TrimLeft(s, " ")
+		if strings.HasPrefix(s, ")") {
+			s = s[1:]
+			break
+		}
+		if s == "" {
+			return nil, nil, fmt.Errorf("unterminated inner list")
+		}
+		start := s
+		v, rest, err := parseSFBareItem(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		ps, rest, err := parseSFParams(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, sfItem{raw: start[:len(start)-len(rest)], value: v, params: ps})
+		s = rest
+		if !strings.HasPrefix(s, " ") && !strings.HasPrefix(s, ")") {
+			return nil, nil, fmt.Errorf("invalid inner list item")
+		}
+	}
+	ps, rest, err := parseSFParams(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rest != "" {
+		return nil, nil, fmt.Errorf("unexpected %q after inner list", rest)
+	}
+	return items, ps, nil
+}
+
+// parseSFParams parses the structured field parameters at the start of s,
+// returning them and the rest of s.
+func parseSFParams(s string) (map[string]any, string, error) {
+	ps := map[string]any{}
+	for strings.HasPrefix(s, ";") {
+		s = strings.TrimLeft(s[1:], " ")
+		i := 0
+		for i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] >= '0' && s[i] <= '9' || strings.IndexByte("_-.*", s[i]) >= 0) {
+			i++
+		}
+		if i == 0 {
+			return nil, "", fmt.Errorf("invalid parameter key")
+		}
+		k := s[:i]
+		s = s[i:]
+		var v any = true
+		if strings.HasPrefix(s, "=") {
+			var err error
+			if v, s, err = parseSFBareItem(s[1:]); err != nil {
+				return nil, "", err
+			}
+		}
+		ps[k] = v
+	}
+	return ps, s, nil
+}
+
+// parseSFBareItem parses the structured field bare item at the start of
+// s, returning it and the rest of s. Integers are returned as int64,
+// strings and tokens as string, byte sequences as []byte and booleans as
+// bool.
+func parseSFBareItem(s string) (any, string, error) {
+	switch {
+	case s == "":
+		return nil, "", fmt.Errorf("expected an item")
+	case s[0] == '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '\\':
+				if i+1 == len(s) || (s[i+1] != '"' && s[i+1] != '\\') {
+					return nil, "", fmt.Errorf("invalid string escape")
+				}
+				i++
+				b.WriteByte(s[i])
+			case '"':
+				return b.String(), s[i+1:], nil
+			default:
+				if c < 0x20 || c > 0x7e {
+					return nil, "", fmt.Errorf("invalid string character")
+				}
+				b.WriteByte(c)
+			}
+		}
+		return nil, "", fmt.Errorf("unterminated string")
+	case s[0] == ':':
+		end := strings.IndexByte(s[1:], ':')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated byte sequence")
+		}
+		b, err := base64.StdEncoding.DecodeString(s[1 : end+1])
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid byte sequence: %w", err)
+		}
+		return b, s[end+2:], nil
+	case s[0] == '?':
+		if len(s) < 2 || (s[1] != '0' && s[1] != '1') {
+			return nil, "", fmt.Errorf("invalid boolean")
+		}
+		return s[1] == '1', s[2:], nil
+	case s[0] == '-' || s[0] >= '0' && s[0] <= '9':
+		i := 1
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 64)
+		if err != nil || i > 16 {
+			return nil, "", fmt.Errorf("invalid integer %q", s[:i])
+		}
+		return n, s[i:], nil
+	case s[0] == '*' || s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z':
+		i := 1
+		for i < len(s) && strings.IndexByte(" ;,()=\"", s[i]) < 0 {
+			i++
+		}
+		return s[:i], s[i:], nil
+	}
+	return nil, "", fmt.Errorf("invalid item %q", s)
+}
@@ -0,0 +1,253 @@
+package vhttp_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-poor/vhttp"
+)
+
+// httpSigTestRequest creates the example request from RFC 9421,
+// appendix B.2.
+func httpSigTestRequest() *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	req.Header.Set("Content-Length", "18")
+	return req
+}
+
+func TestHTTPSigVerifierRFCExamples(t *testing.T) {
+	edPub, _ := base64.RawURLEncoding.DecodeString("JrQLj5P_89iXES9-vFgrIy29clF9CC_oPPsw3c5D0bs")
+	secret, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+	v := vhttp.HTTPSigVerifier{
+		Keys: vhttp.StaticHTTPSigKeys(map[string]vhttp.HTTPSigKey{
+			"test-key-ed25519":   {Key: ed25519.PublicKey(edPub)},
+			"test-shared-secret": {Algorithm: vhttp.HTTPSigHMACSHA256, Key: secret},
+		}),
+		Now: func() time.Time { return time.Unix(1618884480, 0) },
+	}
+	cases := []struct {
+		name  string // Case name
+		input string // Signature-Input header
+		sig   string // Signature header
+	}{
+		{
+			name:  "ed25519",
+			input: `sig-b26=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`,
+			sig:   `sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:`,
+		},
+		{
+			name:  "hmac-sha256",
+			input: `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`,
+			sig:   `sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httpSigTestRequest()
+			req.Header.Set("Signature-Input", c.input)
+			req.Header.Set("Signature", c.sig)
+			if err := vhttp.ValidateRequest(req, v.RequestValidator()); err != nil {
+				t.Errorf("expected no error, found %v", err)
+			}
+			req.Header.Set("Content-Type", "text/plain")
+			if err := vhttp.ValidateRequest(req, v.RequestValidator()); err == nil {
+				t.Error("expected an error after changing a covered header")
+			}
+		})
+	}
+}
+
+func TestHTTPSigVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signEC := func(base string) []byte {
+		sum := sha256.Sum256([]byte(base))
+		r, s, _ := ecdsa.Sign(rand.Reader, ecKey, sum[:])
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	signRSA := func(base string) []byte {
+		sum := sha512.Sum512([]byte(base))
+		s, _ := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA512, sum[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		return s
+	}
+	v := vhttp.HTTPSigVerifier{
+		Keys: vhttp.StaticHTTPSigKeys(map[string]vhttp.HTTPSigKey{
+			"ec":  {Key: &ecKey.PublicKey},
+			"rsa": {Key: &rsaKey.PublicKey},
+		}),
+		Required: []string{"@method", "@target-uri", "content-digest"},
+		MaxAge:   5 * time.Minute,
+		Leeway:   time.Second,
+		Now:      func() time.Time { return now },
+	}
+
+	params := `("@method" "@target-uri" "@authority" "@path" "@query" "content-digest");created=1700000000;expires=1700000060;keyid="ec";alg="ecdsa-p256-sha256"`
+	base := strings.Join([]string{
+		`"@method": POST`,
+		`"@target-uri": https://example.com/foo?param=Value&Pet=dog`,
+		`"@authority": example.com`,
+		`"@path": /foo`,
+		`"@query": ?param=Value&Pet=dog`,
+		`"content-digest": sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:`,
+		`"@signature-params": ` + params,
+	}, "\n")
+	sig := base64.StdEncoding.EncodeToString(signEC(base))
+
+	cases := []struct {
+		name   string                 // Case name
+		input  string                 // Signature-Input header
+		sig    string                 // Signature header
+		modify func(r *http.Request)  // Modifies the request
+		v      *vhttp.HTTPSigVerifier // Verifier override
+		code   vhttp.ErrorCode        // Expected error code (empty for success)
+	}{
+		{name: "success", input: "sig1=" + params, sig: "sig1=:" + sig + ":"},
+		{name: "missing", code: vhttp.CodeMissing},
+		{name: "no-matching-signature", input: "sig1=" + params, sig: "sig2=:" + sig + ":", code: vhttp.CodeMissing},
+		{
+			name:  "wrong-label",
+			input: "sig1=" + params,
+			sig:   "sig1=:" + sig + ":",
+			v:     &vhttp.HTTPSigVerifier{Keys: v.Keys, Label: "proxy", Now: v.Now},
+			code:  vhttp.CodeMissing,
+		},
+		{
+			name:   "tampered-method",
+			input:  "sig1=" + params,
+			sig:    "sig1=:" + sig + ":",
+			modify: func(r *http.Request) { r.Method = http.MethodPut },
+			code:   vhttp.CodeInvalid,
+		},
+		{
+			name:   "tampered-body",
+			input:  "sig1=" + params,
+			sig:    "sig1=:" + sig + ":",
+			modify: func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"hello": "mallory"}`)) },
+			code:   vhttp.CodeMismatch,
+		},
+		{
+			name:  "expired",
+			input: "sig1=" + params,
+			sig:   "sig1=:" + sig + ":",
+			v:     &vhttp.HTTPSigVerifier{Keys: v.Keys, Now: func() time.Time { return now.Add(2 * time.Minute) }},
+			code:  vhttp.CodeOutOfRange,
+		},
+		{
+			name:  "too-old",
+			input: "sig1=" + params,
+			sig:   "sig1=:" + sig + ":",
+			v:     &vhttp.HTTPSigVerifier{Keys: v.Keys, MaxAge: time.Second, Now: func() time.Time { return now.Add(30 * time.Second) }},
+			code:  vhttp.CodeOutOfRange,
+		},
+		{
+			name:  "created-in-future",
+			input: "sig1=" + params,
+			sig:   "sig1=:" + sig + ":",
+			v:     &vhttp.HTTPSigVerifier{Keys: v.Keys, Now: func() time.Time { return now.Add(-time.Minute) }},
+			code:  vhttp.CodeOutOfRange,
+		},
+		{
+			name:  "required-component",
+			input: `sig1=("@method");created=1700000000;keyid="ec"`,
+			sig:   "sig1=:" + sig + ":",
+			code:  vhttp.CodeMissing,
+		},
+		{
+			name:  "wrong-alg",
+			input: strings.Replace("sig1="+params, "ecdsa-p256-sha256", "rsa-pss-sha512", 1),
+			sig:   "sig1=:" + sig + ":",
+			code:  vhttp.CodeInvalid,
+		},
+		{
+			name:  "unknown-key",
+			input: strings.Replace("sig1="+params, `keyid="ec"`, `keyid="other"`, 1),
+			sig:   "sig1=:" + sig + ":",
+			code:  vhttp.CodeInvalid,
+		},
+		{
+			name:  "malformed-input",
+			input: `sig1=("@method" "@path";created=1`,
+			sig:   "sig1=:" + sig + ":",
+			code:  vhttp.CodeInvalid,
+		},
+		{
+			name:  "unsupported-component",
+			input: `sig1=("@method" "@target-uri" "content-digest" "@query-param";name="Pet");keyid="ec"`,
+			sig:   "sig1=:" + sig + ":",
+			v:     &vhttp.HTTPSigVerifier{Keys: v.Keys, Now: v.Now},
+			code:  vhttp.CodeInvalid,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httpSigTestRequest()
+			if c.input != "" {
+				req.Header.Set("Signature-Input", c.input)
+				req.Header.Set("Signature", c.sig)
+			}
+			if c.modify != nil {
+				c.modify(req)
+			}
+			vv := v
+			if c.v != nil {
+				vv = *c.v
+			}
+			err := vhttp.ValidateRequest(req, vv.RequestValidator())
+			checkErrCode(t, err, c.code)
+		})
+	}
+
+	t.Run("response", func(t *testing.T) {
+		params := `("@status" "content-type" "@method";req "@authority";req);created=1700000000;keyid="rsa"`
+		base := strings.Join([]string{
+			`"@status": 201`,
+			`"content-type": application/json`,
+			`"@method";req: POST`,
+			`"@authority";req: example.com`,
+			`"@signature-params": ` + params,
+		}, "\n")
+		res := &http.Response{
+			StatusCode: http.StatusCreated,
+			Header: http.Header{
+				"Content-Type":    {"application/json"},
+				"Signature-Input": {"res=" + params},
+				"Signature":       {"res=:" + base64.StdEncoding.EncodeToString(signRSA(base)) + ":"},
+			},
+			Request: httpSigTestRequest(),
+		}
+		rv := vhttp.HTTPSigVerifier{Keys: v.Keys, Label: "res", Required: []string{"@status"}, Now: v.Now}
+		if err := vhttp.ValidateResponse(res, rv.ResponseValidator()); err != nil {
+			t.Errorf("expected no error, found %v", err)
+		}
+		res.StatusCode = http.StatusOK
+		if err := vhttp.ValidateResponse(res, rv.ResponseValidator()); err == nil {
+			t.Error("expected an error after changing the status")
+		}
+		res.Request = nil
+		if err := vhttp.ValidateResponse(res, rv.ResponseValidator()); len(vhttp.ValidationErrors(err)) != 0 || err == nil {
+			t.Errorf("expected an internal error without the request, found %v", err)
+		}
+	})
+}
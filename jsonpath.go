@@ -0,0 +1,1021 @@
+package vhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSON value type names, as used by JSONPathType.
+const (
+	JSONTypeObject  = "object"
+	JSONTypeArray   = "array"
+	JSONTypeString  = "string"
+	JSONTypeNumber  = "number"
+	JSONTypeBoolean = "boolean"
+	JSONTypeNull    = "null"
+)
+
+// JSONPath is a compiled JSONPath expression that can be used to select
+// values from a decoded JSON document (as returned by json.Unmarshal into
+// an `any` value).
+//
+// The supported syntax follows RFC 9535 and includes:
+//
+//	$                 the root value
+//	.name ['name']    object members
+//	[0] [-1]          array elements (negative indexes count from the end)
+//	.* [*]            all object members or array elements
+//	..name ..[0] ..*  recursive descent
+//	[start:end:step]  array slices
+//	['a','b'] [0,1]   unions
+//	[?(@.price < 10)] filter expressions
+//
+// Filter expressions support the comparison operators ==, !=, <, <=, >
+// and >=, regular expression matching with =~ (eg `@.name =~ /^a/i`),
+// existence tests (eg `[?(@.isbn)]`), the logical operators &&, || and !,
+// and parentheses. Queries inside a filter can be relative to the current
+// value (@) or the root ($).
+type JSONPath struct {
+	expr string
+	segs []jpSegment
+}
+
+// CompileJSONPath parses the JSONPath expression s.
+func CompileJSONPath(s string) (*JSONPath, error) {
+	p := &jpParser{s: s}
+	segs, err := p.parseRoot()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON path %q: %w", s, err)
+	}
+	return &JSONPath{expr: s, segs: segs}, nil
+}
+
+// MustCompileJSONPath is like CompileJSONPath but panics if the
+// expression can't be parsed.
+func MustCompileJSONPath(s string) *JSONPath {
+	p, err := CompileJSONPath(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source text of the expression.
+func (p *JSONPath) String() string {
+	return p.expr
+}
+
+// Select returns the list of values selected by the path from the
+// decoded JSON value v.
+func (p *JSONPath) Select(v any) []any {
+	return jpApply(p.segs, v, v)
+}
+
+// JSONPathExists creates a BodyValidator that checks that the JSON body
+// contains at least one value selected by the JSONPath expression path.
+//
+//	v := vhttp.JSONPathExists("$.data.items[0].id")
+func JSONPathExists(path string) BodyValidator {
+	return jsonPathValidator("JSONPathExists", path, nil)
+}
+
+// JSONPathEquals creates a BodyValidator that checks that each value
+// selected from the JSON body by the JSONPath expression path is equal
+// to v.
+//
+// The value v is compared after being encoded and decoded as JSON, so
+// (for example) any Go numeric type can be compared against a JSON number
+// and structs can be compared against JSON objects.
+func JSONPathEquals(path string, v any) BodyValidator {
+	// Normalize the expected value
+	want, err := jsonNormalize(v)
+	if err != nil {
+		return func(b []byte) error {
+			return InternalErr(fmt.Errorf("failed to encode expected value as JSON: %w", err))
+		}
+	}
+
+	return jsonPathValidator("JSONPathEquals", path, func(got any) error {
+		if !reflect.DeepEqual(got, want) {
+			return validationErrorf(jsonPathTarget(path), "JSONPathEquals", CodeMismatch, want, got,
+				"expected JSON path %q to equal %s, found %s", path, jsonString(want), jsonString(got))
+		}
+		return nil
+	})
+}
+
+// JSONPathMatches creates a BodyValidator that checks that each value
+// selected from the JSON body by the JSONPath expression path matches
+// the regular expression re.
+//
+// String values are matched directly. Other values are matched against
+// their JSON encoding (eg `123` or `true`).
+func JSONPathMatches(path string, re *regexp.Regexp) BodyValidator {
+	return jsonPathValidator("JSONPathMatches", path, func(got any) error {
+		s, ok := got.(string)
+		if !ok {
+			s = jsonString(got)
+		}
+		if !re.MatchString(s) {
+			return validationErrorf(jsonPathTarget(path), "JSONPathMatches", CodeNoMatch, re.String(), got,
+				"expected JSON path %q to match %q, found %s", path, re, jsonString(got))
+		}
+		return nil
+	})
+}
+
+// JSONPathLen creates a BodyValidator that checks that each value selected
+// from the JSON body by the JSONPath expression path has length n.
+//
+// The length of an array is its number of elements, the length of an object
+// is its number of members and the length of a string is its number of
+// characters. Other types return an error.
+func JSONPathLen(path string, n int) BodyValidator {
+	return jsonPathValidator("JSONPathLen", path, func(got any) error {
+		var m int
+		switch t := got.(type) {
+		case []any:
+			m = len(t)
+		case map[string]any:
+			m = len(t)
+		case string:
+			m = utf8.RuneCountInString(t)
+		default:
+			return validationErrorf(jsonPathTarget(path), "JSONPathLen", CodeInvalid, n, got,
+				"expected JSON path %q to be an array, object or string, found %s %s", path, jsonType(got), jsonString(got))
+		}
+		if m != n {
+			return validationErrorf(jsonPathTarget(path), "JSONPathLen", CodeMismatch, n, m,
+				"expected JSON path %q to have length %d, found length %d", path, n, m)
+		}
+		return nil
+	})
+}
+
+// JSONPathType creates a BodyValidator that checks that each value selected
+// from the JSON body by the JSONPath expression path has the JSON type t
+// (one of "object", "array", "string", "number", "boolean" or "null").
+func JSONPathType(path string, t string) BodyValidator {
+	return jsonPathValidator("JSONPathType", path, func(got any) error {
+		if jt := jsonType(got); jt != t {
+			return validationErrorf(jsonPathTarget(path), "JSONPathType", CodeMismatch, t, jt,
+				"expected JSON path %q to be of type %s, found %s %s", path, t, jt, jsonString(got))
+		}
+		return nil
+	})
+}
+
+// jsonPathTarget returns the ValidationError target for a JSONPath
+// expression in the body.
+func jsonPathTarget(path string) string {
+	return fmt.Sprintf("body[%q]", path)
+}
+
+// jsonPathValidator creates a BodyValidator (named name) that decodes the
+// body, selects the values at path and (if fn isn't nil) runs fn on each
+// of them.
+func jsonPathValidator(name, path string, fn func(any) error) BodyValidator {
+	p, perr := CompileJSONPath(path)
+	return func(b []byte) error {
+		// Was the path valid?
+		if perr != nil {
+			return InternalErr(perr)
+		}
+
+		// Decode the body
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return &ValidationError{
+				Target:    "body",
+				Validator: name,
+				Code:      CodeInvalid,
+				Message:   fmt.Sprintf("body is not valid JSON: %s", err),
+				Err:       err,
+			}
+		}
+
+		// Select the values
+		vs := p.Select(v)
+		if len(vs) == 0 {
+			return validationErrorf(jsonPathTarget(path), name, CodeMissing, nil, nil,
+				"JSON path %q not found", path)
+		}
+		if fn == nil {
+			return nil
+		}
+
+		// Validate each of the values
+		for _, v := range vs {
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// jsonNormalize converts v to the value it would have if it were
+// encoded as JSON and decoded into an `any` value.
+func jsonNormalize(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// jsonString returns the compact JSON encoding of v, for use in
+// error messages.
+func jsonString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// jsonType returns the JSON type name for a decoded JSON value.
+func jsonType(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return JSONTypeObject
+	case []any:
+		return JSONTypeArray
+	case string:
+		return JSONTypeString
+	case float64, json.Number:
+		return JSONTypeNumber
+	case bool:
+		return JSONTypeBoolean
+	case nil:
+		return JSONTypeNull
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jpSegment is a single segment of a JSONPath query (eg `.name`,
+// `[0,1]` or `..*`).
+type jpSegment struct {
+	descendant bool
+	sels       []jpSelector
+}
+
+// jpSelector selects values from a single JSON value.
+type jpSelector interface {
+	selectFrom(root, v any, out []any) []any
+}
+
+// jpName selects an object member by name.
+type jpName string
+
+func (s jpName) selectFrom(root, v any, out []any) []any {
+	if m, ok := v.(map[string]any); ok {
+		if c, ok := m[string(s)]; ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// jpIndex selects an array element by index.
+type jpIndex int
+
+func (s jpIndex) selectFrom(root, v any, out []any) []any {
+	if a, ok := v.([]any); ok {
+		i := int(s)
+		if i < 0 {
+			i += len(a)
+		}
+		if i >= 0 && i < len(a) {
+			out = append(out, a[i])
+		}
+	}
+	return out
+}
+
+// jpWildcard selects all object members or array elements.
+type jpWildcard struct{}
+
+func (jpWildcard) selectFrom(root, v any, out []any) []any {
+	return append(out, jpChildren(v)...)
+}
+
+// jpSlice selects a range of array elements.
+type jpSlice struct {
+	start, end *int
+	step       int
+}
+
+func (s jpSlice) selectFrom(root, v any, out []any) []any {
+	a, ok := v.([]any)
+	if !ok || s.step == 0 {
+		return out
+	}
+	n := len(a)
+
+	// Normalize the bounds (as described in RFC 9535)
+	norm := func(i int) int {
+		if i < 0 {
+			return i + n
+		}
+		return i
+	}
+	clamp := func(i, lo, hi int) int {
+		if i < lo {
+			return lo
+		}
+		if i > hi {
+			return hi
+		}
+		return i
+	}
+
+	if s.step > 0 {
+		start, end := 0, n
+		if s.start != nil {
+			start = clamp(norm(*s.start), 0, n)
+		}
+		if s.end != nil {
+			end = clamp(norm(*s.end), 0, n)
+		}
+		for i := start; i < end; i += s.step {
+			out = append(out, a[i])
+		}
+		return out
+	}
+
+	start, end := n-1, -1
+	if s.start != nil {
+		start = clamp(norm(*s.start), -1, n-1)
+	}
+	if s.end != nil {
+		end = clamp(norm(*s.end), -1, n-1)
+	}
+	for i := start; i > end; i += s.step {
+		out = append(out, a[i])
+	}
+	return out
+}
+
+// jpFilter selects the object members or array elements for which
+// the filter expression is true.
+type jpFilter struct {
+	expr jpExpr
+}
+
+func (s jpFilter) selectFrom(root, v any, out []any) []any {
+	for _, c := range jpChildren(v) {
+		if s.expr.eval(root, c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// jpChildren returns the array elements or object member values
+// (sorted by key) of v.
+func jpChildren(v any) []any {
+	switch t := v.(type) {
+	case []any:
+		return t
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]any, len(keys))
+		for i, k := range keys {
+			out[i] = t[k]
+		}
+		return out
+	}
+	return nil
+}
+
+// jpDescendants returns v and all of its descendants (in document order).
+func jpDescendants(v any, out []any) []any {
+	out = append(out, v)
+	for _, c := range jpChildren(v) {
+		out = jpDescendants(c, out)
+	}
+	return out
+}
+
+// jpApply applies the segments segs to the value v.
+func jpApply(segs []jpSegment, root, v any) []any {
+	nodes := []any{v}
+	for _, seg := range segs {
+		// Get the list of values the selectors apply to
+		in := nodes
+		if seg.descendant {
+			in = nil
+			for _, n := range nodes {
+				in = jpDescendants(n, in)
+			}
+		}
+
+		// Apply the selectors
+		var out []any
+		for _, n := range in {
+			for _, s := range seg.sels {
+				out = s.selectFrom(root, n, out)
+			}
+		}
+		nodes = out
+	}
+	return nodes
+}
+
+// jpExpr is a logical expression in a filter.
+type jpExpr interface {
+	eval(root, cur any) bool
+}
+
+type jpOr struct{ a, b jpExpr }
+
+func (e jpOr) eval(root, cur any) bool { return e.a.eval(root, cur) || e.b.eval(root, cur) }
+
+type jpAnd struct{ a, b jpExpr }
+
+func (e jpAnd) eval(root, cur any) bool { return e.a.eval(root, cur) && e.b.eval(root, cur) }
+
+type jpNot struct{ e jpExpr }
+
+func (e jpNot) eval(root, cur any) bool { return !e.e.eval(root, cur) }
+
+// jpExists tests if a query selects any values.
+type jpExists struct{ q jpQuery }
+
+func (e jpExists) eval(root, cur any) bool { return len(e.q.nodes(root, cur)) > 0 }
+
+// jpCompare compares two operands.
+type jpCompare struct {
+	op   string
+	l, r jpOperand
+	re   *regexp.Regexp
+}
+
+func (e jpCompare) eval(root, cur any) bool {
+	lv, lok := e.l.value(root, cur)
+
+	// Regular expression match?
+	if e.op == "=~" {
+		s, ok := lv.(string)
+		return lok && ok && e.re.MatchString(s)
+	}
+
+	rv, rok := e.r.value(root, cur)
+	switch e.op {
+	case "==":
+		return jpEqual(lv, lok, rv, rok)
+	case "!=":
+		return !jpEqual(lv, lok, rv, rok)
+	case "<":
+		return jpLess(lv, lok, rv, rok)
+	case ">":
+		return jpLess(rv, rok, lv, lok)
+	case "<=":
+		return jpLess(lv, lok, rv, rok) || jpEqual(lv, lok, rv, rok)
+	case ">=":
+		return jpLess(rv, rok, lv, lok) || jpEqual(lv, lok, rv, rok)
+	}
+	return false
+}
+
+// jpEqual compares two (possibly missing) values for equality.
+func jpEqual(a any, aok bool, b any, bok bool) bool {
+	if !aok || !bok {
+		return aok == bok
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// jpLess reports if a < b. Only numbers and strings can be ordered.
+func jpLess(a any, aok bool, b any, bok bool) bool {
+	if !aok || !bok {
+		return false
+	}
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		return ok && x < y
+	case string:
+		y, ok := b.(string)
+		return ok && x < y
+	}
+	return false
+}
+
+// jpOperand is a value in a filter comparison.
+type jpOperand interface {
+	value(root, cur any) (any, bool)
+}
+
+// jpLiteral is a literal value.
+type jpLiteral struct{ v any }
+
+func (o jpLiteral) value(root, cur any) (any, bool) { return o.v, true }
+
+// jpQuery is an absolute ($) or relative (@) query in a filter.
+type jpQuery struct {
+	relative bool
+	segs     []jpSegment
+}
+
+func (q jpQuery) nodes(root, cur any) []any {
+	if q.relative {
+		return jpApply(q.segs, root, cur)
+	}
+	return jpApply(q.segs, root, root)
+}
+
+func (q jpQuery) value(root, cur any) (any, bool) {
+	ns := q.nodes(root, cur)
+	if len(ns) != 1 {
+		return nil, false
+	}
+	return ns[0], true
+}
+
+// jpParser is a recursive descent parser for JSONPath expressions.
+type jpParser struct {
+	s   string
+	pos int
+}
+
+func (p *jpParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jpParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *jpParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *jpParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(p.s[p.pos:], s)
+}
+
+func (p *jpParser) skipSpace() {
+	for !p.eof() && strings.IndexByte(" \t\n\r", p.peek()) >= 0 {
+		p.pos++
+	}
+}
+
+// parseRoot parses a full path, starting with "$".
+func (p *jpParser) parseRoot() ([]jpSegment, error) {
+	p.skipSpace()
+	if p.peek() != '$' {
+		return nil, p.errorf("expected path to start with '$'")
+	}
+	p.pos++
+	segs, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected character %q", p.peek())
+	}
+	return segs, nil
+}
+
+// parseSegments parses a list of segments.
+func (p *jpParser) parseSegments() ([]jpSegment, error) {
+	var segs []jpSegment
+	for {
+		switch {
+		case p.hasPrefix(".."):
+			p.pos += 2
+			seg, err := p.parseDotOrBracket()
+			if err != nil {
+				return nil, err
+			}
+			seg.descendant = true
+			segs = append(segs, seg)
+		case p.peek() == '.':
+			p.pos++
+			if p.peek() == '[' {
+				return nil, p.errorf("unexpected '[' after '.'")
+			}
+			seg, err := p.parseDotOrBracket()
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+		case p.peek() == '[':
+			seg, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+		default:
+			return segs, nil
+		}
+	}
+}
+
+// parseDotOrBracket parses the segment following a '.' or '..'.
+func (p *jpParser) parseDotOrBracket() (jpSegment, error) {
+	switch {
+	case p.peek() == '*':
+		p.pos++
+		return jpSegment{sels: []jpSelector{jpWildcard{}}}, nil
+	case p.peek() == '[':
+		return p.parseBracket()
+	}
+	name := p.parseName()
+	if name == "" {
+		return jpSegment{}, p.errorf("expected a member name")
+	}
+	return jpSegment{sels: []jpSelector{jpName(name)}}, nil
+}
+
+// parseName parses a member name shorthand (eg `.name`).
+func (p *jpParser) parseName() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '_' || c == '-' || c >= 0x80 ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') ||
+			(p.pos > start && '0' <= c && c <= '9') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.s[start:p.pos]
+}
+
+// parseBracket parses a bracketed list of selectors.
+func (p *jpParser) parseBracket() (jpSegment, error) {
+	p.pos++ // Skip '['
+	var seg jpSegment
+	for {
+		p.skipSpace()
+		sel, err := p.parseSelector()
+		if err != nil {
+			return seg, err
+		}
+		seg.sels = append(seg.sels, sel)
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return seg, nil
+		default:
+			return seg, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+// parseSelector parses a single selector inside brackets.
+func (p *jpParser) parseSelector() (jpSelector, error) {
+	c := p.peek()
+	switch {
+	case c == '*':
+		p.pos++
+		return jpWildcard{}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return jpName(s), nil
+	case c == '?':
+		p.pos++
+		p.skipSpace()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return jpFilter{e}, nil
+	case c == ':' || c == '-' || ('0' <= c && c <= '9'):
+		return p.parseIndexOrSlice()
+	}
+	return nil, p.errorf("unexpected character %q", c)
+}
+
+// parseInt parses an optional integer, returning nil if there isn't one.
+func (p *jpParser) parseInt() (*int, error) {
+	p.skipSpace()
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for !p.eof() && '0' <= p.peek() && p.peek() <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return nil, p.errorf("invalid integer %q", p.s[start:p.pos])
+	}
+	return &n, nil
+}
+
+// parseIndexOrSlice parses an index (eg `[1]`) or a slice (eg `[1:5:2]`).
+func (p *jpParser) parseIndexOrSlice() (jpSelector, error) {
+	start, err := p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() != ':' {
+		if start == nil {
+			return nil, p.errorf("expected an index")
+		}
+		return jpIndex(*start), nil
+	}
+
+	// It's a slice
+	p.pos++
+	s := jpSlice{start: start, step: 1}
+	if s.end, err = p.parseInt(); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() == ':' {
+		p.pos++
+		step, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		if step != nil {
+			s.step = *step
+		}
+	}
+	return s, nil
+}
+
+// parseString parses a single or double quoted string literal.
+func (p *jpParser) parseString() (string, error) {
+	q := p.peek()
+	p.pos++
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.s[p.pos]
+		switch c {
+		case q:
+			p.pos++
+			return sb.String(), nil
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			e := p.s[p.pos]
+			p.pos++
+			switch e {
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.s) {
+					return "", p.errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.s[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid unicode escape")
+				}
+				sb.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				sb.WriteByte(e)
+			}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseOr parses a logical-or expression.
+func (p *jpParser) parseOr() (jpExpr, error) {
+	a, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.hasPrefix("||") {
+			return a, nil
+		}
+		p.pos += 2
+		b, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		a = jpOr{a, b}
+	}
+}
+
+// parseAnd parses a logical-and expression.
+func (p *jpParser) parseAnd() (jpExpr, error) {
+	a, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.hasPrefix("&&") {
+			return a, nil
+		}
+		p.pos += 2
+		b, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		a = jpAnd{a, b}
+	}
+}
+
+// parseUnary parses a negation, parenthesized expression, comparison
+// or existence test.
+func (p *jpParser) parseUnary() (jpExpr, error) {
+	p.skipSpace()
+	switch {
+	case p.peek() == '!' && !p.hasPrefix("!="):
+		p.pos++
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return jpNot{e}, nil
+	case p.peek() == '(':
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.errorf("expected ')'")
+		}
+		p.pos++
+		return e, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses a comparison or existence test.
+func (p *jpParser) parseComparison() (jpExpr, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the operator (if there is one)
+	p.skipSpace()
+	var op string
+	for _, o := range []string{"==", "!=", "<=", ">=", "=~", "<", ">"} {
+		if p.hasPrefix(o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		// Existence test
+		q, ok := l.(jpQuery)
+		if !ok {
+			return nil, p.errorf("expected a comparison operator")
+		}
+		return jpExists{q}, nil
+	}
+	p.pos += len(op)
+	p.skipSpace()
+
+	// Regular expression?
+	if op == "=~" {
+		re, err := p.parseRegexp()
+		if err != nil {
+			return nil, err
+		}
+		return jpCompare{op: op, l: l, re: re}, nil
+	}
+
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return jpCompare{op: op, l: l, r: r}, nil
+}
+
+// parseRegexp parses a regular expression literal (eg `/^a.*/i`) or
+// a string containing a regular expression.
+func (p *jpParser) parseRegexp() (*regexp.Regexp, error) {
+	var pattern string
+	switch p.peek() {
+	case '\'', '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		pattern = s
+	case '/':
+		p.pos++
+		var sb strings.Builder
+		for {
+			if p.eof() {
+				return nil, p.errorf("unterminated regular expression")
+			}
+			c := p.s[p.pos]
+			p.pos++
+			if c == '/' {
+				break
+			}
+			if c == '\\' && p.peek() == '/' {
+				c = '/'
+				p.pos++
+			}
+			sb.WriteByte(c)
+		}
+		pattern = sb.String()
+		if p.peek() == 'i' {
+			p.pos++
+			pattern = "(?i)" + pattern
+		}
+	default:
+		return nil, p.errorf("expected a regular expression")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, p.errorf("invalid regular expression: %s", err)
+	}
+	return re, nil
+}
+
+// parseOperand parses a literal or a query.
+func (p *jpParser) parseOperand() (jpOperand, error) {
+	p.skipSpace()
+	c := p.peek()
+	switch {
+	case c == '@' || c == '$':
+		p.pos++
+		segs, err := p.parseSegments()
+		if err != nil {
+			return nil, err
+		}
+		return jpQuery{relative: c == '@', segs: segs}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return jpLiteral{s}, nil
+	case c == '-' || ('0' <= c && c <= '9'):
+		start := p.pos
+		p.pos++
+		for !p.eof() && strings.IndexByte("0123456789.eE+-", p.peek()) >= 0 {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil || math.IsInf(f, 0) {
+			return nil, p.errorf("invalid number %q", p.s[start:p.pos])
+		}
+		return jpLiteral{f}, nil
+	}
+	for _, lit := range []struct {
+		s string
+		v any
+	}{{"true", true}, {"false", false}, {"null", nil}} {
+		if p.hasPrefix(lit.s) {
+			p.pos += len(lit.s)
+			return jpLiteral{lit.v}, nil
+		}
+	}
+	return nil, p.errorf("unexpected character %q", c)
+}
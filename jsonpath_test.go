@@ -0,0 +1,271 @@
+package vhttp_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+// jsonPathDoc is a sample document used by the JSONPath tests.
+const jsonPathDoc = `{
+	"store": {
+		"book": [
+			{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+			{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+			{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+			{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+		],
+		"bicycle": {"color": "red", "price": 399}
+	},
+	"data": {"items": [{"id": "a1"}, {"id": "b2"}], "empty": [], "flag": true, "none": null}
+}`
+
+func TestJSONPathSelect(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(jsonPathDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path   string // JSONPath expression
+		expect []any  // Expected values selected
+	}{
+		{
+			path:   "$.store.bicycle.color",
+			expect: []any{"red"},
+		},
+		{
+			path:   "$['store']['bicycle']['color']",
+			expect: []any{"red"},
+		},
+		{
+			path:   "$.store.book[*].author",
+			expect: []any{"Nigel Rees", "Evelyn Waugh", "Herman Melville", "J. R. R. Tolkien"},
+		},
+		{
+			path:   "$..author",
+			expect: []any{"Nigel Rees", "Evelyn Waugh", "Herman Melville", "J. R. R. Tolkien"},
+		},
+		{
+			path:   "$.store.book[-1].title",
+			expect: []any{"The Lord of the Rings"},
+		},
+		{
+			path:   "$.store.book[0,1].price",
+			expect: []any{8.95, 12.99},
+		},
+		{
+			path:   "$.store.book[:2].price",
+			expect: []any{8.95, 12.99},
+		},
+		{
+			path:   "$.store.book[1:4:2].price",
+			expect: []any{12.99, 22.99},
+		},
+		{
+			path:   "$.store.book[::-1].price",
+			expect: []any{22.99, 8.99, 12.99, 8.95},
+		},
+		{
+			path:   "$.store.book[?(@.isbn)].title",
+			expect: []any{"Moby Dick", "The Lord of the Rings"},
+		},
+		{
+			path:   "$.store.book[?(@.price < 10)].title",
+			expect: []any{"Sayings of the Century", "Moby Dick"},
+		},
+		{
+			path:   "$.store.book[?@.category == 'fiction' && @.price >= 20].title",
+			expect: []any{"The Lord of the Rings"},
+		},
+		{
+			path:   "$.store.book[?(@.author =~ /^h/i || !@.isbn)].title",
+			expect: []any{"Sayings of the Century", "Sword of Honour", "Moby Dick"},
+		},
+		{
+			path:   "$.store.book[?(@.price > $.store.bicycle.price)]",
+			expect: nil,
+		},
+		{
+			path:   "$..book[2].isbn",
+			expect: []any{"0-553-21311-3"},
+		},
+		{
+			path:   "$.store.bicycle.*",
+			expect: []any{"red", float64(399)},
+		},
+		{
+			path:   "$.missing",
+			expect: nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			p, err := vhttp.CompileJSONPath(c.path)
+			if err != nil {
+				t.Fatalf("unexpected error compiling path: %s", err)
+			}
+			got := p.Select(doc)
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("expected %v, got %v", c.expect, got)
+			}
+		})
+	}
+}
+
+func TestCompileJSONPath(t *testing.T) {
+	cases := []struct {
+		path  string // JSONPath expression
+		isErr bool   // Should an error be returned
+	}{
+		{path: "$", isErr: false},
+		{path: "$.a.b[0]['c d']", isErr: false},
+		{path: "$[?(@.a == \"x\")]", isErr: false},
+		{path: "a.b", isErr: true},
+		{path: "$.", isErr: true},
+		{path: "$[", isErr: true},
+		{path: "$['abc]", isErr: true},
+		{path: "$[?(@.a ==)]", isErr: true},
+		{path: "$[?(@.a =~ /(/)]", isErr: true},
+		{path: "$.a]", isErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			_, err := vhttp.CompileJSONPath(c.path)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+}
+
+func TestJSONPathValidators(t *testing.T) {
+	cases := []struct {
+		name     string              // Case name
+		v        vhttp.BodyValidator // Validator to run
+		isErr    bool                // Should an error be returned
+		contains []string            // Strings the error message should contain
+	}{
+		{
+			name:  "exists",
+			v:     vhttp.JSONPathExists("$.data.items[0].id"),
+			isErr: false,
+		},
+		{
+			name:     "exists-missing",
+			v:        vhttp.JSONPathExists("$.data.items[5].id"),
+			isErr:    true,
+			contains: []string{"$.data.items[5].id"},
+		},
+		{
+			name:  "exists-null",
+			v:     vhttp.JSONPathExists("$.data.none"),
+			isErr: false,
+		},
+		{
+			name:  "equals-string",
+			v:     vhttp.JSONPathEquals("$.store.bicycle.color", "red"),
+			isErr: false,
+		},
+		{
+			name:  "equals-number",
+			v:     vhttp.JSONPathEquals("$.store.bicycle.price", 399),
+			isErr: false,
+		},
+		{
+			name:  "equals-object",
+			v:     vhttp.JSONPathEquals("$.data.items[1]", map[string]string{"id": "b2"}),
+			isErr: false,
+		},
+		{
+			name:     "equals-mismatch",
+			v:        vhttp.JSONPathEquals("$.store.bicycle.price", 400),
+			isErr:    true,
+			contains: []string{"$.store.bicycle.price", "400", "399"},
+		},
+		{
+			name:  "matches",
+			v:     vhttp.JSONPathMatches("$.data.items[*].id", regexp.MustCompile(`^[a-z]\d$`)),
+			isErr: false,
+		},
+		{
+			name:     "matches-mismatch",
+			v:        vhttp.JSONPathMatches("$.store.book[*].author", regexp.MustCompile(`^N`)),
+			isErr:    true,
+			contains: []string{`"Evelyn Waugh"`},
+		},
+		{
+			name:  "len-array",
+			v:     vhttp.JSONPathLen("$.store.book", 4),
+			isErr: false,
+		},
+		{
+			name:  "len-empty",
+			v:     vhttp.JSONPathLen("$.data.empty", 0),
+			isErr: false,
+		},
+		{
+			name:     "len-mismatch",
+			v:        vhttp.JSONPathLen("$.data.items", 3),
+			isErr:    true,
+			contains: []string{"$.data.items", "length 2"},
+		},
+		{
+			name:  "len-bad-type",
+			v:     vhttp.JSONPathLen("$.data.flag", 1),
+			isErr: true,
+		},
+		{
+			name:  "type",
+			v:     vhttp.JSONPathType("$.data.flag", vhttp.JSONTypeBoolean),
+			isErr: false,
+		},
+		{
+			name:  "type-null",
+			v:     vhttp.JSONPathType("$.data.none", vhttp.JSONTypeNull),
+			isErr: false,
+		},
+		{
+			name:     "type-mismatch",
+			v:        vhttp.JSONPathType("$.store.bicycle", vhttp.JSONTypeArray),
+			isErr:    true,
+			contains: []string{"object"},
+		},
+		{
+			name:  "invalid-path",
+			v:     vhttp.JSONPathExists("store"),
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.v([]byte(jsonPathDoc))
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+				return
+			}
+			for _, s := range c.contains {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("expected error %q to contain %q", err, s)
+				}
+			}
+		})
+	}
+
+	t.Run("invalid-json", func(t *testing.T) {
+		if err := vhttp.JSONPathExists("$")([]byte(`{{`)); err == nil {
+			t.Errorf("expected an error to be returned")
+		}
+	})
+}
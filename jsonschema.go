@@ -0,0 +1,1333 @@
+package vhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// JSONSchema is a compiled JSON Schema (draft 2020-12 or draft-07) that can
+// be used to validate decoded JSON values or (with BodyMatchesJSONSchema)
+// request and response bodies.
+//
+// The draft is chosen based on the schema's "$schema" keyword. Schemas that
+// reference draft-04, draft-06 or draft-07 use draft-07 semantics, everything
+// else uses draft 2020-12.
+//
+// References ("$ref") are resolved against the schema's base URI. Schemas
+// loaded with LoadJSONSchemaFile or LoadJSONSchemaFS can reference other
+// local files (eg `"$ref": "common.json#/$defs/id"`). Remote references
+// are not fetched.
+//
+// The "format" keyword is treated as an assertion for the formats
+// date-time, date, time, email, hostname, ipv4, ipv6, uri, uri-reference,
+// uuid and regex. Other formats are ignored.
+type JSONSchema struct {
+	s *jsSchema
+}
+
+// CompileJSONSchema compiles the JSON Schema document b.
+//
+// Since the schema isn't loaded from a file system, it can only
+// reference itself (or any schemas embedded in it with "$id").
+func CompileJSONSchema(b []byte) (*JSONSchema, error) {
+	return compileJSONSchema(nil, "schema.json", b)
+}
+
+// LoadJSONSchemaFile loads and compiles the JSON Schema document in the file
+// at name. References to other files are resolved relative to it, and can't
+// point above its directory (eg "../common.json"). To reference schemas in
+// a parent directory, use LoadJSONSchemaFS with a file system rooted there.
+func LoadJSONSchemaFile(name string) (*JSONSchema, error) {
+	dir, file := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	return LoadJSONSchemaFS(os.DirFS(dir), file)
+}
+
+// LoadJSONSchemaFS loads and compiles the JSON Schema document at name in
+// the file system fsys. References to other files are resolved relative to
+// it and loaded from fsys. References that point above the root of fsys
+// result in an error.
+func LoadJSONSchemaFS(fsys fs.FS, name string) (*JSONSchema, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON schema: %w", err)
+	}
+	return compileJSONSchema(fsys, name, b)
+}
+
+// MustCompileJSONSchema is like CompileJSONSchema but panics if the
+// schema can't be compiled.
+func MustCompileJSONSchema(b []byte) *JSONSchema {
+	s, err := CompileJSONSchema(b)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// compileJSONSchema decodes and compiles the root schema document b.
+func compileJSONSchema(fsys fs.FS, name string, b []byte) (*JSONSchema, error) {
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+	}
+
+	c := newJSCompiler(fsys)
+	uri := jsFileURI(name)
+	c.addDocument(uri, doc)
+	s, err := c.compileRef(uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkCycles(s); err != nil {
+		return nil, err
+	}
+	return &JSONSchema{s}, nil
+}
+
+// Validate validates the decoded JSON value v (as returned by json.Unmarshal
+// into an `any` value) against the schema.
+//
+// If v is invalid, the error returned is a *multierror.Error containing one
+// JSONSchemaError for each violated keyword.
+func (s *JSONSchema) Validate(v any) error {
+	errs, _ := s.s.validate(v, "")
+	if len(errs) == 0 {
+		return nil
+	}
+	var merr *multierror.Error
+	for _, err := range errs {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+// BodyMatchesJSONSchema creates a BodyValidator that checks that the body
+// is valid JSON and that it's valid according to the JSON Schema s.
+//
+// A ValidationError (wrapping a JSONSchemaError) is returned for each
+// violated keyword.
+//
+//	schema, err := vhttp.LoadJSONSchemaFile("testdata/user.schema.json")
+//	if err != nil {
+//		// ...
+//	}
+//	v := vhttp.BodyMatchesJSONSchema(schema)
+func BodyMatchesJSONSchema(s *JSONSchema) BodyValidator {
+	return func(b []byte) error {
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return &ValidationError{
+				Target:    "body",
+				Validator: "BodyMatchesJSONSchema",
+				Code:      CodeInvalid,
+				Message:   fmt.Sprintf("body is not valid JSON: %s", err),
+				Err:       err,
+			}
+		}
+		return schemaValidationErrors("body", "BodyMatchesJSONSchema", "", s.s, v)
+	}
+}
+
+// schemaValidationErrors validates v against the schema s and returns a
+// ValidationError for each violated keyword. Each error's target is the
+// given target followed by the JSON Pointer of the invalid value (eg
+// "body#/name") and its message is prefixed with prefix.
+func schemaValidationErrors(target, validator, prefix string, s *jsSchema, v any) error {
+	errs, _ := s.validate(v, "")
+	if len(errs) == 0 {
+		return nil
+	}
+	var merr *multierror.Error
+	for _, e := range errs {
+		merr = multierror.Append(merr, &ValidationError{
+			Target:    target + "#" + e.InstancePath,
+			Validator: validator,
+			Code:      CodeSchema,
+			Expected:  e.Keyword,
+			Message:   prefix + e.Error(),
+			Err:       e,
+		})
+	}
+	return merr
+}
+
+// JSONSchemaError describes a single JSON Schema keyword that a value
+// failed to validate against.
+type JSONSchemaError struct {
+	// InstancePath is the JSON Pointer (RFC 6901) of the invalid value
+	// within the validated document. The root value is "".
+	InstancePath string
+
+	// Keyword is the JSON Schema keyword that failed (eg "minimum").
+	Keyword string
+
+	// Message describes the failure.
+	Message string
+}
+
+func (e JSONSchemaError) Error() string {
+	return fmt.Sprintf("JSON schema violation at %q (%s): %s", e.InstancePath, e.Keyword, e.Message)
+}
+
+// jsSchema is a compiled schema (or subschema).
+type jsSchema struct {
+	loc    string // The schema's document URI and JSON Pointer
+	always *bool  // Set for the boolean schemas `true` and `false`
+
+	ref     *jsSchema
+	refOnly bool // draft-07: siblings of "$ref" are ignored
+
+	types    []string
+	nullable bool // OpenAPI 3.0's "nullable" keyword
+	enum     []any
+	hasEnum  bool
+	constVal any
+	hasConst bool
+
+	multipleOf       *float64
+	maximum          *float64
+	minimum          *float64
+	exclusiveMaximum *float64
+	exclusiveMinimum *float64
+
+	maxLength *int
+	minLength *int
+	pattern   *regexp.Regexp
+	format    string
+
+	prefixItems      []*jsSchema
+	prefixItemsKw    string // "prefixItems" (or draft-07's "items")
+	items            *jsSchema
+	itemsKw          string // "items" (or draft-07's "additionalItems")
+	contains         *jsSchema
+	minContains      *int
+	maxContains      *int
+	maxItems         *int
+	minItems         *int
+	uniqueItems      bool
+	unevaluatedItems *jsSchema
+
+	maxProperties         *int
+	minProperties         *int
+	required              []string
+	properties            map[string]*jsSchema
+	patternProperties     []jsPatternSchema
+	additionalProperties  *jsSchema
+	propertyNames         *jsSchema
+	dependentRequired     map[string][]string
+	dependentSchemas      map[string]*jsSchema
+	dependencies          map[string]bool // Keys from draft-07's "dependencies"
+	unevaluatedProperties *jsSchema
+
+	ifSchema   *jsSchema
+	thenSchema *jsSchema
+	elseSchema *jsSchema
+	allOf      []*jsSchema
+	anyOf      []*jsSchema
+	oneOf      []*jsSchema
+	not        *jsSchema
+}
+
+// jsPatternSchema is an entry in "patternProperties".
+type jsPatternSchema struct {
+	re *regexp.Regexp
+	s  *jsSchema
+}
+
+// jsResource is a schema resource (a document or a subschema with an
+// "$id") or an anchor that can be the target of a reference.
+type jsResource struct {
+	doc    string // URI of the document containing the resource
+	ptr    string // JSON Pointer to the resource within the document
+	node   any    // The resource's schema
+	draft7 bool   // Does the resource use draft-07 semantics?
+}
+
+// jsCompiler loads and compiles schema documents.
+type jsCompiler struct {
+	fsys      fs.FS
+	resources map[string]jsResource // Keyed by absolute URI (without a fragment)
+	anchors   map[string]jsResource // Keyed by absolute URI (with an anchor fragment)
+	schemas   map[string]*jsSchema  // Keyed by document URI and JSON Pointer
+	openAPI30 bool                  // Use OpenAPI 3.0 schema object semantics?
+
+	// Schemas that have been checked for reference cycles
+	checked map[*jsSchema]bool
+}
+
+func newJSCompiler(fsys fs.FS) *jsCompiler {
+	return &jsCompiler{
+		fsys:      fsys,
+		resources: make(map[string]jsResource),
+		anchors:   make(map[string]jsResource),
+		schemas:   make(map[string]*jsSchema),
+		checked:   make(map[*jsSchema]bool),
+	}
+}
+
+// jsFileURI returns the URI used to identify the schema document at
+// name (a slash-separated path).
+func jsFileURI(name string) string {
+	return "file:///" + strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// errJSAboveRoot is returned when a reference to a local file points
+// above the root of the file system it's loaded from.
+var errJSAboveRoot = errors.New("reference points above the root of the schema file system")
+
+// jsResolve resolves the reference ref against the base URI.
+//
+// For a local file (a "file" URI), a relative path that climbs above the
+// root returns errJSAboveRoot, rather than being clamped to it.
+func jsResolve(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if b.Scheme == "file" && r.Scheme == "" && r.Host == "" && r.Path != "" && !strings.HasPrefix(r.Path, "/") {
+		rel := path.Join(path.Dir(strings.TrimPrefix(b.Path, "/")), r.Path)
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return "", errJSAboveRoot
+		}
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+// jsSplitFragment splits a URI into the part before the fragment and the
+// (unescaped) fragment.
+func jsSplitFragment(uri string) (string, string) {
+	u, frag, _ := strings.Cut(uri, "#")
+	if f, err := url.PathUnescape(frag); err == nil {
+		frag = f
+	}
+	return u, frag
+}
+
+// jsIsDraft7 reports if the "$schema" URI refers to draft-07 (or earlier).
+func jsIsDraft7(schema string) bool {
+	return strings.Contains(schema, "draft-04") ||
+		strings.Contains(schema, "draft-06") ||
+		strings.Contains(schema, "draft-07")
+}
+
+// addDocument registers the decoded schema document doc under uri and
+// indexes any embedded resources and anchors.
+func (c *jsCompiler) addDocument(uri string, doc any) {
+	c.resources[uri] = jsResource{doc: uri, node: doc}
+	c.index(uri, uri, "", doc, false)
+}
+
+// index walks the schema node, recording any "$id"s and anchors.
+func (c *jsCompiler) index(doc, base, ptr string, node any, draft7 bool) {
+	m, ok := node.(map[string]any)
+	if !ok {
+		return
+	}
+
+	// Get the draft
+	if s, ok := m["$schema"].(string); ok {
+		draft7 = jsIsDraft7(s)
+	}
+	if ptr == "" {
+		r := c.resources[doc]
+		r.draft7 = draft7
+		c.resources[doc] = r
+	}
+
+	// Record the resource (and anchors)
+	res := jsResource{doc: doc, ptr: ptr, node: node, draft7: draft7}
+	if id, ok := m["$id"].(string); ok {
+		if abs, err := jsResolve(base, id); err == nil {
+			u, frag := jsSplitFragment(abs)
+			if frag != "" && draft7 {
+				c.anchors[u+"#"+frag] = res // draft-07 style anchor (eg "#foo")
+			} else {
+				base = u
+				c.resources[u] = res
+			}
+		}
+	}
+	for _, k := range []string{"$anchor", "$dynamicAnchor"} {
+		if a, ok := m[k].(string); ok {
+			c.anchors[base+"#"+a] = res
+		}
+	}
+
+	// Walk the subschemas
+	jsWalkSubschemas(m, ptr, func(p string, n any) {
+		c.index(doc, base, p, n, draft7)
+	})
+}
+
+// jsWalkSubschemas calls fn with the JSON Pointer and value of each
+// subschema of the schema object m.
+func jsWalkSubschemas(m map[string]any, ptr string, fn func(string, any)) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := ptr + "/" + jsEscapePointer(k)
+		switch k {
+		case "additionalProperties", "additionalItems", "contains", "propertyNames",
+			"if", "then", "else", "not", "unevaluatedItems", "unevaluatedProperties":
+			fn(p, m[k])
+		case "items":
+			if a, ok := m[k].([]any); ok {
+				for i, n := range a {
+					fn(p+"/"+strconv.Itoa(i), n)
+				}
+			} else {
+				fn(p, m[k])
+			}
+		case "allOf", "anyOf", "oneOf", "prefixItems":
+			if a, ok := m[k].([]any); ok {
+				for i, n := range a {
+					fn(p+"/"+strconv.Itoa(i), n)
+				}
+			}
+		case "properties", "patternProperties", "$defs", "definitions", "dependentSchemas", "dependencies":
+			if sm, ok := m[k].(map[string]any); ok {
+				names := make([]string, 0, len(sm))
+				for name := range sm {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					if _, isArr := sm[name].([]any); !isArr {
+						fn(p+"/"+jsEscapePointer(name), sm[name])
+					}
+				}
+			}
+		}
+	}
+}
+
+// jsEscapePointer escapes a JSON Pointer reference token.
+func jsEscapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// jsUnescapePointer unescapes a JSON Pointer reference token.
+func jsUnescapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+// jsPointerGet returns the value at the JSON Pointer ptr in v.
+func jsPointerGet(v any, ptr string) (any, error) {
+	if ptr == "" {
+		return v, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", ptr)
+	}
+	for _, tok := range strings.Split(ptr[1:], "/") {
+		tok = jsUnescapePointer(tok)
+		switch t := v.(type) {
+		case map[string]any:
+			c, ok := t[tok]
+			if !ok {
+				return nil, fmt.Errorf("JSON pointer %q not found", ptr)
+			}
+			v = c
+		case []any:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, fmt.Errorf("JSON pointer %q not found", ptr)
+			}
+			v = t[i]
+		default:
+			return nil, fmt.Errorf("JSON pointer %q not found", ptr)
+		}
+	}
+	return v, nil
+}
+
+// loadDocument loads the schema document with the given URI from the
+// compiler's file system.
+func (c *jsCompiler) loadDocument(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || c.fsys == nil {
+		return fmt.Errorf("can't load remote schema %q", uri)
+	}
+	b, err := fs.ReadFile(c.fsys, strings.TrimPrefix(u.Path, "/"))
+	if err != nil {
+		return fmt.Errorf("failed to load schema %q: %w", uri, err)
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("failed to parse schema %q: %w", uri, err)
+	}
+	c.addDocument(uri, doc)
+	return nil
+}
+
+// compileRef compiles the schema identified by the absolute URI ref.
+func (c *jsCompiler) compileRef(ref string) (*jsSchema, error) {
+	u, frag := jsSplitFragment(ref)
+
+	// Find the resource (loading it, if necessary)
+	res, ok := c.resources[u]
+	if !ok {
+		if err := c.loadDocument(u); err != nil {
+			return nil, fmt.Errorf("unresolvable $ref %q: %w", ref, err)
+		}
+		res = c.resources[u]
+	}
+
+	// Is it an anchor?
+	if frag != "" && !strings.HasPrefix(frag, "/") {
+		a, ok := c.anchors[u+"#"+frag]
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q: anchor not found", ref)
+		}
+		return c.compile(a.doc, a.ptr, a.node, u, a.draft7)
+	}
+
+	// Otherwise, it's a JSON Pointer
+	node, err := jsPointerGet(res.node, frag)
+	if err != nil {
+		return nil, fmt.Errorf("unresolvable $ref %q: %w", ref, err)
+	}
+	return c.compile(res.doc, res.ptr+frag, node, u, res.draft7)
+}
+
+// compile compiles the schema node, located at the JSON Pointer ptr in the
+// document doc. The URI base is used to resolve references.
+func (c *jsCompiler) compile(doc, ptr string, node any, base string, draft7 bool) (*jsSchema, error) {
+	// Already compiled? (This also handles recursive references.)
+	key := doc + "#" + ptr
+	if s, ok := c.schemas[key]; ok {
+		return s, nil
+	}
+	s := &jsSchema{loc: key}
+	c.schemas[key] = s
+
+	// Boolean schema?
+	if b, ok := node.(bool); ok {
+		s.always = &b
+		return s, nil
+	}
+	m, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid schema at %q: expected an object or boolean", key)
+	}
+
+	// Update the draft and base URI
+	if sch, ok := m["$schema"].(string); ok {
+		draft7 = jsIsDraft7(sch)
+	}
+	if id, ok := m["$id"].(string); ok {
+		if abs, err := jsResolve(base, id); err == nil {
+			if u, frag := jsSplitFragment(abs); frag == "" || !draft7 {
+				base = u
+			}
+		}
+	}
+
+	// Helper functions for compiling subschemas
+	var cerr error
+	sub := func(name string, n any) *jsSchema {
+		if cerr != nil {
+			return nil
+		}
+		var cs *jsSchema
+		cs, cerr = c.compile(doc, ptr+"/"+name, n, base, draft7)
+		return cs
+	}
+	subList := func(name string, n any) []*jsSchema {
+		a, ok := n.([]any)
+		if !ok {
+			cerr = fmt.Errorf("invalid schema at %q: expected %q to be an array", key, name)
+			return nil
+		}
+		ss := make([]*jsSchema, len(a))
+		for i, n := range a {
+			ss[i] = sub(name+"/"+strconv.Itoa(i), n)
+		}
+		return ss
+	}
+	subMap := func(name string, n any) map[string]*jsSchema {
+		sm, ok := n.(map[string]any)
+		if !ok {
+			cerr = fmt.Errorf("invalid schema at %q: expected %q to be an object", key, name)
+			return nil
+		}
+		out := make(map[string]*jsSchema, len(sm))
+		for k, n := range sm {
+			out[k] = sub(name+"/"+jsEscapePointer(k), n)
+		}
+		return out
+	}
+	num := func(name string) *float64 {
+		if f, ok := m[name].(float64); ok {
+			return &f
+		}
+		return nil
+	}
+	integer := func(name string) *int {
+		if f, ok := m[name].(float64); ok {
+			i := int(f)
+			return &i
+		}
+		return nil
+	}
+
+	// References
+	for _, k := range []string{"$ref", "$dynamicRef"} {
+		ref, ok := m[k].(string)
+		if !ok {
+			continue
+		}
+		abs, err := jsResolve(base, ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $ref %q at %q: %w", ref, key, err)
+		}
+		if s.ref, err = c.compileRef(abs); err != nil {
+			return nil, err
+		}
+		if draft7 || c.openAPI30 {
+			s.refOnly = true
+			return s, nil
+		}
+	}
+
+	// Type keywords
+	switch t := m["type"].(type) {
+	case string:
+		s.types = []string{t}
+	case []any:
+		for _, v := range t {
+			if ts, ok := v.(string); ok {
+				s.types = append(s.types, ts)
+			}
+		}
+	}
+	if c.openAPI30 {
+		s.nullable, _ = m["nullable"].(bool)
+	}
+	if e, ok := m["enum"].([]any); ok {
+		s.enum, s.hasEnum = e, true
+	}
+	if cv, ok := m["const"]; ok {
+		s.constVal, s.hasConst = cv, true
+	}
+
+	// Numeric keywords
+	s.multipleOf = num("multipleOf")
+	s.maximum = num("maximum")
+	s.minimum = num("minimum")
+	s.exclusiveMaximum = num("exclusiveMaximum")
+	s.exclusiveMinimum = num("exclusiveMinimum")
+	if b, _ := m["exclusiveMaximum"].(bool); b { // draft-04 / OpenAPI 3.0
+		s.exclusiveMaximum, s.maximum = s.maximum, nil
+	}
+	if b, _ := m["exclusiveMinimum"].(bool); b {
+		s.exclusiveMinimum, s.minimum = s.minimum, nil
+	}
+
+	// String keywords
+	s.maxLength = integer("maxLength")
+	s.minLength = integer("minLength")
+	if p, ok := m["pattern"].(string); ok {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q at %q: %w", p, key, err)
+		}
+		s.pattern = re
+	}
+	s.format, _ = m["format"].(string)
+
+	// Array keywords
+	if n, ok := m["prefixItems"]; ok {
+		s.prefixItems, s.prefixItemsKw = subList("prefixItems", n), "prefixItems"
+	}
+	if n, ok := m["items"]; ok {
+		if _, isArr := n.([]any); isArr {
+			// draft-07 tuple validation
+			s.prefixItems, s.prefixItemsKw = subList("items", n), "items"
+			if n, ok := m["additionalItems"]; ok {
+				s.items, s.itemsKw = sub("additionalItems", n), "additionalItems"
+			}
+		} else {
+			s.items, s.itemsKw = sub("items", n), "items"
+		}
+	}
+	if n, ok := m["contains"]; ok {
+		s.contains = sub("contains", n)
+	}
+	s.minContains = integer("minContains")
+	s.maxContains = integer("maxContains")
+	s.maxItems = integer("maxItems")
+	s.minItems = integer("minItems")
+	s.uniqueItems, _ = m["uniqueItems"].(bool)
+	if n, ok := m["unevaluatedItems"]; ok {
+		s.unevaluatedItems = sub("unevaluatedItems", n)
+	}
+
+	// Object keywords
+	s.maxProperties = integer("maxProperties")
+	s.minProperties = integer("minProperties")
+	if r, ok := m["required"].([]any); ok {
+		for _, v := range r {
+			if rs, ok := v.(string); ok {
+				s.required = append(s.required, rs)
+			}
+		}
+	}
+	if n, ok := m["properties"]; ok {
+		s.properties = subMap("properties", n)
+	}
+	if n, ok := m["patternProperties"]; ok {
+		pm := subMap("patternProperties", n)
+		pats := make([]string, 0, len(pm))
+		for p := range pm {
+			pats = append(pats, p)
+		}
+		sort.Strings(pats)
+		for _, p := range pats {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q at %q: %w", p, key, err)
+			}
+			s.patternProperties = append(s.patternProperties, jsPatternSchema{re, pm[p]})
+		}
+	}
+	if n, ok := m["additionalProperties"]; ok {
+		s.additionalProperties = sub("additionalProperties", n)
+	}
+	if n, ok := m["propertyNames"]; ok {
+		s.propertyNames = sub("propertyNames", n)
+	}
+	if dr, ok := m["dependentRequired"].(map[string]any); ok {
+		s.dependentRequired = jsStringLists(dr)
+	}
+	if n, ok := m["dependentSchemas"]; ok {
+		s.dependentSchemas = subMap("dependentSchemas", n)
+	}
+	if deps, ok := m["dependencies"].(map[string]any); ok { // draft-07
+		s.dependencies = make(map[string]bool, len(deps))
+		for k, v := range deps {
+			s.dependencies[k] = true
+			if _, isArr := v.([]any); isArr {
+				if s.dependentRequired == nil {
+					s.dependentRequired = make(map[string][]string)
+				}
+				s.dependentRequired[k] = jsStringLists(map[string]any{k: v})[k]
+				continue
+			}
+			if s.dependentSchemas == nil {
+				s.dependentSchemas = make(map[string]*jsSchema)
+			}
+			s.dependentSchemas[k] = sub("dependencies/"+jsEscapePointer(k), v)
+		}
+	}
+	if n, ok := m["unevaluatedProperties"]; ok {
+		s.unevaluatedProperties = sub("unevaluatedProperties", n)
+	}
+
+	// Applicators
+	if n, ok := m["if"]; ok {
+		s.ifSchema = sub("if", n)
+		if n, ok := m["then"]; ok {
+			s.thenSchema = sub("then", n)
+		}
+		if n, ok := m["else"]; ok {
+			s.elseSchema = sub("else", n)
+		}
+	}
+	if n, ok := m["allOf"]; ok {
+		s.allOf = subList("allOf", n)
+	}
+	if n, ok := m["anyOf"]; ok {
+		s.anyOf = subList("anyOf", n)
+	}
+	if n, ok := m["oneOf"]; ok {
+		s.oneOf = subList("oneOf", n)
+	}
+	if n, ok := m["not"]; ok {
+		s.not = sub("not", n)
+	}
+
+	if cerr != nil {
+		return nil, cerr
+	}
+	return s, nil
+}
+
+// jsStringLists converts a map of string arrays.
+func jsStringLists(m map[string]any) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		a, _ := v.([]any)
+		for _, s := range a {
+			if str, ok := s.(string); ok {
+				out[k] = append(out[k], str)
+			}
+		}
+	}
+	return out
+}
+
+// jsAnnotations tracks the object properties and array items that have been
+// evaluated by a schema, for use by "unevaluatedProperties" and
+// "unevaluatedItems".
+type jsAnnotations struct {
+	props map[string]bool
+	items map[int]bool
+}
+
+func (a *jsAnnotations) merge(b *jsAnnotations) {
+	if b == nil {
+		return
+	}
+	for k := range b.props {
+		if a.props == nil {
+			a.props = make(map[string]bool)
+		}
+		a.props[k] = true
+	}
+	for i := range b.items {
+		if a.items == nil {
+			a.items = make(map[int]bool)
+		}
+		a.items[i] = true
+	}
+}
+
+func (a *jsAnnotations) prop(k string) {
+	if a.props == nil {
+		a.props = make(map[string]bool)
+	}
+	a.props[k] = true
+}
+
+func (a *jsAnnotations) item(i int) {
+	if a.items == nil {
+		a.items = make(map[int]bool)
+	}
+	a.items[i] = true
+}
+
+// inPlace returns the subschemas that s applies to the same instance
+// location as itself: its reference and in-place applicators.
+func (s *jsSchema) inPlace() []*jsSchema {
+	ss := []*jsSchema{s.ref, s.ifSchema, s.thenSchema, s.elseSchema, s.not}
+	ss = append(ss, s.allOf...)
+	ss = append(ss, s.anyOf...)
+	ss = append(ss, s.oneOf...)
+	for _, k := range jsSortedKeys(s.dependentSchemas) {
+		ss = append(ss, s.dependentSchemas[k])
+	}
+	return ss
+}
+
+// subschemas returns all of the subschemas of s.
+func (s *jsSchema) subschemas() []*jsSchema {
+	ss := append(s.inPlace(), s.prefixItems...)
+	ss = append(ss, s.items, s.contains, s.unevaluatedItems, s.additionalProperties, s.propertyNames, s.unevaluatedProperties)
+	for _, k := range jsSortedKeys(s.properties) {
+		ss = append(ss, s.properties[k])
+	}
+	for _, pp := range s.patternProperties {
+		ss = append(ss, pp.s)
+	}
+	return ss
+}
+
+// checkCycles checks that the schema s (and the schemas it references)
+// can't apply themselves to the same instance location, which would
+// recurse forever during validation (eg `{"$ref": "#"}`).
+func (c *jsCompiler) checkCycles(s *jsSchema) error {
+	// Find cycles of in-place subschemas
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*jsSchema]int)
+	var visit func(s *jsSchema) error
+	visit = func(s *jsSchema) error {
+		switch state[s] {
+		case visiting:
+			return fmt.Errorf("invalid schema at %q: reference cycle without a change of instance location", s.loc)
+		case visited:
+			return nil
+		}
+		state[s] = visiting
+		for _, sub := range s.inPlace() {
+			if sub == nil || c.checked[sub] {
+				continue
+			}
+			if err := visit(sub); err != nil {
+				return err
+			}
+		}
+		state[s] = visited
+		return nil
+	}
+
+	// Check each reachable schema once
+	var walk func(s *jsSchema) error
+	walk = func(s *jsSchema) error {
+		if s == nil || c.checked[s] {
+			return nil
+		}
+		if err := visit(s); err != nil {
+			return err
+		}
+		c.checked[s] = true
+		for _, sub := range s.subschemas() {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(s)
+}
+
+// validateKw validates the value v against s, a subschema of the keyword
+// kw, so that a `false` subschema is reported as a failure of kw.
+func (s *jsSchema) validateKw(kw string, v any, ptr string) ([]JSONSchemaError, *jsAnnotations) {
+	if s.always != nil && !*s.always {
+		return []JSONSchemaError{{ptr, kw, "no value is allowed"}}, &jsAnnotations{}
+	}
+	return s.validate(v, ptr)
+}
+
+// validate validates the value v (located at the JSON Pointer ptr) and
+// returns any errors along with the annotations collected.
+func (s *jsSchema) validate(v any, ptr string) ([]JSONSchemaError, *jsAnnotations) {
+	ann := &jsAnnotations{}
+
+	// Boolean schema?
+	if s.always != nil {
+		if !*s.always {
+			return []JSONSchemaError{{ptr, "false", "no value is allowed"}}, ann
+		}
+		return nil, ann
+	}
+
+	var errs []JSONSchemaError
+	add := func(kw, format string, args ...any) {
+		errs = append(errs, JSONSchemaError{ptr, kw, fmt.Sprintf(format, args...)})
+	}
+
+	// Reference
+	if s.ref != nil {
+		es, a := s.ref.validateKw("$ref", v, ptr)
+		errs = append(errs, es...)
+		ann.merge(a)
+		if s.refOnly {
+			return errs, ann
+		}
+	}
+
+	// Type, enum and const
+	if len(s.types) > 0 && !(v == nil && s.nullable) {
+		if !jsTypeMatches(v, s.types) {
+			add("type", "expected %s, found %s", strings.Join(s.types, " or "), jsonType(v))
+		}
+	}
+	if s.hasEnum {
+		found := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found && !(v == nil && s.nullable) {
+			add("enum", "expected one of %s, found %s", jsonString(s.enum), jsonString(v))
+		}
+	}
+	if s.hasConst && !reflect.DeepEqual(v, s.constVal) {
+		add("const", "expected %s, found %s", jsonString(s.constVal), jsonString(v))
+	}
+
+	// Type-specific keywords
+	switch t := v.(type) {
+	case float64:
+		errs = append(errs, s.validateNumber(t, ptr)...)
+	case string:
+		errs = append(errs, s.validateString(t, ptr)...)
+	case []any:
+		es, a := s.validateArray(t, ptr)
+		errs = append(errs, es...)
+		ann.merge(a)
+	case map[string]any:
+		es, a := s.validateObject(t, ptr)
+		errs = append(errs, es...)
+		ann.merge(a)
+	}
+
+	// Applicators
+	for _, sub := range s.allOf {
+		es, a := sub.validateKw("allOf", v, ptr)
+		errs = append(errs, es...)
+		ann.merge(a)
+	}
+	if len(s.anyOf) > 0 {
+		n := 0
+		for _, sub := range s.anyOf {
+			if es, a := sub.validate(v, ptr); len(es) == 0 {
+				n++
+				ann.merge(a)
+			}
+		}
+		if n == 0 {
+			add("anyOf", "expected value to match at least one of %d schemas", len(s.anyOf))
+		}
+	}
+	if len(s.oneOf) > 0 {
+		var matches []int
+		for i, sub := range s.oneOf {
+			if es, a := sub.validate(v, ptr); len(es) == 0 {
+				matches = append(matches, i)
+				ann.merge(a)
+			}
+		}
+		if len(matches) != 1 {
+			add("oneOf", "expected value to match exactly one of %d schemas, matched %d", len(s.oneOf), len(matches))
+		}
+	}
+	if s.not != nil {
+		if es, _ := s.not.validate(v, ptr); len(es) == 0 {
+			add("not", "expected value not to match the schema")
+		}
+	}
+	if s.ifSchema != nil {
+		if es, a := s.ifSchema.validate(v, ptr); len(es) == 0 {
+			ann.merge(a)
+			if s.thenSchema != nil {
+				es, a := s.thenSchema.validateKw("then", v, ptr)
+				errs = append(errs, es...)
+				ann.merge(a)
+			}
+		} else if s.elseSchema != nil {
+			es, a := s.elseSchema.validateKw("else", v, ptr)
+			errs = append(errs, es...)
+			ann.merge(a)
+		}
+	}
+
+	// Unevaluated items and properties (these need the
+	// annotations from all of the other keywords)
+	if a, ok := v.([]any); ok && s.unevaluatedItems != nil {
+		for i, item := range a {
+			if ann.items[i] {
+				continue
+			}
+			es, _ := s.unevaluatedItems.validateKw("unevaluatedItems", item, ptr+"/"+strconv.Itoa(i))
+			errs = append(errs, es...)
+			ann.item(i)
+		}
+	}
+	if o, ok := v.(map[string]any); ok && s.unevaluatedProperties != nil {
+		for _, k := range jsSortedKeys(o) {
+			if ann.props[k] {
+				continue
+			}
+			es, _ := s.unevaluatedProperties.validateKw("unevaluatedProperties", o[k], ptr+"/"+jsEscapePointer(k))
+			errs = append(errs, es...)
+			ann.prop(k)
+		}
+	}
+
+	return errs, ann
+}
+
+// validateNumber validates the numeric keywords.
+func (s *jsSchema) validateNumber(f float64, ptr string) []JSONSchemaError {
+	var errs []JSONSchemaError
+	add := func(kw, format string, args ...any) {
+		errs = append(errs, JSONSchemaError{ptr, kw, fmt.Sprintf(format, args...)})
+	}
+	if s.multipleOf != nil && *s.multipleOf > 0 {
+		q := f / *s.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			add("multipleOf", "expected a multiple of %v, found %v", *s.multipleOf, f)
+		}
+	}
+	if s.maximum != nil && f > *s.maximum {
+		add("maximum", "expected a value <= %v, found %v", *s.maximum, f)
+	}
+	if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+		add("exclusiveMaximum", "expected a value < %v, found %v", *s.exclusiveMaximum, f)
+	}
+	if s.minimum != nil && f < *s.minimum {
+		add("minimum", "expected a value >= %v, found %v", *s.minimum, f)
+	}
+	if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+		add("exclusiveMinimum", "expected a value > %v, found %v", *s.exclusiveMinimum, f)
+	}
+	return errs
+}
+
+// validateString validates the string keywords.
+func (s *jsSchema) validateString(str string, ptr string) []JSONSchemaError {
+	var errs []JSONSchemaError
+	add := func(kw, format string, args ...any) {
+		errs = append(errs, JSONSchemaError{ptr, kw, fmt.Sprintf(format, args...)})
+	}
+	n := utf8.RuneCountInString(str)
+	if s.maxLength != nil && n > *s.maxLength {
+		add("maxLength", "expected a length <= %d, found %d", *s.maxLength, n)
+	}
+	if s.minLength != nil && n < *s.minLength {
+		add("minLength", "expected a length >= %d, found %d", *s.minLength, n)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		add("pattern", "expected %q to match %q", str, s.pattern)
+	}
+	if s.format != "" && !jsFormatValid(s.format, str) {
+		add("format", "expected %q to be a valid %s", str, s.format)
+	}
+	return errs
+}
+
+// validateArray validates the array keywords.
+func (s *jsSchema) validateArray(a []any, ptr string) ([]JSONSchemaError, *jsAnnotations) {
+	ann := &jsAnnotations{}
+	var errs []JSONSchemaError
+	add := func(kw, format string, args ...any) {
+		errs = append(errs, JSONSchemaError{ptr, kw, fmt.Sprintf(format, args...)})
+	}
+
+	if s.maxItems != nil && len(a) > *s.maxItems {
+		add("maxItems", "expected at most %d items, found %d", *s.maxItems, len(a))
+	}
+	if s.minItems != nil && len(a) < *s.minItems {
+		add("minItems", "expected at least %d items, found %d", *s.minItems, len(a))
+	}
+	if s.uniqueItems {
+	outer:
+		for i := range a {
+			for j := i + 1; j < len(a); j++ {
+				if reflect.DeepEqual(a[i], a[j]) {
+					add("uniqueItems", "expected unique items, found duplicates at %d and %d", i, j)
+					break outer
+				}
+			}
+		}
+	}
+	for i, item := range a {
+		sub, kw := s.items, s.itemsKw
+		if i < len(s.prefixItems) {
+			sub, kw = s.prefixItems[i], s.prefixItemsKw
+		}
+		if sub == nil {
+			continue
+		}
+		es, _ := sub.validateKw(kw, item, ptr+"/"+strconv.Itoa(i))
+		errs = append(errs, es...)
+		ann.item(i)
+	}
+	if s.contains != nil {
+		n := 0
+		for i, item := range a {
+			if es, _ := s.contains.validate(item, ptr+"/"+strconv.Itoa(i)); len(es) == 0 {
+				n++
+				ann.item(i)
+			}
+		}
+		min := 1
+		if s.minContains != nil {
+			min = *s.minContains
+		}
+		if n < min {
+			add("contains", "expected at least %d matching items, found %d", min, n)
+		}
+		if s.maxContains != nil && n > *s.maxContains {
+			add("maxContains", "expected at most %d matching items, found %d", *s.maxContains, n)
+		}
+	}
+	return errs, ann
+}
+
+// validateObject validates the object keywords.
+func (s *jsSchema) validateObject(o map[string]any, ptr string) ([]JSONSchemaError, *jsAnnotations) {
+	ann := &jsAnnotations{}
+	var errs []JSONSchemaError
+	add := func(kw, format string, args ...any) {
+		errs = append(errs, JSONSchemaError{ptr, kw, fmt.Sprintf(format, args...)})
+	}
+
+	if s.maxProperties != nil && len(o) > *s.maxProperties {
+		add("maxProperties", "expected at most %d properties, found %d", *s.maxProperties, len(o))
+	}
+	if s.minProperties != nil && len(o) < *s.minProperties {
+		add("minProperties", "expected at least %d properties, found %d", *s.minProperties, len(o))
+	}
+	for _, r := range s.required {
+		if _, ok := o[r]; !ok {
+			add("required", "missing required property %q", r)
+		}
+	}
+	for _, k := range jsSortedKeys(s.dependentRequired) {
+		if _, ok := o[k]; !ok {
+			continue
+		}
+		kw := "dependentRequired"
+		if s.dependencies[k] {
+			kw = "dependencies"
+		}
+		for _, r := range s.dependentRequired[k] {
+			if _, ok := o[r]; !ok {
+				add(kw, "property %q is required when %q is present", r, k)
+			}
+		}
+	}
+
+	for _, k := range jsSortedKeys(o) {
+		kptr := ptr + "/" + jsEscapePointer(k)
+		evaluated := false
+
+		if sub, ok := s.properties[k]; ok {
+			es, _ := sub.validateKw("properties", o[k], kptr)
+			errs = append(errs, es...)
+			evaluated = true
+		}
+		for _, pp := range s.patternProperties {
+			if pp.re.MatchString(k) {
+				es, _ := pp.s.validateKw("patternProperties", o[k], kptr)
+				errs = append(errs, es...)
+				evaluated = true
+			}
+		}
+		if !evaluated && s.additionalProperties != nil {
+			if s.additionalProperties.always != nil && !*s.additionalProperties.always {
+				errs = append(errs, JSONSchemaError{ptr, "additionalProperties", fmt.Sprintf("unexpected property %q", k)})
+			} else {
+				es, _ := s.additionalProperties.validate(o[k], kptr)
+				errs = append(errs, es...)
+			}
+			evaluated = true
+		}
+		if evaluated {
+			ann.prop(k)
+		}
+
+		if s.propertyNames != nil {
+			if es, _ := s.propertyNames.validate(k, kptr); len(es) > 0 {
+				add("propertyNames", "invalid property name %q", k)
+			}
+		}
+	}
+
+	for _, k := range jsSortedKeys(s.dependentSchemas) {
+		if _, ok := o[k]; !ok {
+			continue
+		}
+		kw := "dependentSchemas"
+		if s.dependencies[k] {
+			kw = "dependencies"
+		}
+		es, a := s.dependentSchemas[k].validateKw(kw, o, ptr)
+		errs = append(errs, es...)
+		ann.merge(a)
+	}
+	return errs, ann
+}
+
+// jsSortedKeys returns the sorted keys of the map m.
+func jsSortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsTypeMatches reports if the value v matches any of the JSON
+// Schema type names in types.
+func jsTypeMatches(v any, types []string) bool {
+	jt := jsonType(v)
+	for _, t := range types {
+		if t == jt {
+			return true
+		}
+		if t == "integer" {
+			if f, ok := v.(float64); ok && f == math.Trunc(f) && !math.IsInf(f, 0) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsUUIDMatch matches a UUID string.
+var jsUUIDMatch = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// jsHostnameMatch matches a hostname (RFC 1123).
+var jsHostnameMatch = regexp.MustCompile(`^(?i:[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)(\.(?i:[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?))*$`)
+
+// jsFormatValid reports if the string s is valid according to the format f.
+// Unknown formats are always valid.
+func jsFormatValid(f, s string) bool {
+	switch f {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, s)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", s)
+		if err != nil {
+			_, err = time.Parse("15:04:05.999999999Z07:00", s)
+		}
+		return err == nil
+	case "email":
+		a, err := mail.ParseAddress(s)
+		return err == nil && a.Address == s
+	case "hostname":
+		return len(s) <= 253 && jsHostnameMatch.MatchString(s)
+	case "ipv4":
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+	case "ipv6":
+		ip := net.ParseIP(s)
+		return ip != nil && strings.Contains(s, ":")
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	case "uri-reference":
+		_, err := url.Parse(s)
+		return err == nil
+	case "uuid":
+		return jsUUIDMatch.MatchString(s)
+	case "regex":
+		_, err := regexp.Compile(s)
+		return err == nil
+	}
+	return true
+}
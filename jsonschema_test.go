@@ -0,0 +1,433 @@
+package vhttp_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/a-poor/vhttp"
+	"github.com/hashicorp/go-multierror"
+)
+
+// userSchema is a sample draft 2020-12 schema used by the JSON Schema tests.
+const userSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["id", "name", "email"],
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"name": {"type": "string", "minLength": 1, "maxLength": 10},
+		"email": {"type": "string", "format": "email"},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true},
+		"point": {"type": "array", "prefixItems": [{"type": "number"}, {"type": "number"}], "items": false},
+		"friend": {"$ref": "#"},
+		"kind": {"$ref": "#/$defs/kind"}
+	},
+	"additionalProperties": false,
+	"$defs": {
+		"kind": {"type": "string", "pattern": "^[a-z]+$"}
+	}
+}`
+
+// schemaErrors returns the JSONSchemaErrors from err.
+func schemaErrors(t *testing.T, err error) []vhttp.JSONSchemaError {
+	t.Helper()
+	var merr *multierror.Error
+	if !errors.As(err, &merr) {
+		t.Fatalf("expected a multierror, got %T: %v", err, err)
+	}
+	var out []vhttp.JSONSchemaError
+	for _, e := range merr.Errors {
+		var serr vhttp.JSONSchemaError
+		if !errors.As(e, &serr) {
+			t.Fatalf("expected a JSONSchemaError, got %T: %v", e, e)
+		}
+		out = append(out, serr)
+	}
+	return out
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	s, err := vhttp.CompileJSONSchema([]byte(userSchema))
+	if err != nil {
+		t.Fatalf("unexpected error compiling schema: %s", err)
+	}
+
+	cases := []struct {
+		name   string   // Case name
+		doc    string   // JSON document to validate
+		expect []string // Expected "keyword@pointer" errors
+	}{
+		{
+			name: "valid",
+			doc:  `{"id": 1, "name": "alice", "email": "alice@example.com", "tags": ["a", "b"], "point": [1, 2]}`,
+		},
+		{
+			name: "valid-recursive",
+			doc:  `{"id": 1, "name": "alice", "email": "a@example.com", "friend": {"id": 2, "name": "bob", "email": "b@example.com"}, "kind": "abc"}`,
+		},
+		{
+			name:   "missing-required",
+			doc:    `{"id": 1, "name": "alice"}`,
+			expect: []string{"required@"},
+		},
+		{
+			name:   "wrong-types",
+			doc:    `{"id": 1.5, "name": 5, "email": "a@example.com"}`,
+			expect: []string{"type@/id", "type@/name"},
+		},
+		{
+			name:   "constraints",
+			doc:    `{"id": 0, "name": "abcdefghijklmnop", "email": "not-an-email", "role": "root"}`,
+			expect: []string{"email@/email", "minimum@/id", "maxLength@/name", "enum@/role"},
+		},
+		{
+			name:   "arrays",
+			doc:    `{"id": 1, "name": "a", "email": "a@example.com", "tags": ["a", "a"], "point": [1, 2, 3]}`,
+			expect: []string{"items@/point/2", "uniqueItems@/tags"},
+		},
+		{
+			name:   "additional-properties",
+			doc:    `{"id": 1, "name": "a", "email": "a@example.com", "extra": true}`,
+			expect: []string{"additionalProperties@"},
+		},
+		{
+			name:   "refs",
+			doc:    `{"id": 1, "name": "a", "email": "a@example.com", "kind": "ABC", "friend": {"id": -1, "name": "b", "email": "b@example.com"}}`,
+			expect: []string{"minimum@/friend/id", "pattern@/kind"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var v any
+			if err := json.Unmarshal([]byte(c.doc), &v); err != nil {
+				t.Fatal(err)
+			}
+
+			err := s.Validate(v)
+			if len(c.expect) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error to be returned")
+			}
+
+			got := make(map[string]bool)
+			for _, e := range schemaErrors(t, err) {
+				kw := e.Keyword
+				if e.Keyword == "format" {
+					kw = "email"
+				}
+				got[kw+"@"+e.InstancePath] = true
+			}
+			for _, e := range c.expect {
+				if !got[e] {
+					t.Errorf("expected error %q, got %v", e, got)
+				}
+			}
+			if len(got) != len(c.expect) {
+				t.Errorf("expected %d errors, got %d: %v", len(c.expect), len(got), err)
+			}
+		})
+	}
+}
+
+func TestJSONSchemaApplicators(t *testing.T) {
+	cases := []struct {
+		name   string // Case name
+		schema string // Schema to compile
+		doc    string // JSON document to validate
+		isErr  bool   // Should an error be returned
+	}{
+		{
+			name:   "anyOf-pass",
+			schema: `{"anyOf": [{"type": "string"}, {"type": "number"}]}`,
+			doc:    `5`,
+		},
+		{
+			name:   "anyOf-fail",
+			schema: `{"anyOf": [{"type": "string"}, {"type": "number"}]}`,
+			doc:    `true`,
+			isErr:  true,
+		},
+		{
+			name:   "oneOf-fail-both",
+			schema: `{"oneOf": [{"type": "integer"}, {"type": "number"}]}`,
+			doc:    `5`,
+			isErr:  true,
+		},
+		{
+			name:   "not",
+			schema: `{"not": {"type": "null"}}`,
+			doc:    `null`,
+			isErr:  true,
+		},
+		{
+			name:   "if-then-else",
+			schema: `{"if": {"properties": {"a": {"const": 1}}}, "then": {"required": ["b"]}, "else": {"required": ["c"]}}`,
+			doc:    `{"a": 2, "c": 1}`,
+		},
+		{
+			name:   "if-then-fail",
+			schema: `{"if": {"properties": {"a": {"const": 1}}}, "then": {"required": ["b"]}}`,
+			doc:    `{"a": 1}`,
+			isErr:  true,
+		},
+		{
+			name:   "contains",
+			schema: `{"contains": {"type": "string"}, "minContains": 2}`,
+			doc:    `["a", 1, "b"]`,
+		},
+		{
+			name:   "dependent-required",
+			schema: `{"dependentRequired": {"card": ["billing"]}}`,
+			doc:    `{"card": "1234"}`,
+			isErr:  true,
+		},
+		{
+			name:   "unevaluated-properties",
+			schema: `{"allOf": [{"properties": {"a": true}}], "properties": {"b": true}, "unevaluatedProperties": false}`,
+			doc:    `{"a": 1, "b": 2}`,
+		},
+		{
+			name:   "unevaluated-properties-fail",
+			schema: `{"allOf": [{"properties": {"a": true}}], "unevaluatedProperties": false}`,
+			doc:    `{"a": 1, "c": 2}`,
+			isErr:  true,
+		},
+		{
+			name:   "anchor",
+			schema: `{"$ref": "#pos", "$defs": {"p": {"$anchor": "pos", "minimum": 0}}}`,
+			doc:    `-1`,
+			isErr:  true,
+		},
+		{
+			name:   "embedded-id",
+			schema: `{"$id": "https://example.com/root.json", "$ref": "item.json", "$defs": {"i": {"$id": "item.json", "type": "string"}}}`,
+			doc:    `"abc"`,
+		},
+		{
+			name:   "draft-07-items",
+			schema: `{"$schema": "http://json-schema.org/draft-07/schema#", "items": [{"type": "string"}], "additionalItems": {"type": "number"}}`,
+			doc:    `["a", 1, "b"]`,
+			isErr:  true,
+		},
+		{
+			name:   "draft-07-ref-ignores-siblings",
+			schema: `{"$schema": "http://json-schema.org/draft-07/schema#", "definitions": {"s": {"type": "string"}}, "properties": {"a": {"$ref": "#/definitions/s", "maxLength": 1}}}`,
+			doc:    `{"a": "abc"}`,
+		},
+		{
+			name:   "draft-07-dependencies",
+			schema: `{"$schema": "http://json-schema.org/draft-07/schema#", "dependencies": {"a": ["b"], "c": {"required": ["d"]}}}`,
+			doc:    `{"c": 1}`,
+			isErr:  true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := vhttp.CompileJSONSchema([]byte(c.schema))
+			if err != nil {
+				t.Fatalf("unexpected error compiling schema: %s", err)
+			}
+			var v any
+			if err := json.Unmarshal([]byte(c.doc), &v); err != nil {
+				t.Fatal(err)
+			}
+			err = s.Validate(v)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+}
+
+func TestCompileJSONSchema(t *testing.T) {
+	cases := []struct {
+		name   string // Case name
+		schema string // Schema to compile
+	}{
+		{name: "invalid-json", schema: `{`},
+		{name: "invalid-schema", schema: `{"properties": {"a": 5}}`},
+		{name: "invalid-pattern", schema: `{"pattern": "("}`},
+		{name: "missing-ref", schema: `{"$ref": "#/$defs/missing"}`},
+		{name: "remote-ref", schema: `{"$ref": "https://example.com/schema.json"}`},
+		{name: "ref-cycle", schema: `{"$ref": "#/$defs/a", "$defs": {"a": {"$ref": "#/$defs/a"}}}`},
+		{name: "ref-cycle-self", schema: `{"type": "object", "$ref": "#"}`},
+		{name: "ref-cycle-applicators", schema: `{"$defs": {"a": {"anyOf": [{"type": "string"}, {"$ref": "#/$defs/b"}]}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}, "properties": {"x": {"$ref": "#/$defs/a"}}}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := vhttp.CompileJSONSchema([]byte(c.schema)); err == nil {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+
+	// Recursion that moves into the instance is fine
+	s, err := vhttp.CompileJSONSchema([]byte(`{"$defs": {"node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}}}}, "$ref": "#/$defs/node"}`))
+	if err != nil {
+		t.Fatalf("unexpected error compiling a recursive schema: %s", err)
+	}
+	if err := s.Validate(map[string]any{"children": []any{map[string]any{"children": []any{5.0}}}}); err == nil {
+		t.Errorf("expected an error for an invalid nested node")
+	}
+}
+
+func TestJSONSchemaErrorKeywords(t *testing.T) {
+	cases := []struct {
+		name    string // Case name
+		schema  string // Schema to compile
+		doc     string // JSON document to validate
+		keyword string // Keyword expected to fail
+	}{
+		{"items", `{"items": false}`, `[1]`, "items"},
+		{"prefix-items", `{"prefixItems": [false]}`, `[1]`, "prefixItems"},
+		{"draft-07-items", `{"$schema": "http://json-schema.org/draft-07/schema#", "items": [false]}`, `[1]`, "items"},
+		{"draft-07-additional-items", `{"$schema": "http://json-schema.org/draft-07/schema#", "items": [true], "additionalItems": false}`, `[1, 2]`, "additionalItems"},
+		{"properties", `{"properties": {"a": false}}`, `{"a": 1}`, "properties"},
+		{"unevaluated-properties", `{"unevaluatedProperties": false}`, `{"a": 1}`, "unevaluatedProperties"},
+		{"unevaluated-items", `{"unevaluatedItems": false}`, `[1]`, "unevaluatedItems"},
+		{"ref", `{"$ref": "#/$defs/no", "$defs": {"no": false}}`, `1`, "$ref"},
+		{"dependent-required", `{"dependentRequired": {"a": ["b"]}}`, `{"a": 1}`, "dependentRequired"},
+		{"draft-07-dependencies", `{"$schema": "http://json-schema.org/draft-07/schema#", "dependencies": {"a": ["b"]}}`, `{"a": 1}`, "dependencies"},
+		{"draft-07-dependencies-schema", `{"$schema": "http://json-schema.org/draft-07/schema#", "dependencies": {"a": false}}`, `{"a": 1}`, "dependencies"},
+		{"root-false", `false`, `1`, "false"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := vhttp.CompileJSONSchema([]byte(c.schema))
+			if err != nil {
+				t.Fatalf("unexpected error compiling schema: %s", err)
+			}
+			var v any
+			if err := json.Unmarshal([]byte(c.doc), &v); err != nil {
+				t.Fatal(err)
+			}
+			es := schemaErrors(t, s.Validate(v))
+			if len(es) != 1 || es[0].Keyword != c.keyword {
+				t.Errorf("expected a single %q error, found %v", c.keyword, es)
+			}
+		})
+	}
+}
+
+func TestLoadJSONSchemaFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schemas/user.json": {Data: []byte(`{
+			"type": "object",
+			"properties": {
+				"id": {"$ref": "common/defs.json#/$defs/id"},
+				"address": {"$ref": "common/address.json"}
+			}
+		}`)},
+		"schemas/common/defs.json": {Data: []byte(`{"$defs": {"id": {"type": "integer", "minimum": 1}}}`)},
+		"schemas/common/address.json": {Data: []byte(`{
+			"type": "object",
+			"required": ["city"],
+			"properties": {"zip": {"$ref": "defs.json#/$defs/id"}}
+		}`)},
+	}
+
+	s, err := vhttp.LoadJSONSchemaFS(fsys, "schemas/user.json")
+	if err != nil {
+		t.Fatalf("unexpected error loading schema: %s", err)
+	}
+
+	body := []byte(`{"id": 0, "address": {"zip": 0}}`)
+	errs := schemaErrors(t, vhttp.BodyMatchesJSONSchema(s)(body))
+	expect := []string{"/address", "/address/zip", "/id"}
+	if len(errs) != len(expect) {
+		t.Fatalf("expected %d errors, got %v", len(expect), errs)
+	}
+	for i, e := range errs {
+		if e.InstancePath != expect[i] {
+			t.Errorf("expected error %d at %q, got %q", i, expect[i], e.InstancePath)
+		}
+	}
+
+	t.Run("missing-file", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"a.json": {Data: []byte(`{"$ref": "b.json"}`)},
+		}
+		if _, err := vhttp.LoadJSONSchemaFS(fsys, "a.json"); err == nil {
+			t.Errorf("expected an error to be returned")
+		}
+	})
+}
+
+func TestLoadJSONSchemaFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"$ref": "b.json"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"type": "string"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := vhttp.LoadJSONSchemaFile(filepath.Join(dir, "a.json"))
+	if err != nil {
+		t.Fatalf("unexpected error loading schema: %s", err)
+	}
+	if err := vhttp.BodyMatchesJSONSchema(s)([]byte(`"abc"`)); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := vhttp.BodyMatchesJSONSchema(s)([]byte(`123`)); err == nil {
+		t.Errorf("expected an error to be returned")
+	}
+
+	// References can't point above the file's directory
+	sub := filepath.Join(dir, "schemas")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "user.json"), []byte(`{"$ref": "../b.json"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vhttp.LoadJSONSchemaFile(filepath.Join(sub, "user.json")); err == nil || !strings.Contains(err.Error(), "above the root") {
+		t.Errorf("expected an error for a reference above the schema's directory, found %v", err)
+	}
+
+	// ...unless the file system is rooted above it
+	s, err = vhttp.LoadJSONSchemaFS(os.DirFS(dir), "schemas/user.json")
+	if err != nil {
+		t.Fatalf("unexpected error loading schema: %s", err)
+	}
+	if err := vhttp.BodyMatchesJSONSchema(s)([]byte(`123`)); err == nil {
+		t.Errorf("expected an error to be returned")
+	}
+}
+
+func TestBodyMatchesJSONSchema(t *testing.T) {
+	s := vhttp.MustCompileJSONSchema([]byte(userSchema))
+
+	t.Run("flattened", func(t *testing.T) {
+		// The individual schema errors should be flattened
+		// into the list of request errors.
+		req := newBodyRequest(`{"id": 0, "name": "", "email": "a@example.com"}`)
+		err := vhttp.ValidateRequest(req, vhttp.BodyMatchesJSONSchema(s), vhttp.MethodIsPost())
+		var merr *multierror.Error
+		if !errors.As(err, &merr) {
+			t.Fatalf("expected a multierror, got %v", err)
+		}
+		if len(merr.Errors) != 3 {
+			t.Errorf("expected 3 errors, got %d: %s", len(merr.Errors), err)
+		}
+	})
+	t.Run("invalid-json", func(t *testing.T) {
+		if err := vhttp.BodyMatchesJSONSchema(s)([]byte(`{{`)); err == nil {
+			t.Errorf("expected an error to be returned")
+		}
+	})
+}
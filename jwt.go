@@ -0,0 +1,585 @@
+package vhttp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTKey is a key used to verify JWT signatures.
+type JWTKey struct {
+	// ID is the key's ID, matched against a token's "kid" header. If
+	// empty, the key can verify any token.
+	ID string
+
+	// Algorithm, if set, is the only algorithm (eg "RS256") the key can
+	// be used with.
+	Algorithm string
+
+	// Key is the key itself: a []byte secret for the HMAC algorithms
+	// (HS256, HS384 and HS512), an *rsa.PublicKey for RS256 and PS256, an
+	// *ecdsa.PublicKey for ES256 or an ed25519.PublicKey for EdDSA.
+	Key any
+}
+
+// ParseJWKS parses a JSON Web Key Set (RFC 7517) containing RSA, EC
+// (P-256), OKP (Ed25519) or oct (symmetric) keys. Keys with "use" set to
+// anything other than "sig" are skipped.
+func ParseJWKS(b []byte) ([]JWTKey, error) {
+	var set struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+	var keys []JWTKey
+	for i, jwk := range set.Keys {
+		str := func(k string) string {
+			s, _ := jwk[k].(string)
+			return s
+		}
+		if use := str("use"); use != "" && use != "sig" {
+			continue
+		}
+		key, err := parseJWK(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d in JWKS: %w", i, err)
+		}
+		keys = append(keys, JWTKey{ID: str("kid"), Algorithm: str("alg"), Key: key})
+	}
+	return keys, nil
+}
+
+// LoadJWKSFile loads and parses the JSON Web Key Set in the file at name
+// (see ParseJWKS).
+func LoadJWKSFile(name string) ([]JWTKey, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	return ParseJWKS(b)
+}
+
+// parseJWK parses the key in a JWK, using str to get its string members.
+func parseJWK(str func(string) string) (any, error) {
+	b64 := func(k string) ([]byte, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(str(k), "="))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid or missing %q member", k)
+		}
+		return b, nil
+	}
+	switch kty := str("kty"); kty {
+	case "RSA":
+		n, err := b64("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64("e")
+		if err != nil {
+			return nil, err
+		}
+		ei := new(big.Int).SetBytes(e)
+		if !ei.IsInt64() || ei.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(ei.Int64())}, nil
+	case "EC":
+		if crv := str("crv"); crv != "P-256" {
+			return nil, fmt.Errorf("unsupported EC curve %q", crv)
+		}
+		x, err := b64("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64("y")
+		if err != nil {
+			return nil, err
+		}
+		k := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !k.Curve.IsOnCurve(k.X, k.Y) {
+			return nil, fmt.Errorf("EC point is not on the curve")
+		}
+		return k, nil
+	case "OKP":
+		if crv := str("crv"); crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", crv)
+		}
+		x, err := b64("x")
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return b64("k")
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", kty)
+	}
+}
+
+// JWTClaims are the claims in a JWT's payload.
+type JWTClaims map[string]any
+
+// jwtClaimsKey is the context key for a request's verified JWT claims.
+type jwtClaimsKey struct{}
+
+// ContextWithJWTClaims returns a copy of ctx carrying the JWT claims c,
+// so that they can be read with JWTClaimsFromRequest and checked by
+// JWTClaimsValidators. This is useful for keeping the claims after
+// validation (eg in a middleware using JWTConfig's OnClaims callback).
+func ContextWithJWTClaims(ctx context.Context, c JWTClaims) context.Context {
+	return context.WithValue(ctx, jwtClaimsKey{}, c)
+}
+
+// JWTClaimsFromRequest returns the JWT claims verified by BearerJWT
+// earlier in the same ValidateRequest call or, failing that, the claims
+// added to the request's context with ContextWithJWTClaims. The second
+// return value reports if any claims were found.
+func JWTClaimsFromRequest(req *http.Request) (JWTClaims, bool) {
+	if h, ok := jwtClaimsHolders.Load(req); ok {
+		if c := h.(*jwtClaimsHolder).get(); c != nil {
+			return c, true
+		}
+	}
+	c, ok := req.Context().Value(jwtClaimsKey{}).(JWTClaims)
+	return c, ok
+}
+
+// jwtClaimsHolder holds the claims verified by BearerJWT for a request
+// while it's being validated.
+type jwtClaimsHolder struct {
+	mu     sync.Mutex
+	claims JWTClaims
+}
+
+func (h *jwtClaimsHolder) get() JWTClaims {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.claims
+}
+
+func (h *jwtClaimsHolder) set(c JWTClaims) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.claims = c
+}
+
+// jwtClaimsHolders maps the requests currently being validated to their
+// jwtClaimsHolders.
+var jwtClaimsHolders sync.Map
+
+// holdJWTClaims adds a jwtClaimsHolder for req (if it doesn't already have
+// one) for the duration of a ValidateRequest call, and returns a function
+// that removes it again.
+func holdJWTClaims(req *http.Request) func() {
+	if _, loaded := jwtClaimsHolders.LoadOrStore(req, &jwtClaimsHolder{}); loaded {
+		return func() {} // Already held by an outer call
+	}
+	return func() { jwtClaimsHolders.Delete(req) }
+}
+
+// JWTClaimsValidator is a validator that validates JWT claims.
+//
+// To check the claims of the token verified by BearerJWT, use it in
+// JWTConfig's Claims field, or as a RequestValidator after BearerJWT in the
+// same ValidateRequest call. As a RequestValidator, it checks the claims
+// returned by JWTClaimsFromRequest.
+type JWTClaimsValidator func(JWTClaims) error
+
+func (v JWTClaimsValidator) ValidateRequest(req *http.Request) error {
+	c, ok := JWTClaimsFromRequest(req)
+	if !ok {
+		return validationErrorf("jwt", "JWTClaimsValidator", CodeMissing, nil, nil,
+			"request has no verified JWT claims")
+	}
+	return v(c)
+}
+
+// jwtClaimTarget returns the ValidationError target for the JWT claim k.
+func jwtClaimTarget(k string) string {
+	return fmt.Sprintf("jwt[%q]", k)
+}
+
+// JWTClaimHas creates a JWTClaimsValidator that checks that the claim k
+// is present.
+func JWTClaimHas(k string) JWTClaimsValidator {
+	return func(c JWTClaims) error {
+		if _, ok := c[k]; !ok {
+			return validationErrorf(jwtClaimTarget(k), "JWTClaimHas", CodeMissing, nil, nil,
+				"expected JWT claim %q to be present", k)
+		}
+		return nil
+	}
+}
+
+// JWTClaimIs creates a JWTClaimsValidator that checks that the claim k is
+// equal to v (compared after normalizing v through JSON).
+func JWTClaimIs(k string, v any) JWTClaimsValidator {
+	want, err := jsonNormalize(v)
+	if err != nil {
+		return func(JWTClaims) error {
+			return InternalErr(fmt.Errorf("failed to encode expected value as JSON: %w", err))
+		}
+	}
+	return func(c JWTClaims) error {
+		got, ok := c[k]
+		if !ok {
+			return validationErrorf(jwtClaimTarget(k), "JWTClaimIs", CodeMissing, want, nil,
+				"expected JWT claim %q to be present", k)
+		}
+		if !reflect.DeepEqual(got, want) {
+			return validationErrorf(jwtClaimTarget(k), "JWTClaimIs", CodeMismatch, want, got,
+				"expected JWT claim %q to be %s, found %s", k, jsonString(want), jsonString(got))
+		}
+		return nil
+	}
+}
+
+// JWTClaimMatches creates a JWTClaimsValidator that checks that the claim
+// k is a string that matches the regular expression re.
+func JWTClaimMatches(k string, re *regexp.Regexp) JWTClaimsValidator {
+	return func(c JWTClaims) error {
+		got, ok := c[k]
+		if !ok {
+			return validationErrorf(jwtClaimTarget(k), "JWTClaimMatches", CodeMissing, re.String(), nil,
+				"expected JWT claim %q to be present", k)
+		}
+		if s, ok := got.(string); !ok || !re.MatchString(s) {
+			return validationErrorf(jwtClaimTarget(k), "JWTClaimMatches", CodeNoMatch, re.String(), got,
+				"expected JWT claim %q to match %q, found %s", k, re, jsonString(got))
+		}
+		return nil
+	}
+}
+
+// JWTConfig configures a BearerJWT validator.
+type JWTConfig struct {
+	// Keys are the keys used to verify tokens' signatures.
+	Keys []JWTKey
+
+	// Algorithms, if set, are the only algorithms accepted. Otherwise,
+	// any supported algorithm compatible with the key is accepted.
+	Algorithms []string
+
+	// Issuer, if set, is the required "iss" claim.
+	Issuer string
+
+	// Audience, if set, must be one of the token's "aud" claim values.
+	Audience string
+
+	// RequireExpiration requires the token to have an "exp" claim.
+	RequireExpiration bool
+
+	// Leeway is the clock skew allowed when checking the "exp", "nbf"
+	// and "iat" claims.
+	Leeway time.Duration
+
+	// Claims are additional validators run on the token's claims.
+	Claims []JWTClaimsValidator
+
+	// OnClaims, if set, is called with the claims of a token that passed
+	// validation, eg so that a middleware can add them to the request's
+	// context with ContextWithJWTClaims.
+	OnClaims func(JWTClaims)
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// BearerJWT creates a RequestFunc that parses the JWT in the request's
+// "Authorization: Bearer" header, verifies its signature and checks its
+// claims, as configured by cfg.
+//
+// The supported algorithms are HS256, HS384, HS512, RS256, PS256, ES256
+// and EdDSA (Ed25519). The token's claims are checked by the Claims
+// validators and passed to the OnClaims callback. They're also available
+// to the validators that follow BearerJWT in the same ValidateRequest call
+// (see JWTClaimsFromRequest), without modifying the request.
+//
+//	keys, err := vhttp.LoadJWKSFile("testdata/jwks.json")
+//	if err != nil {
+//		// ...
+//	}
+//	err = vhttp.ValidateRequest(req,
+//		vhttp.BearerJWT(vhttp.JWTConfig{
+//			Keys:   keys,
+//			Issuer: "https://auth.example.com",
+//		}),
+//		vhttp.JWTClaimIs("role", "admin"),
+//	)
+func BearerJWT(cfg JWTConfig) RequestFunc {
+	return func(req *http.Request) error {
+		target := headerTarget(HeaderAuthorization)
+		fail := func(code ErrorCode, err error) error {
+			return &ValidationError{
+				Target:    target,
+				Validator: "BearerJWT",
+				Code:      code,
+				Message:   "invalid bearer JWT: " + err.Error(),
+				Err:       err,
+			}
+		}
+
+		// Get the token
+		auth := req.Header.Get(HeaderAuthorization)
+		scheme, token, _ := strings.Cut(auth, " ")
+		if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			return validationErrorf(target, "BearerJWT", CodeMissing, nil, nil,
+				"expected a bearer token in the %q header", HeaderAuthorization)
+		}
+
+		// Parse and verify it
+		claims, err := cfg.verify(strings.TrimSpace(token))
+		if err != nil {
+			return fail(CodeInvalid, err)
+		}
+		if err := cfg.checkClaims(claims); err != nil {
+			var code ErrorCode = CodeMismatch
+			if errors.Is(err, errJWTTime) {
+				code = CodeOutOfRange
+			}
+			return fail(code, err)
+		}
+
+		// Run the custom validators
+		for _, v := range cfg.Claims {
+			if err := v(claims); err != nil {
+				return err
+			}
+		}
+		if h, ok := jwtClaimsHolders.Load(req); ok {
+			h.(*jwtClaimsHolder).set(claims)
+		}
+		if cfg.OnClaims != nil {
+			cfg.OnClaims(claims)
+		}
+		return nil
+	}
+}
+
+// errJWTTime is wrapped by errors for failed time-based claims.
+var errJWTTime = errors.New("token is not valid at this time")
+
+// verify parses the token and verifies its signature, returning
+// its claims.
+func (cfg JWTConfig) verify(token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected 3 parts, found %d", len(parts))
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := jwtDecodePart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	var claims JWTClaims
+	if err := jwtDecodePart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	// Is the algorithm allowed?
+	if len(cfg.Algorithms) > 0 {
+		allowed := false
+		for _, a := range cfg.Algorithms {
+			allowed = allowed || a == header.Alg
+		}
+		if !allowed {
+			return nil, fmt.Errorf("algorithm %q is not allowed", header.Alg)
+		}
+	}
+
+	// Try each matching key
+	signed := []byte(parts[0] + "." + parts[1])
+	found := false
+	for _, k := range cfg.Keys {
+		if (header.Kid != "" && k.ID != "" && k.ID != header.Kid) || (k.Algorithm != "" && k.Algorithm != header.Alg) {
+			continue
+		}
+		ok, err := jwtVerify(header.Alg, k.Key, signed, sig)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return claims, nil
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("no key found for algorithm %q and key ID %q", header.Alg, header.Kid)
+	}
+	return nil, fmt.Errorf("signature verification failed")
+}
+
+// jwtDecodePart decodes the base64url-encoded JSON part of a token into v.
+func jwtDecodePart(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// jwtVerify verifies the signature sig of signed using the algorithm alg
+// and the key. If the key can't be used with the algorithm, it returns
+// false and no error so that other keys can be tried.
+func jwtVerify(alg string, key any, signed, sig []byte) (bool, error) {
+	sum := func(h crypto.Hash) []byte {
+		hh := h.New()
+		hh.Write(signed)
+		return hh.Sum(nil)
+	}
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false, nil
+		}
+		var h func() hash.Hash
+		switch alg {
+		case "HS256":
+			h = sha256.New
+		case "HS384":
+			h = sha512.New384
+		default:
+			h = sha512.New
+		}
+		mac := hmac.New(h, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig), nil
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum(crypto.SHA256), sig) == nil, nil
+	case "PS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+		return rsa.VerifyPSS(pub, crypto.SHA256, sum(crypto.SHA256), sig, opts) == nil, nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return false, nil
+		}
+		if len(sig) != 64 {
+			return false, nil
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, sum(crypto.SHA256), r, s), nil
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		return ed25519.Verify(pub, signed, sig), nil
+	}
+	return false, fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+// checkClaims checks the registered claims.
+func (cfg JWTConfig) checkClaims(c JWTClaims) error {
+	now := time.Now
+	if cfg.Now != nil {
+		now = cfg.Now
+	}
+	t := now()
+
+	// Check the time-based claims
+	numericDate := func(k string) (time.Time, bool, error) {
+		v, ok := c[k]
+		if !ok {
+			return time.Time{}, false, nil
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return time.Time{}, false, fmt.Errorf("claim %q is not a numeric date", k)
+		}
+		sec, frac := int64(f), f-float64(int64(f))
+		return time.Unix(sec, int64(frac*1e9)), true, nil
+	}
+	exp, ok, err := numericDate("exp")
+	if err != nil {
+		return err
+	}
+	if !ok && cfg.RequireExpiration {
+		return fmt.Errorf("missing claim %q", "exp")
+	}
+	if ok && !t.Before(exp.Add(cfg.Leeway)) {
+		return fmt.Errorf("%w: token expired at %s", errJWTTime, exp.UTC().Format(time.RFC3339))
+	}
+	nbf, ok, err := numericDate("nbf")
+	if err != nil {
+		return err
+	}
+	if ok && t.Add(cfg.Leeway).Before(nbf) {
+		return fmt.Errorf("%w: token is not valid before %s", errJWTTime, nbf.UTC().Format(time.RFC3339))
+	}
+	iat, ok, err := numericDate("iat")
+	if err != nil {
+		return err
+	}
+	if ok && t.Add(cfg.Leeway).Before(iat) {
+		return fmt.Errorf("%w: token was issued in the future at %s", errJWTTime, iat.UTC().Format(time.RFC3339))
+	}
+
+	// Check the issuer
+	if cfg.Issuer != "" {
+		if iss, _ := c["iss"].(string); iss != cfg.Issuer {
+			return fmt.Errorf("expected issuer %q, found %q", cfg.Issuer, iss)
+		}
+	}
+
+	// Check the audience
+	if cfg.Audience != "" {
+		var auds []string
+		switch aud := c["aud"].(type) {
+		case string:
+			auds = []string{aud}
+		case []any:
+			for _, a := range aud {
+				if s, ok := a.(string); ok {
+					auds = append(auds, s)
+				}
+			}
+		}
+		found := false
+		for _, a := range auds {
+			found = found || a == cfg.Audience
+		}
+		if !found {
+			return fmt.Errorf("expected audience %q, found %q", cfg.Audience, auds)
+		}
+	}
+	return nil
+}
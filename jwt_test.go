@@ -0,0 +1,322 @@
+package vhttp_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-poor/vhttp"
+)
+
+// signJWT creates a JWT with the given header and claims, signed by sign.
+func signJWT(t *testing.T, header, claims map[string]any, sign func([]byte) []byte) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(header) + "." + enc(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestBearerJWT(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := []byte("super-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha := func(b []byte) []byte {
+		h := sha256.Sum256(b)
+		return h[:]
+	}
+	signers := map[string]func([]byte) []byte{
+		"HS256": func(b []byte) []byte {
+			m := hmac.New(sha256.New, secret)
+			m.Write(b)
+			return m.Sum(nil)
+		},
+		"RS256": func(b []byte) []byte {
+			s, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sha(b))
+			return s
+		},
+		"PS256": func(b []byte) []byte {
+			s, _ := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, sha(b), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			return s
+		},
+		"ES256": func(b []byte) []byte {
+			r, s, _ := ecdsa.Sign(rand.Reader, ecKey, sha(b))
+			return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		},
+		"EdDSA": func(b []byte) []byte {
+			return ed25519.Sign(edKey, b)
+		},
+	}
+
+	cfg := vhttp.JWTConfig{
+		Keys: []vhttp.JWTKey{
+			{ID: "hmac", Algorithm: "HS256", Key: secret},
+			{ID: "rsa", Key: &rsaKey.PublicKey},
+			{ID: "ec", Key: &ecKey.PublicKey},
+			{ID: "ed", Key: edPub},
+		},
+		Issuer:            "https://auth.example.com",
+		Audience:          "api",
+		RequireExpiration: true,
+		Leeway:            time.Minute,
+		Claims:            []vhttp.JWTClaimsValidator{vhttp.JWTClaimHas("sub")},
+		Now:               func() time.Time { return now },
+	}
+	claims := func(kvs ...any) map[string]any {
+		c := map[string]any{
+			"iss": "https://auth.example.com",
+			"aud": []string{"web", "api"},
+			"sub": "user-1",
+			"iat": now.Add(-time.Hour).Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for i := 0; i < len(kvs); i += 2 {
+			if kvs[i+1] == nil {
+				delete(c, kvs[i].(string))
+			} else {
+				c[kvs[i].(string)] = kvs[i+1]
+			}
+		}
+		return c
+	}
+
+	cases := []struct {
+		name   string           // Case name
+		alg    string           // Signing algorithm
+		kid    string           // Key ID header
+		claims map[string]any   // Token claims
+		auth   string           // Authorization header override
+		code   vhttp.ErrorCode  // Expected error code (empty for success)
+		cfg    *vhttp.JWTConfig // Config override
+	}{
+		{name: "hs256", alg: "HS256", kid: "hmac", claims: claims()},
+		{name: "rs256", alg: "RS256", kid: "rsa", claims: claims()},
+		{name: "ps256", alg: "PS256", kid: "rsa", claims: claims()},
+		{name: "es256", alg: "ES256", kid: "ec", claims: claims()},
+		{name: "eddsa-no-kid", alg: "EdDSA", claims: claims()},
+		{name: "string-audience", alg: "HS256", claims: claims("aud", "api")},
+		{name: "within-leeway", alg: "HS256", claims: claims("exp", now.Add(-30*time.Second).Unix())},
+		{name: "missing-header", auth: "-", code: vhttp.CodeMissing},
+		{name: "basic-auth", auth: "Basic dXNlcjpwYXNz", code: vhttp.CodeMissing},
+		{name: "malformed", auth: "Bearer abc.def", code: vhttp.CodeInvalid},
+		{name: "alg-none", auth: "Bearer eyJhbGciOiJub25lIn0.e30.", code: vhttp.CodeInvalid},
+		{name: "wrong-kid", alg: "HS256", kid: "rsa", claims: claims(), code: vhttp.CodeInvalid},
+		{name: "tampered", alg: "ES256", claims: claims(), auth: "tamper", code: vhttp.CodeInvalid},
+		{name: "expired", alg: "HS256", claims: claims("exp", now.Add(-2*time.Minute).Unix()), code: vhttp.CodeOutOfRange},
+		{name: "not-yet-valid", alg: "RS256", claims: claims("nbf", now.Add(5*time.Minute).Unix()), code: vhttp.CodeOutOfRange},
+		{name: "issued-in-future", alg: "RS256", claims: claims("iat", now.Add(5*time.Minute).Unix()), code: vhttp.CodeOutOfRange},
+		{name: "missing-exp", alg: "HS256", claims: claims("exp", nil), code: vhttp.CodeMismatch},
+		{name: "wrong-issuer", alg: "HS256", claims: claims("iss", "https://evil.example.com"), code: vhttp.CodeMismatch},
+		{name: "wrong-audience", alg: "HS256", claims: claims("aud", "web"), code: vhttp.CodeMismatch},
+		{name: "custom-claim", alg: "HS256", claims: claims("sub", nil), code: vhttp.CodeMissing},
+		{
+			name:   "disallowed-alg",
+			alg:    "RS256",
+			claims: claims(),
+			code:   vhttp.CodeInvalid,
+			cfg:    &vhttp.JWTConfig{Keys: cfg.Keys, Algorithms: []string{"ES256"}, Now: cfg.Now},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/me", nil)
+			switch {
+			case c.auth == "-":
+			case c.auth != "" && c.auth != "tamper":
+				req.Header.Set("Authorization", c.auth)
+			default:
+				h := map[string]any{"alg": c.alg, "typ": "JWT"}
+				if c.kid != "" {
+					h["kid"] = c.kid
+				}
+				tok := signJWT(t, h, c.claims, signers[c.alg])
+				if c.auth == "tamper" {
+					parts := strings.Split(tok, ".")
+					b, _ := json.Marshal(claims("sub", "admin"))
+					tok = parts[0] + "." + base64.RawURLEncoding.EncodeToString(b) + "." + parts[2]
+				}
+				req.Header.Set("Authorization", "Bearer "+tok)
+			}
+
+			vcfg := cfg
+			if c.cfg != nil {
+				vcfg = *c.cfg
+			}
+			var got vhttp.JWTClaims
+			vcfg.OnClaims = func(c vhttp.JWTClaims) { got = c }
+			orig := *req
+			err := vhttp.ValidateRequest(req, vhttp.BearerJWT(vcfg))
+			if req.Context() != orig.Context() {
+				t.Error("expected the request to be left unchanged")
+			}
+			if !checkErrCode(t, err, c.code) {
+				return
+			}
+			if c.code == "" && got["sub"] != "user-1" {
+				t.Errorf("expected OnClaims to be called with the claims, found %v", got)
+			}
+			if c.code != "" && got != nil {
+				t.Errorf("expected OnClaims not to be called, found %v", got)
+			}
+		})
+	}
+}
+
+func TestJWTClaimsValidator(t *testing.T) {
+	secret := []byte("secret")
+	tok := signJWT(t, map[string]any{"alg": "HS512"}, map[string]any{"role": "admin", "sub": "user-42", "n": 3}, func(b []byte) []byte {
+		h := hmac.New(sha512.New, secret)
+		h.Write(b)
+		return h.Sum(nil)
+	})
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/me", nil)
+
+	// No claims in the request context
+	if err := vhttp.ValidateRequest(req, vhttp.JWTClaimIs("role", "admin")); err == nil {
+		t.Error("expected an error without verified claims")
+	}
+
+	// Claims checked by BearerJWT
+	req.Header.Set("Authorization", "Bearer "+tok)
+	var claims vhttp.JWTClaims
+	err := vhttp.ValidateRequest(req, vhttp.BearerJWT(vhttp.JWTConfig{
+		Keys: []vhttp.JWTKey{{Key: secret}},
+		Claims: []vhttp.JWTClaimsValidator{
+			vhttp.JWTClaimIs("role", "admin"),
+			vhttp.JWTClaimIs("n", 3),
+			vhttp.JWTClaimMatches("sub", regexp.MustCompile(`^user-\d+$`)),
+		},
+		OnClaims: func(c vhttp.JWTClaims) { claims = c },
+	}))
+	if err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+
+	// Claims verified earlier in the same call
+	keys := []vhttp.JWTKey{{Key: secret}}
+	err = vhttp.ValidateRequest(req,
+		vhttp.BearerJWT(vhttp.JWTConfig{Keys: keys}),
+		vhttp.JWTClaimIs("role", "admin"),
+		vhttp.JWTClaimMatches("sub", regexp.MustCompile(`^user-\d+$`)),
+	)
+	if err != nil {
+		t.Errorf("expected no error, found %v", err)
+	}
+	err = vhttp.ValidateRequest(req, vhttp.BearerJWT(vhttp.JWTConfig{Keys: keys}), vhttp.JWTClaimIs("role", "user"))
+	if errs := vhttp.ValidationErrors(err); len(errs) != 1 || errs[0].Target != `jwt["role"]` {
+		t.Errorf("expected a single role claim error, found %v", err)
+	}
+	if _, ok := vhttp.JWTClaimsFromRequest(req); ok {
+		t.Error("expected the verified claims not to outlast the call")
+	}
+
+	// Claims added to the request's context
+	req = req.WithContext(vhttp.ContextWithJWTClaims(req.Context(), claims))
+	if got, ok := vhttp.JWTClaimsFromRequest(req); !ok || got["sub"] != "user-42" {
+		t.Errorf("expected claims in the request context, found %v", got)
+	}
+	if err := vhttp.ValidateRequest(req, vhttp.JWTClaimIs("role", "admin")); err != nil {
+		t.Errorf("expected no error, found %v", err)
+	}
+	err = vhttp.ValidateRequest(req, vhttp.JWTClaimIs("role", "user"), vhttp.JWTClaimHas("email"))
+	if n := len(vhttp.ValidationErrors(err)); n != 2 {
+		t.Errorf("expected 2 errors, found %d: %v", n, err)
+	}
+}
+
+func TestLoadJWKSFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]any{"keys": []map[string]any{
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+		{"kty": "oct", "kid": "hmac", "k": b64([]byte("secret"))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}}
+	b, _ := json.Marshal(jwks)
+	name := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(name, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := vhttp.LoadJWKSFile(name)
+	if err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+	if len(keys) != 4 {
+		t.Fatalf("expected 4 signing keys, found %d", len(keys))
+	}
+	if k, ok := keys[0].Key.(*rsa.PublicKey); !ok || !k.Equal(&rsaKey.PublicKey) || keys[0].Algorithm != "RS256" {
+		t.Errorf("unexpected RSA key %+v", keys[0])
+	}
+	if k, ok := keys[1].Key.(*ecdsa.PublicKey); !ok || !k.Equal(&ecKey.PublicKey) {
+		t.Errorf("unexpected EC key %+v", keys[1])
+	}
+	if k, ok := keys[2].Key.(ed25519.PublicKey); !ok || !k.Equal(edPub) {
+		t.Errorf("unexpected Ed25519 key %+v", keys[2])
+	}
+	if k, ok := keys[3].Key.([]byte); !ok || string(k) != "secret" || keys[3].ID != "hmac" {
+		t.Errorf("unexpected symmetric key %+v", keys[3])
+	}
+
+	for _, bad := range []string{
+		`{"keys":[{"kty":"EC","crv":"P-384","x":"AA","y":"AA"}]}`,
+		`{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`,
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"AQ"}]}`,
+		`{"keys":[{"kty":"RSA","n":"AQAB"}]}`,
+		`{"keys":[{"kty":"foo"}]}`,
+		`not json`,
+	} {
+		if _, err := vhttp.ParseJWKS([]byte(bad)); err == nil {
+			t.Errorf("expected an error parsing %s", bad)
+		}
+	}
+	if _, err := vhttp.LoadJWKSFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error loading a missing file")
+	}
+}
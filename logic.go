@@ -0,0 +1,356 @@
+package vhttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// inlineFormat is a multierror.ErrorFormatFunc that formats a list of errors
+// on a single line. It's used by the combinators so that a nested group of
+// errors still reads clearly when it's included in another error message.
+func inlineFormat(es []error) string {
+	ss := make([]string, len(es))
+	for i, err := range es {
+		ss[i] = err.Error()
+	}
+	return "[" + strings.Join(ss, "; ") + "]"
+}
+
+// All creates a validator that checks that all of the validators vs pass.
+//
+// All validators are run (it doesn't fail fast) and any errors are returned
+// as a multierror. This is the same behavior as the implicit AND used by
+// ValidateRequest and ValidateResponse but can be nested in other combinators.
+//
+//	v := vhttp.All(
+//		vhttp.HasHeaderAuthorization(),
+//		vhttp.HasHeaderContentType(),
+//	)
+func All[V ~func(T) error, T any](vs ...V) V {
+	return func(t T) error {
+		var merr *multierror.Error
+		for _, v := range vs {
+			if err := v(t); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+		if merr != nil {
+			merr.ErrorFormat = inlineFormat
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// Any creates a validator that checks that at least one of the validators
+// vs passes.
+//
+// If none of the validators pass, the returned error lists the error from
+// each branch (in order).
+//
+//	v := vhttp.Any(
+//		vhttp.HeaderAuthorizationMatchesBearer(),
+//		vhttp.HeaderAuthorizationMatchesBasic(),
+//	)
+func Any[V ~func(T) error, T any](vs ...V) V {
+	return func(t T) error {
+		var zero V
+		return anyOf(validatorTarget(zero, "value"), len(vs), func(i int) error { return vs[i](t) })
+	}
+}
+
+// Not creates a validator that inverts the validator v. It returns an error
+// if v passes and passes if v returns a validation error.
+//
+// If v returns an InternalError, that error is returned as-is, since it
+// doesn't say anything about the value being validated.
+//
+//	v := vhttp.Not(vhttp.HeaderMatches("X-Debug", regexp.MustCompile(`^true$`)))
+func Not[V ~func(T) error, T any](v V) V {
+	return func(t T) error {
+		return notOf(validatorTarget(v, "value"), v(t))
+	}
+}
+
+// Optional creates a validator that only runs the validators vs if the value
+// being validated is present. Empty values (an empty method or header set, a
+// nil URL or TLS connection state, a zero status code, an empty body, etc.)
+// always pass.
+//
+//	v := vhttp.Optional(vhttp.BodyIsValidJSON())
+func Optional[V ~func(T) error, T any](vs ...V) V {
+	return func(t T) error {
+		if isEmpty(t) {
+			return nil
+		}
+		return All(vs...)(t)
+	}
+}
+
+// When creates a validator that only runs the validators vs if the validator
+// cond passes. If cond returns an InternalError, that error is returned.
+//
+//	v := vhttp.When(
+//		vhttp.HasHeader("X-Request-Id"),
+//		vhttp.HeaderMatches("X-Request-Id", uuidRe),
+//	)
+func When[V ~func(T) error, T any](cond V, vs ...V) V {
+	return func(t T) error {
+		return whenOf(cond(t), true, func() error { return All(vs...)(t) })
+	}
+}
+
+// Unless creates a validator that only runs the validators vs if the
+// validator cond fails. If cond returns an InternalError, that error
+// is returned.
+//
+//	v := vhttp.Unless(vhttp.StatusIs(http.StatusNoContent), vhttp.StatusIsOK())
+func Unless[V ~func(T) error, T any](cond V, vs ...V) V {
+	return func(t T) error {
+		return whenOf(cond(t), false, func() error { return All(vs...)(t) })
+	}
+}
+
+// RequestAll creates a RequestValidator that checks that all of the
+// validators vs pass. See All for more details.
+func RequestAll(vs ...RequestValidator) RequestFunc {
+	return func(req *http.Request) error {
+		fs := make([]RequestFunc, len(vs))
+		for i, v := range vs {
+			fs[i] = v.ValidateRequest
+		}
+		return All(fs...)(req)
+	}
+}
+
+// RequestAny creates a RequestValidator that checks that at least one of
+// the validators vs passes. See Any for more details.
+//
+//	v := vhttp.RequestAny(
+//		vhttp.HeaderAuthorizationMatchesBearer(),
+//		vhttp.URLQueryHas("api_key"),
+//	)
+func RequestAny(vs ...RequestValidator) RequestFunc {
+	return func(req *http.Request) error {
+		return anyOf("request", len(vs), func(i int) error { return vs[i].ValidateRequest(req) })
+	}
+}
+
+// RequestNot creates a RequestValidator that inverts the validator v. See
+// Not for more details.
+func RequestNot(v RequestValidator) RequestFunc {
+	return func(req *http.Request) error {
+		return notOf(validatorTarget(v, "request"), v.ValidateRequest(req))
+	}
+}
+
+// RequestWhen creates a RequestValidator that only runs the validators vs
+// if the validator cond passes. See When for more details.
+//
+//	v := vhttp.RequestWhen(vhttp.MethodIsPost(), vhttp.HeaderContentTypeJSON())
+func RequestWhen(cond RequestValidator, vs ...RequestValidator) RequestFunc {
+	return func(req *http.Request) error {
+		return whenOf(cond.ValidateRequest(req), true, func() error {
+			return RequestAll(vs...)(req)
+		})
+	}
+}
+
+// RequestUnless creates a RequestValidator that only runs the validators vs
+// if the validator cond fails. See Unless for more details.
+func RequestUnless(cond RequestValidator, vs ...RequestValidator) RequestFunc {
+	return func(req *http.Request) error {
+		return whenOf(cond.ValidateRequest(req), false, func() error {
+			return RequestAll(vs...)(req)
+		})
+	}
+}
+
+// ResponseAll creates a ResponseValidator that checks that all of the
+// validators vs pass. See All for more details.
+func ResponseAll(vs ...ResponseValidator) ResponseFunc {
+	return func(res *http.Response) error {
+		fs := make([]ResponseFunc, len(vs))
+		for i, v := range vs {
+			fs[i] = v.ValidateResponse
+		}
+		return All(fs...)(res)
+	}
+}
+
+// ResponseAny creates a ResponseValidator that checks that at least one of
+// the validators vs passes. See Any for more details.
+func ResponseAny(vs ...ResponseValidator) ResponseFunc {
+	return func(res *http.Response) error {
+		return anyOf("response", len(vs), func(i int) error { return vs[i].ValidateResponse(res) })
+	}
+}
+
+// ResponseNot creates a ResponseValidator that inverts the validator v. See
+// Not for more details.
+func ResponseNot(v ResponseValidator) ResponseFunc {
+	return func(res *http.Response) error {
+		return notOf(validatorTarget(v, "response"), v.ValidateResponse(res))
+	}
+}
+
+// ResponseWhen creates a ResponseValidator that only runs the validators vs
+// if the validator cond passes. See When for more details.
+func ResponseWhen(cond ResponseValidator, vs ...ResponseValidator) ResponseFunc {
+	return func(res *http.Response) error {
+		return whenOf(cond.ValidateResponse(res), true, func() error {
+			return ResponseAll(vs...)(res)
+		})
+	}
+}
+
+// ResponseUnless creates a ResponseValidator that only runs the validators vs
+// if the validator cond fails. See Unless for more details.
+//
+//	v := vhttp.ResponseUnless(
+//		vhttp.StatusIs(http.StatusNoContent),
+//		vhttp.Any(vhttp.HeaderContentTypeJSON(), vhttp.HeaderContentTypeXML()),
+//	)
+func ResponseUnless(cond ResponseValidator, vs ...ResponseValidator) ResponseFunc {
+	return func(res *http.Response) error {
+		return whenOf(cond.ValidateResponse(res), false, func() error {
+			return ResponseAll(vs...)(res)
+		})
+	}
+}
+
+// validatorTarget returns the ValidationError Target for the part of a
+// request or response that the validator v checks, based on its type, or
+// def if the type isn't known.
+func validatorTarget(v any, def string) string {
+	switch v.(type) {
+	case MethodValidator:
+		return "method"
+	case URLValidator:
+		return "url"
+	case HeaderValidator:
+		return "header"
+	case BodyValidator, CachedBodyValidator, DecodedBodyValidator, StreamValidator:
+		return "body"
+	case StatusCodeValidator:
+		return "status"
+	case ProtoValidator, ProtoVersionValidator:
+		return "proto"
+	case ConnectionValidator:
+		return "connection"
+	case TLSValidator:
+		return "tls"
+	case CookieValidator:
+		return "cookie"
+	case SetCookieValidator:
+		return "set-cookie"
+	case FormValidator:
+		return "form"
+	case MultipartValidator:
+		return "multipart"
+	case JWTClaimsValidator:
+		return "jwt"
+	case RequestFunc:
+		return "request"
+	case ResponseFunc:
+		return "response"
+	}
+	return def
+}
+
+// anyOf runs the n validators (by index) with fn, stopping at the first
+// one to pass. If none of them pass, an error listing each branch's error
+// is returned.
+//
+// The error's Target is the branches' Target, if they all share one, or
+// target otherwise.
+func anyOf(target string, n int, fn func(i int) error) error {
+	if n == 0 {
+		return nil
+	}
+
+	var merr *multierror.Error
+	for i := 0; i < n; i++ {
+		err := fn(i)
+		if err == nil {
+			return nil // Found one!
+		}
+		merr = multierror.Append(merr, err)
+	}
+	merr.ErrorFormat = inlineFormat
+	if ts := branchTargets(merr); len(ts) == 1 {
+		target = ts[0]
+	}
+
+	// Wrap the errors so they aren't flattened into the
+	// parent's list of errors.
+	return &ValidationError{
+		Target:    target,
+		Validator: "Any",
+		Code:      CodeNonePassed,
+		Message:   fmt.Sprintf("expected at least one of %d validators to pass: %s", n, merr),
+		Err:       merr,
+	}
+}
+
+// branchTargets returns the distinct Targets of the ValidationErrors in
+// err, or nil if any of its errors isn't a ValidationError.
+func branchTargets(merr *multierror.Error) []string {
+	var ts []string
+	seen := map[string]bool{}
+	for _, err := range merr.Errors {
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			return nil
+		}
+		if !seen[verr.Target] {
+			seen[verr.Target] = true
+			ts = append(ts, verr.Target)
+		}
+	}
+	return ts
+}
+
+// notOf inverts the result of a validator that checks target.
+func notOf(target string, err error) error {
+	if err == nil {
+		return validationErrorf(target, "Not", CodeUnexpected, nil, nil,
+			"expected validator to fail")
+	}
+	var ierr InternalError
+	if errors.As(err, &ierr) {
+		return err
+	}
+	return nil
+}
+
+// whenOf runs fn if the condition's result (condErr) matches want (true
+// meaning cond passed).
+func whenOf(condErr error, want bool, fn func() error) error {
+	var ierr InternalError
+	if errors.As(condErr, &ierr) {
+		return InternalErr(fmt.Errorf("error evaluating condition: %w", condErr))
+	}
+	if (condErr == nil) != want {
+		return nil
+	}
+	return fn()
+}
+
+// isEmpty reports whether the value v should be treated as missing
+// by the Optional combinator.
+func isEmpty(v any) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
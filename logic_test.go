@@ -0,0 +1,444 @@
+package vhttp_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestAll(t *testing.T) {
+	cases := []struct {
+		name    string      // Case name
+		headers http.Header // Request's headers
+		isErr   bool        // Should an error be returned
+	}{
+		{
+			name: "all-pass",
+			headers: http.Header{
+				vhttp.HeaderContentType:   []string{"application/json"},
+				vhttp.HeaderAuthorization: []string{"Bearer abc"},
+			},
+			isErr: false,
+		},
+		{
+			name: "one-fails",
+			headers: http.Header{
+				vhttp.HeaderContentType: []string{"application/json"},
+			},
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := vhttp.All(
+				vhttp.HasHeaderContentType(),
+				vhttp.HasHeaderAuthorization(),
+			)
+			err := v(c.headers)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+
+	t.Run("no-validators", func(t *testing.T) {
+		if err := vhttp.All[vhttp.MethodValidator]()(http.MethodGet); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+}
+
+func TestAny(t *testing.T) {
+	cases := []struct {
+		name  string // Case name
+		auth  string // Authorization header value
+		isErr bool   // Should an error be returned
+	}{
+		{
+			name:  "bearer",
+			auth:  "Bearer abc",
+			isErr: false,
+		},
+		{
+			name:  "basic",
+			auth:  "Basic abc",
+			isErr: false,
+		},
+		{
+			name:  "neither",
+			auth:  "Digest abc",
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := vhttp.Any(
+				vhttp.HeaderAuthorizationMatchesBearer(),
+				vhttp.HeaderAuthorizationMatchesBasic(),
+			)
+			err := v(http.Header{vhttp.HeaderAuthorization: []string{c.auth}})
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+
+	t.Run("lists-each-branch", func(t *testing.T) {
+		v := vhttp.Any(vhttp.MethodIsGet(), vhttp.MethodIsPost())
+		err := v(http.MethodPut)
+		if err == nil {
+			t.Fatal("expected an error to be returned")
+		}
+		for _, s := range []string{`"GET"`, `"POST"`} {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("expected error %q to mention %s", err, s)
+			}
+		}
+	})
+
+	t.Run("target", func(t *testing.T) {
+		err := vhttp.Any(vhttp.MethodIsGet(), vhttp.MethodIsPost())(http.MethodPut)
+		if errs := vhttp.ValidationErrors(err); len(errs) != 1 || errs[0].Target != "method" {
+			t.Errorf("expected a single error with target %q, found %v", "method", errs)
+		}
+
+		// Branches checking different parts of the request
+		err = vhttp.RequestAny(vhttp.HeaderAuthorizationMatchesBearer(), vhttp.MethodIsGet())(&http.Request{Method: http.MethodPut, Header: http.Header{}})
+		if errs := vhttp.ValidationErrors(err); len(errs) != 1 || errs[0].Target != "request" {
+			t.Errorf("expected a single error with target %q, found %v", "request", errs)
+		}
+	})
+
+	t.Run("not-flattened", func(t *testing.T) {
+		req := &http.Request{Method: http.MethodPut}
+		err := vhttp.ValidateRequest(req,
+			vhttp.Any(vhttp.MethodIsGet(), vhttp.MethodIsPost()),
+			vhttp.MethodIsDelete(),
+		)
+		if err == nil {
+			t.Fatal("expected an error to be returned")
+		}
+		if !strings.HasPrefix(err.Error(), "2 errors occurred") {
+			t.Errorf("expected two top-level errors, got %q", err)
+		}
+	})
+}
+
+func TestNot(t *testing.T) {
+	re := regexp.MustCompile(`^true$`)
+	cases := []struct {
+		name  string // Case name
+		value string // X-Debug header value
+		isErr bool   // Should an error be returned
+	}{
+		{
+			name:  "inner-fails",
+			value: "false",
+			isErr: false,
+		},
+		{
+			name:  "inner-passes",
+			value: "true",
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := vhttp.Not(vhttp.HeaderMatches("X-Debug", re))
+			err := v(http.Header{"X-Debug": []string{c.value}})
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+
+	t.Run("internal-error", func(t *testing.T) {
+		v := vhttp.Not(vhttp.URLValidator(func(*url.URL) error {
+			return vhttp.InternalErr(errors.New("oops"))
+		}))
+		err := v(nil)
+		var ierr vhttp.InternalError
+		if !errors.As(err, &ierr) {
+			t.Errorf("expected an InternalError to be returned, got %v", err)
+		}
+	})
+
+	t.Run("wrapped-internal-error", func(t *testing.T) {
+		v := vhttp.Not(vhttp.URLValidator(func(*url.URL) error {
+			return fmt.Errorf("checking url: %w", vhttp.InternalErr(errors.New("oops")))
+		}))
+		err := v(nil)
+		var ierr vhttp.InternalError
+		if !errors.As(err, &ierr) {
+			t.Errorf("expected an InternalError to be returned, got %v", err)
+		}
+	})
+
+	t.Run("target", func(t *testing.T) {
+		cases := []struct {
+			name   string // Case name
+			err    error  // Error returned by the inverted validator
+			target string // Expected target
+		}{
+			{"method", vhttp.Not(vhttp.MethodIsGet())(http.MethodGet), "method"},
+			{"header", vhttp.Not(vhttp.HasHeader("X-Debug"))(http.Header{"X-Debug": {"1"}}), "header"},
+			{"request", vhttp.RequestNot(vhttp.RequestFunc(func(*http.Request) error { return nil }))(&http.Request{}), "request"},
+			{"response", vhttp.ResponseNot(vhttp.StatusIs(http.StatusOK))(&http.Response{StatusCode: http.StatusOK}), "status"},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				errs := vhttp.ValidationErrors(c.err)
+				if len(errs) != 1 || errs[0].Target != c.target {
+					t.Errorf("expected a single error with target %q, found %v", c.target, errs)
+				}
+			})
+		}
+	})
+}
+
+func TestOptional(t *testing.T) {
+	cases := []struct {
+		name  string // Case name
+		body  []byte // Body to validate
+		isErr bool   // Should an error be returned
+	}{
+		{
+			name:  "nil",
+			body:  nil,
+			isErr: false,
+		},
+		{
+			name:  "empty",
+			body:  []byte{},
+			isErr: false,
+		},
+		{
+			name:  "valid",
+			body:  []byte(`{"a":1}`),
+			isErr: false,
+		},
+		{
+			name:  "invalid",
+			body:  []byte(`{{{`),
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := vhttp.Optional(vhttp.BodyIsValidJSON())(c.body)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+}
+
+func TestWhenUnless(t *testing.T) {
+	cases := []struct {
+		name        string // Case name
+		status      int    // Response status code
+		whenIsErr   bool   // Should When return an error
+		unlessIsErr bool   // Should Unless return an error
+	}{
+		{
+			name:        "no-content",
+			status:      http.StatusNoContent,
+			whenIsErr:   true,
+			unlessIsErr: false,
+		},
+		{
+			name:        "ok",
+			status:      http.StatusOK,
+			whenIsErr:   false,
+			unlessIsErr: false,
+		},
+		{
+			name:        "not-found",
+			status:      http.StatusNotFound,
+			whenIsErr:   false,
+			unlessIsErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cond := vhttp.StatusIs(http.StatusNoContent)
+			check := vhttp.StatusIsOK()
+
+			err := vhttp.When(cond, check)(c.status)
+			if (err != nil) != c.whenIsErr {
+				t.Errorf("When: expected error=%t, got %v", c.whenIsErr, err)
+			}
+
+			err = vhttp.Unless(cond, check)(c.status)
+			if (err != nil) != c.unlessIsErr {
+				t.Errorf("Unless: expected error=%t, got %v", c.unlessIsErr, err)
+			}
+		})
+	}
+}
+
+func TestRequestCombinators(t *testing.T) {
+	req := &http.Request{
+		Method: http.MethodPost,
+		Header: http.Header{
+			vhttp.HeaderAuthorization: []string{"Basic abc"},
+		},
+	}
+
+	cases := []struct {
+		name  string                 // Case name
+		v     vhttp.RequestValidator // Validator to run
+		isErr bool                   // Should an error be returned
+	}{
+		{
+			name:  "all-pass",
+			v:     vhttp.RequestAll(vhttp.MethodIsPost(), vhttp.HasHeaderAuthorization()),
+			isErr: false,
+		},
+		{
+			name:  "all-fail",
+			v:     vhttp.RequestAll(vhttp.MethodIsPost(), vhttp.HasHeaderContentType()),
+			isErr: true,
+		},
+		{
+			name:  "any-pass",
+			v:     vhttp.RequestAny(vhttp.HeaderAuthorizationMatchesBearer(), vhttp.MethodIsPost()),
+			isErr: false,
+		},
+		{
+			name:  "any-fail",
+			v:     vhttp.RequestAny(vhttp.HeaderAuthorizationMatchesBearer(), vhttp.MethodIsGet()),
+			isErr: true,
+		},
+		{
+			name:  "not-pass",
+			v:     vhttp.RequestNot(vhttp.MethodIsGet()),
+			isErr: false,
+		},
+		{
+			name:  "not-fail",
+			v:     vhttp.RequestNot(vhttp.MethodIsPost()),
+			isErr: true,
+		},
+		{
+			name:  "when-runs",
+			v:     vhttp.RequestWhen(vhttp.MethodIsPost(), vhttp.HasHeaderContentType()),
+			isErr: true,
+		},
+		{
+			name:  "when-skips",
+			v:     vhttp.RequestWhen(vhttp.MethodIsGet(), vhttp.HasHeaderContentType()),
+			isErr: false,
+		},
+		{
+			name:  "unless-runs",
+			v:     vhttp.RequestUnless(vhttp.MethodIsGet(), vhttp.HasHeaderContentType()),
+			isErr: true,
+		},
+		{
+			name:  "unless-skips",
+			v:     vhttp.RequestUnless(vhttp.MethodIsPost(), vhttp.HasHeaderContentType()),
+			isErr: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.v.ValidateRequest(req)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+}
+
+func TestResponseCombinators(t *testing.T) {
+	cases := []struct {
+		name   string // Case name
+		status int    // Response status code
+		ct     string // Response Content-Type
+		isErr  bool   // Should an error be returned
+	}{
+		{
+			name:   "json",
+			status: http.StatusOK,
+			ct:     vhttp.MimeJSON,
+			isErr:  false,
+		},
+		{
+			name:   "xml",
+			status: http.StatusOK,
+			ct:     vhttp.MimeXML,
+			isErr:  false,
+		},
+		{
+			name:   "html",
+			status: http.StatusOK,
+			ct:     vhttp.MimeHTML,
+			isErr:  true,
+		},
+		{
+			name:   "no-content",
+			status: http.StatusNoContent,
+			ct:     "",
+			isErr:  false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &http.Response{
+				StatusCode: c.status,
+				Header:     http.Header{},
+			}
+			if c.ct != "" {
+				res.Header.Set(vhttp.HeaderContentType, c.ct)
+			}
+
+			err := vhttp.ValidateResponse(res,
+				vhttp.ResponseUnless(
+					vhttp.StatusIs(http.StatusNoContent),
+					vhttp.Any(vhttp.HeaderContentTypeJSON(), vhttp.HeaderContentTypeXML()),
+				),
+			)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Errorf("expected an error to be returned")
+			}
+		})
+	}
+}
+
+func ExampleAny() {
+	// Either bearer or basic authentication is allowed...
+	v := vhttp.Any(
+		vhttp.HeaderAuthorizationMatchesBearer(),
+		vhttp.HeaderAuthorizationMatchesBasic(),
+	)
+
+	err := v(http.Header{vhttp.HeaderAuthorization: []string{"Digest abc"}})
+	fmt.Println(err)
+	// Output:
+	// expected at least one of 2 validators to pass: [expected header "Authorization" to match "^Bearer .+$"; expected header "Authorization" to match "^Basic .+$"]
+}
@@ -0,0 +1,386 @@
+package vhttp
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaType is a parsed media type (eg "application/json; charset=utf-8")
+// or media type pattern (eg "application/*+json").
+type MediaType struct {
+	// Type is the top-level type (eg "application"), in lower case.
+	Type string
+
+	// Subtype is the subtype (eg "json" or "vnd.api+json"), in lower case.
+	Subtype string
+
+	// Params are the media type's parameters, with their names in
+	// lower case.
+	Params map[string]string
+}
+
+// ParseMediaType parses the media type s using mime.ParseMediaType.
+func ParseMediaType(s string) (MediaType, error) {
+	mt, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return MediaType{}, err
+	}
+	t, st, ok := strings.Cut(mt, "/")
+	if !ok || t == "" || st == "" {
+		return MediaType{}, fmt.Errorf("mime: expected type/subtype, found %q", mt)
+	}
+	return MediaType{Type: t, Subtype: st, Params: params}, nil
+}
+
+// String returns the formatted media type.
+func (m MediaType) String() string {
+	return mime.FormatMediaType(m.Type+"/"+m.Subtype, m.Params)
+}
+
+// Suffix returns the media type's structured syntax suffix (eg "json" for
+// "application/vnd.api+json") or an empty string if it doesn't have one.
+func (m MediaType) Suffix() string {
+	if i := strings.LastIndexByte(m.Subtype, '+'); i >= 0 {
+		return m.Subtype[i+1:]
+	}
+	return ""
+}
+
+// Match reports if the media type t matches m, treating m as a pattern.
+//
+// The pattern's type and subtype can be wildcards ("*/*" or
+// "application/*") and its subtype can be a structured syntax suffix
+// wildcard (eg "application/*+json", which matches
+// "application/vnd.api+json" but not "application/json"). Each of the
+// pattern's parameters must be present in t with the same value. The
+// values of the "charset" parameter are compared case-insensitively.
+func (m MediaType) Match(t MediaType) bool {
+	// Compare the type and subtype
+	switch {
+	case m.Type == "*" && m.Subtype == "*":
+	case m.Type != t.Type:
+		return false
+	case m.Subtype == "*":
+	case strings.HasPrefix(m.Subtype, "*+"):
+		if t.Suffix() != m.Subtype[2:] {
+			return false
+		}
+	case m.Subtype != t.Subtype:
+		return false
+	}
+
+	// Compare the parameters
+	for k, v := range m.Params {
+		tv, ok := t.Params[k]
+		if !ok {
+			return false
+		}
+		if k == "charset" {
+			if !strings.EqualFold(v, tv) {
+				return false
+			}
+		} else if v != tv {
+			return false
+		}
+	}
+	return true
+}
+
+// specificity ranks how specific the pattern m is, for choosing between
+// the ranges of an Accept header that match the same media type.
+func (m MediaType) specificity() int {
+	switch {
+	case m.Type == "*":
+		return 0
+	case m.Subtype == "*":
+		return 1
+	case strings.HasPrefix(m.Subtype, "*+"):
+		return 2
+	}
+	return 3 + len(m.Params)
+}
+
+// MediaRange is a media range from an Accept header, along with its
+// quality value.
+type MediaRange struct {
+	MediaType
+
+	// Q is the quality value (the "q" parameter), between 0 and 1.
+	// Defaults to 1.
+	Q float64
+}
+
+// ParseAccept parses the value of an Accept header into its media ranges,
+// ordered from most to least preferred. Ranges with the same quality
+// value are ordered from most to least specific.
+//
+// The "q" parameter is removed from each range's parameters, along with
+// any accept-extension parameters that follow it.
+func ParseAccept(s string) ([]MediaRange, error) {
+	var rs []MediaRange
+	for _, part := range splitHeaderList(s) {
+		// Split off the quality value and any extensions
+		params := strings.Split(part, ";")
+		q := 1.0
+		for i := 1; i < len(params); i++ {
+			k, v, _ := strings.Cut(params[i], "=")
+			if strings.EqualFold(strings.TrimSpace(k), "q") {
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil || f < 0 || f > 1 {
+					return nil, fmt.Errorf("invalid quality value in media range %q", part)
+				}
+				q, params = f, params[:i]
+				break
+			}
+		}
+
+		// Parse the media range
+		mt, err := ParseMediaType(strings.Join(params, ";"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid media range %q: %w", part, err)
+		}
+		if mt.Type == "*" && mt.Subtype != "*" {
+			return nil, fmt.Errorf("invalid media range %q", part)
+		}
+		rs = append(rs, MediaRange{MediaType: mt, Q: q})
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		if rs[i].Q != rs[j].Q {
+			return rs[i].Q > rs[j].Q
+		}
+		return rs[i].specificity() > rs[j].specificity()
+	})
+	return rs, nil
+}
+
+// AcceptQuality returns the quality value that the media ranges rs assign
+// to the media type t (the quality value of the most specific matching
+// range) or 0 if no range matches.
+func AcceptQuality(rs []MediaRange, t MediaType) float64 {
+	best, q := -1, 0.0
+	for _, r := range rs {
+		if s := r.specificity(); r.Match(t) && s > best {
+			best, q = s, r.Q
+		}
+	}
+	return q
+}
+
+// splitHeaderList splits a comma-separated header value, ignoring commas
+// in quoted strings and skipping empty elements.
+func splitHeaderList(s string) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, s[start:])
+
+	out := parts[:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// isJSONMediaType reports if the media type mt is JSON (ie
+// "application/json" or a type with the "+json" suffix).
+func isJSONMediaType(mt string) bool {
+	if i := strings.IndexByte(mt, ';'); i >= 0 {
+		mt = mt[:i]
+	}
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	return mt == MimeJSON || strings.HasSuffix(mt, "+json")
+}
+
+// contentTypeValidator creates a HeaderValidator (named name) that parses
+// the "Content-Type" header and runs fn on the media type.
+func contentTypeValidator(name string, fn func(ct string, mt MediaType) error) HeaderValidator {
+	return func(hs http.Header) error {
+		target := headerTarget(HeaderContentType)
+		ct := hs.Get(HeaderContentType)
+		if ct == "" {
+			return validationErrorf(target, name, CodeMissing, nil, nil,
+				"header %q not found", HeaderContentType)
+		}
+		mt, err := ParseMediaType(ct)
+		if err != nil {
+			return &ValidationError{
+				Target:    target,
+				Validator: name,
+				Code:      CodeInvalid,
+				Actual:    ct,
+				Message:   fmt.Sprintf("invalid content type %q: %s", ct, err),
+				Err:       err,
+			}
+		}
+		return fn(ct, mt)
+	}
+}
+
+// ContentTypeIs creates a HeaderValidator that checks that the media type
+// in the "Content-Type" header matches at least one of the patterns ps
+// (see MediaType.Match).
+//
+// Unlike HeaderContentTypeIs, parameters are ignored unless they're
+// included in the pattern.
+//
+//	v := vhttp.ContentTypeIs("application/json", "application/*+json")
+//	v := vhttp.ContentTypeIs("text/plain; charset=utf-8")
+func ContentTypeIs(ps ...string) HeaderValidator {
+	// Parse the patterns
+	pats := make([]MediaType, len(ps))
+	for i, p := range ps {
+		mt, err := ParseMediaType(p)
+		if err != nil {
+			return func(http.Header) error {
+				return InternalErr(fmt.Errorf("invalid media type pattern %q: %w", p, err))
+			}
+		}
+		pats[i] = mt
+	}
+
+	return contentTypeValidator("ContentTypeIs", func(ct string, mt MediaType) error {
+		for _, p := range pats {
+			if p.Match(mt) {
+				return nil
+			}
+		}
+		if len(ps) == 1 {
+			return validationErrorf(headerTarget(HeaderContentType), "ContentTypeIs", CodeMismatch, ps, ct,
+				"expected content type %q, found %q", ps[0], ct)
+		}
+		return validationErrorf(headerTarget(HeaderContentType), "ContentTypeIs", CodeMismatch, ps, ct,
+			"expected content type to be one of %q, found %q", ps, ct)
+	})
+}
+
+// ContentTypeIsJSON creates a HeaderValidator that checks that the media
+// type in the "Content-Type" header is "application/json" or a JSON-based
+// type with the "+json" suffix (eg "application/problem+json").
+func ContentTypeIsJSON() HeaderValidator {
+	return ContentTypeIs(MimeJSON, "application/*+json")
+}
+
+// ContentTypeHasParam creates a HeaderValidator that checks that the
+// "Content-Type" header has the parameter p (eg "boundary").
+func ContentTypeHasParam(p string) HeaderValidator {
+	p = strings.ToLower(p)
+	return contentTypeValidator("ContentTypeHasParam", func(ct string, mt MediaType) error {
+		if _, ok := mt.Params[p]; !ok {
+			return validationErrorf(headerTarget(HeaderContentType), "ContentTypeHasParam", CodeMissing, p, ct,
+				"expected content type %q to have parameter %q", ct, p)
+		}
+		return nil
+	})
+}
+
+// ContentTypeParamIs creates a HeaderValidator that checks that the
+// "Content-Type" header has the parameter p with the value v. The values
+// of the "charset" parameter are compared case-insensitively.
+//
+//	v := vhttp.ContentTypeParamIs("charset", "utf-8")
+func ContentTypeParamIs(p, v string) HeaderValidator {
+	p = strings.ToLower(p)
+	return contentTypeValidator("ContentTypeParamIs", func(ct string, mt MediaType) error {
+		got, ok := mt.Params[p]
+		if !ok {
+			return validationErrorf(headerTarget(HeaderContentType), "ContentTypeParamIs", CodeMissing, v, nil,
+				"expected content type %q to have parameter %q", ct, p)
+		}
+		if got != v && !(p == "charset" && strings.EqualFold(got, v)) {
+			return validationErrorf(headerTarget(HeaderContentType), "ContentTypeParamIs", CodeMismatch, v, got,
+				"expected content type parameter %q to be %q, found %q", p, v, got)
+		}
+		return nil
+	})
+}
+
+// AcceptsMediaType creates a HeaderValidator that checks that the
+// "Accept" header accepts the media type t (ie that the most specific
+// media range matching t has a non-zero quality value).
+//
+// As per RFC 9110, a missing "Accept" header accepts any media type.
+func AcceptsMediaType(t string) HeaderValidator {
+	mt, err := ParseMediaType(t)
+	if err != nil {
+		return func(http.Header) error {
+			return InternalErr(fmt.Errorf("invalid media type %q: %w", t, err))
+		}
+	}
+	return func(hs http.Header) error {
+		ok, err := acceptsMediaType(hs, "AcceptsMediaType", mt)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return validationErrorf(headerTarget(HeaderAccept), "AcceptsMediaType", CodeUnexpected, t, hs.Values(HeaderAccept),
+				"expected Accept header to accept %q", t)
+		}
+		return nil
+	}
+}
+
+// ResponseContentTypeAccepted creates a ResponseFunc that checks that the
+// media type in the response's "Content-Type" header is accepted by the
+// "Accept" header of the response's request (the http.Response's Request
+// field).
+func ResponseContentTypeAccepted() ResponseFunc {
+	return func(res *http.Response) error {
+		if res.Request == nil {
+			return InternalErr(fmt.Errorf("response has no request to check the Accept header of"))
+		}
+		return contentTypeValidator("ResponseContentTypeAccepted", func(ct string, mt MediaType) error {
+			ok, err := acceptsMediaType(res.Request.Header, "ResponseContentTypeAccepted", mt)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return validationErrorf(headerTarget(HeaderContentType), "ResponseContentTypeAccepted", CodeUnexpected,
+					res.Request.Header.Values(HeaderAccept), ct,
+					"response content type %q is not accepted by the request's Accept header", ct)
+			}
+			return nil
+		})(res.Header)
+	}
+}
+
+// acceptsMediaType reports if the "Accept" headers in hs accept the
+// media type mt.
+func acceptsMediaType(hs http.Header, validator string, mt MediaType) (bool, error) {
+	vals := hs.Values(HeaderAccept)
+	if len(vals) == 0 {
+		return true, nil
+	}
+	accept := strings.Join(vals, ",")
+	rs, err := ParseAccept(accept)
+	if err != nil {
+		return false, &ValidationError{
+			Target:    headerTarget(HeaderAccept),
+			Validator: validator,
+			Code:      CodeInvalid,
+			Actual:    accept,
+			Message:   fmt.Sprintf("invalid Accept header %q: %s", accept, err),
+			Err:       err,
+		}
+	}
+	return AcceptQuality(rs, mt) > 0, nil
+}
@@ -0,0 +1,170 @@
+package vhttp_test
+
+import (
+	"mime"
+	"net/http"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestMediaTypeMatch(t *testing.T) {
+	cases := []struct {
+		pattern string // Media type pattern
+		mt      string // Media type to match
+		match   bool   // Should the pattern match
+	}{
+		{"application/json", "application/json", true},
+		{"application/json", "Application/JSON; charset=utf-8", true},
+		{"application/json", "application/xml", false},
+		{"*/*", "image/png", true},
+		{"image/*", "image/png", true},
+		{"image/*", "text/png", false},
+		{"application/*+json", "application/problem+json", true},
+		{"application/*+json", "application/json", false},
+		{"application/*+json", "application/vnd.api+xml", false},
+		{"text/plain; charset=utf-8", "text/plain; charset=UTF-8", true},
+		{"text/plain; charset=utf-8", "text/plain", false},
+		{"multipart/form-data; boundary=abc", "multipart/form-data; boundary=ABC", false},
+	}
+	for _, c := range cases {
+		t.Run(c.pattern+"|"+c.mt, func(t *testing.T) {
+			p, err := vhttp.ParseMediaType(c.pattern)
+			if err != nil {
+				t.Fatalf("failed to parse pattern: %s", err)
+			}
+			mt, err := vhttp.ParseMediaType(c.mt)
+			if err != nil {
+				t.Fatalf("failed to parse media type: %s", err)
+			}
+			if got := p.Match(mt); got != c.match {
+				t.Errorf("expected match to be %t, found %t", c.match, got)
+			}
+		})
+	}
+}
+
+func TestParseAccept(t *testing.T) {
+	rs, err := vhttp.ParseAccept(`text/*;q=0.3, text/html;q=0.7, text/html;level=1, text/html;level=2;q=0.4, */*;q=0.5`)
+	if err != nil {
+		t.Fatalf("failed to parse Accept: %s", err)
+	}
+	order := []string{"text/html; level=1", "text/html", "*/*", "text/html; level=2", "text/*"}
+	if len(rs) != len(order) {
+		t.Fatalf("expected %d ranges, found %d", len(order), len(rs))
+	}
+	for i, r := range rs {
+		if r.String() != order[i] {
+			t.Errorf("range %d: expected %q, found %q", i, order[i], r.String())
+		}
+	}
+
+	// The example from RFC 9110, section 12.5.1
+	quality := map[string]float64{
+		"text/html;level=1": 1,
+		"text/html":         0.7,
+		"text/plain":        0.3,
+		"image/jpeg":        0.5,
+		"text/html;level=2": 0.4,
+		"text/html;level=3": 0.7,
+	}
+	for s, want := range quality {
+		mt, _ := vhttp.ParseMediaType(s)
+		if got := vhttp.AcceptQuality(rs, mt); got != want {
+			t.Errorf("expected quality %v for %q, found %v", want, s, got)
+		}
+	}
+
+	// Invalid values
+	for _, s := range []string{"text/html;q=2", "text", "*/html"} {
+		if _, err := vhttp.ParseAccept(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestContentTypeValidators(t *testing.T) {
+	cases := []struct {
+		name  string                // Case name
+		ct    string                // Content-Type header
+		v     vhttp.HeaderValidator // Validator to run
+		isErr bool                  // Should an error be returned
+	}{
+		{"is-success", "application/json; charset=utf-8", vhttp.ContentTypeIs(vhttp.MimeJSON), false},
+		{"is-any-success", "text/html", vhttp.ContentTypeIs(vhttp.MimeJSON, "text/*"), false},
+		{"is-mismatch", "text/html", vhttp.ContentTypeIs(vhttp.MimeJSON), true},
+		{"is-missing", "", vhttp.ContentTypeIs(vhttp.MimeJSON), true},
+		{"is-invalid", "application/", vhttp.ContentTypeIs(vhttp.MimeJSON), true},
+		{"is-bad-pattern", "text/html", vhttp.ContentTypeIs("text/"), true},
+		{"json-success", "application/problem+json", vhttp.ContentTypeIsJSON(), false},
+		{"json-mismatch", "application/xml", vhttp.ContentTypeIsJSON(), true},
+		{"has-param-success", "multipart/form-data; boundary=abc", vhttp.ContentTypeHasParam("boundary"), false},
+		{"has-param-missing", "multipart/form-data", vhttp.ContentTypeHasParam("boundary"), true},
+		{"param-is-success", "text/plain; charset=UTF-8", vhttp.ContentTypeParamIs("charset", "utf-8"), false},
+		{"param-is-mismatch", "text/plain; charset=latin1", vhttp.ContentTypeParamIs("charset", "utf-8"), true},
+		{"param-is-missing", "text/plain", vhttp.ContentTypeParamIs("charset", "utf-8"), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hs := http.Header{}
+			if c.ct != "" {
+				hs.Set(vhttp.HeaderContentType, c.ct)
+			}
+			err := c.v(hs)
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error returned: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Error("expected an error to be returned")
+			}
+		})
+	}
+}
+
+func TestAcceptValidators(t *testing.T) {
+	cases := []struct {
+		name   string // Case name
+		accept string // Request's Accept header
+		ct     string // Response's Content-Type header
+		isErr  bool   // Should an error be returned
+	}{
+		{"no-accept", "", "text/html", false},
+		{"exact", "application/json", "application/json; charset=utf-8", false},
+		{"wildcard", "text/*, application/json;q=0.5", "text/csv", false},
+		{"suffix", "application/*+json", "application/problem+json", false},
+		{"not-accepted", "application/json, text/*", "image/png", true},
+		{"zero-quality", "*/*, image/png;q=0", "image/png", true},
+		{"invalid-accept", "text/html;q=abc", "text/html", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := &http.Request{Header: http.Header{}}
+			if c.accept != "" {
+				req.Header.Set(vhttp.HeaderAccept, c.accept)
+			}
+			res := &http.Response{
+				Header:  http.Header{vhttp.HeaderContentType: []string{c.ct}},
+				Request: req,
+			}
+
+			// Check the response
+			err := vhttp.ValidateResponse(res, vhttp.ResponseContentTypeAccepted())
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error returned: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Error("expected an error to be returned")
+			}
+
+			// Check the request
+			mt, _, _ := mime.ParseMediaType(c.ct)
+			err = vhttp.ValidateRequest(req, vhttp.AcceptsMediaType(mt))
+			if err != nil && !c.isErr {
+				t.Errorf("unexpected error returned: %s", err)
+			}
+			if err == nil && c.isErr {
+				t.Error("expected an error to be returned")
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package vhttp
 
 import (
-	"fmt"
 	"net/http"
 )
 
@@ -17,7 +16,8 @@ func (v MethodValidator) ValidateRequest(req *http.Request) error {
 func MethodIs(s string) MethodValidator {
 	return func(m string) error {
 		if m != s {
-			return fmt.Errorf("expected method %q, found %q", s, m)
+			return validationErrorf("method", "MethodIs", CodeMismatch, s, m,
+				"expected method %q, found %q", s, m)
 		}
 		return nil
 	}
@@ -28,7 +28,8 @@ func MethodIs(s string) MethodValidator {
 func MethodIsNot(s string) MethodValidator {
 	return func(m string) error {
 		if m == s {
-			return fmt.Errorf("expected method %q, found %q", s, m)
+			return validationErrorf("method", "MethodIsNot", CodeUnexpected, s, m,
+				"expected method %q, found %q", s, m)
 		}
 		return nil
 	}
@@ -0,0 +1,182 @@
+package vhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// MimeProblemJSON is the media type of RFC 7807 problem details documents.
+const MimeProblemJSON = "application/problem+json"
+
+// Middleware creates an http.Handler that validates each request against
+// the validators vs before passing it on to next.
+//
+// If a request fails validation, next isn't called and a 400 Bad Request
+// response (or a 500 Internal Server Error response, if any of the errors
+// is an InternalError) is written with an RFC 7807 problem details body
+// listing each failure. See MiddlewareConfig to change this behavior.
+//
+// Any validators that read the request's body leave it readable for next.
+//
+//	h := vhttp.Middleware(mux,
+//		vhttp.HeaderAuthorizationMatchesBearer(),
+//		vhttp.BodyIsValidJSON(),
+//	)
+func Middleware(next http.Handler, vs ...RequestValidator) http.Handler {
+	return MiddlewareConfig{}.Wrap(next, vs...)
+}
+
+// MiddlewareConfig configures how requests that fail validation are
+// handled by a validation middleware. The zero value uses the same
+// defaults as Middleware.
+type MiddlewareConfig struct {
+	// Status is the status code of the response written when a request
+	// fails validation. Defaults to 400 Bad Request.
+	Status int
+
+	// InternalStatus is the status code of the response written when a
+	// validator returns an InternalError. Defaults to 500 Internal
+	// Server Error.
+	InternalStatus int
+
+	// Render writes the response for a request that failed validation with
+	// the error err. Defaults to RenderProblem.
+	Render func(w http.ResponseWriter, req *http.Request, status int, err error)
+
+	// OnError, if set, is called with each request that fails validation
+	// (eg for logging) before the response is written.
+	OnError func(req *http.Request, err error)
+}
+
+// Wrap creates an http.Handler that validates each request against the
+// validators vs before passing it on to next, using the configuration c.
+func (c MiddlewareConfig) Wrap(next http.Handler, vs ...RequestValidator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Validate the request
+		err := ValidateRequest(req, vs...)
+		if err == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		// Call the error hook
+		if c.OnError != nil {
+			c.OnError(req, err)
+		}
+
+		// Write the error response
+		status := c.Status
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		var ierr InternalError
+		if errors.As(err, &ierr) {
+			status = c.InternalStatus
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+		}
+		render := c.Render
+		if render == nil {
+			render = RenderProblem
+		}
+		render(w, req, status, err)
+	})
+}
+
+// Problem is an RFC 7807 problem details document describing why a
+// request failed validation.
+type Problem struct {
+	// Type is a URI reference identifying the problem type.
+	Type string `json:"type"`
+
+	// Title is a short summary of the problem type.
+	Title string `json:"title"`
+
+	// Status is the response's status code.
+	Status int `json:"status"`
+
+	// Detail is an explanation specific to this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+
+	// Instance is a URI reference identifying this occurrence of the
+	// problem (the request's path).
+	Instance string `json:"instance,omitempty"`
+
+	// Errors lists each of the validation failures.
+	Errors []ProblemError `json:"errors,omitempty"`
+}
+
+// ProblemError describes a single validation failure in a Problem.
+type ProblemError struct {
+	// Detail is the error message.
+	Detail string `json:"detail"`
+
+	// Target is the ValidationError's Target, if available.
+	Target string `json:"target,omitempty"`
+
+	// Validator is the ValidationError's Validator, if available.
+	Validator string `json:"validator,omitempty"`
+
+	// Code is the ValidationError's Code, if available.
+	Code ErrorCode `json:"code,omitempty"`
+}
+
+// NewProblem creates a Problem describing the validation error err for
+// the request req, responded to with the status code status.
+//
+// Each error combined in err (see ValidateRequest) is listed separately.
+// If status is 500 or above, the errors are omitted so that internal
+// error messages aren't exposed.
+func NewProblem(req *http.Request, status int, err error) *Problem {
+	p := &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: "the request failed validation",
+	}
+	if req != nil && req.URL != nil {
+		p.Instance = req.URL.Path
+	}
+	if status >= 500 {
+		p.Detail = "an internal error occurred while validating the request"
+		return p
+	}
+
+	// List the errors
+	errs := []error{err}
+	if merr, ok := err.(*multierror.Error); ok {
+		errs = merr.Errors
+	}
+	for _, err := range errs {
+		pe := ProblemError{Detail: err.Error()}
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			pe.Target = verr.Target
+			pe.Validator = verr.Validator
+			pe.Code = verr.Code
+		}
+		p.Errors = append(p.Errors, pe)
+	}
+	return p
+}
+
+// RenderProblem writes an application/problem+json response, created
+// with NewProblem, for the request req that failed validation with
+// the error err.
+//
+// It's the default renderer used by Middleware.
+func RenderProblem(w http.ResponseWriter, req *http.Request, status int, err error) {
+	b, merr := json.Marshal(NewProblem(req, status, err))
+	if merr != nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set(HeaderContentType, MimeProblemJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(b)
+}
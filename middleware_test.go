@@ -0,0 +1,120 @@
+package vhttp_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestMiddleware(t *testing.T) {
+	internal := vhttp.RequestFunc(func(req *http.Request) error {
+		return vhttp.InternalErr(errors.New("database is down"))
+	})
+	cases := []struct {
+		name   string                   // Case name
+		method string                   // Request method
+		body   string                   // Request body
+		vs     []vhttp.RequestValidator // Validators to run
+		status int                      // Expected status code
+		codes  []vhttp.ErrorCode        // Expected error codes in the problem body
+	}{
+		{
+			name:   "success",
+			method: http.MethodPost,
+			body:   `{"name":"Austin"}`,
+			vs:     []vhttp.RequestValidator{vhttp.MethodIsPost(), vhttp.BodyIsValidJSON()},
+			status: http.StatusOK,
+		},
+		{
+			name:   "bad-request",
+			method: http.MethodGet,
+			body:   `{"name":`,
+			vs:     []vhttp.RequestValidator{vhttp.MethodIsPost(), vhttp.BodyIsValidJSON()},
+			status: http.StatusBadRequest,
+			codes:  []vhttp.ErrorCode{vhttp.CodeMismatch, vhttp.CodeInvalid},
+		},
+		{
+			name:   "internal-error",
+			method: http.MethodGet,
+			body:   "",
+			vs:     []vhttp.RequestValidator{vhttp.MethodIsPost(), internal},
+			status: http.StatusInternalServerError,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// Create a handler that echoes the body
+			h := vhttp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				io.Copy(w, req.Body)
+			}), c.vs...)
+
+			req := httptest.NewRequest(c.method, "/users", strings.NewReader(c.body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != c.status {
+				t.Fatalf("expected status %d, found %d", c.status, rec.Code)
+			}
+
+			// Was the body left readable?
+			if c.status == http.StatusOK {
+				if rec.Body.String() != c.body {
+					t.Errorf("expected handler to read body %q, found %q", c.body, rec.Body.String())
+				}
+				return
+			}
+
+			// Check the problem details
+			if ct := rec.Header().Get(vhttp.HeaderContentType); ct != vhttp.MimeProblemJSON {
+				t.Errorf("expected content type %q, found %q", vhttp.MimeProblemJSON, ct)
+			}
+			var p vhttp.Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatalf("failed to decode problem body: %s", err)
+			}
+			if p.Status != c.status || p.Instance != "/users" {
+				t.Errorf("unexpected problem: %+v", p)
+			}
+			if len(p.Errors) != len(c.codes) {
+				t.Fatalf("expected %d errors, found %d: %+v", len(c.codes), len(p.Errors), p.Errors)
+			}
+			for i, e := range p.Errors {
+				if e.Code != c.codes[i] {
+					t.Errorf("error %d: expected code %q, found %q", i, c.codes[i], e.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareConfig(t *testing.T) {
+	var logged error
+	h := vhttp.MiddlewareConfig{
+		Status: http.StatusUnprocessableEntity,
+		Render: func(w http.ResponseWriter, req *http.Request, status int, err error) {
+			http.Error(w, "invalid request", status)
+		},
+		OnError: func(req *http.Request, err error) {
+			logged = err
+		},
+	}.Wrap(http.NotFoundHandler(), vhttp.MethodIsPost())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, found %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != "invalid request" {
+		t.Errorf("expected custom body, found %q", got)
+	}
+	if logged == nil {
+		t.Error("expected the error hook to be called")
+	}
+}
@@ -0,0 +1,228 @@
+package vhttp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// MTLSPolicy authorizes requests by the client certificate presented
+// over mutual TLS.
+//
+// Identity patterns (in SPIFFEIDs, DNSNames, EmailAddresses and
+// MTLSPermission's Identity) are matched using path.Match, so "*" matches
+// any sequence of characters other than "/" (eg
+// "spiffe://example.org/ns/*/sa/web" or "*.example.com").
+//
+// Each non-empty allow-list must be matched by the certificate.
+type MTLSPolicy struct {
+	// SPIFFEIDs are the allowed SPIFFE IDs (the certificate's "spiffe"
+	// URI SAN).
+	SPIFFEIDs []string
+
+	// DNSNames are the allowed DNS SANs. At least one of the
+	// certificate's DNS names must match.
+	DNSNames []string
+
+	// EmailAddresses are the allowed email SANs. At least one of the
+	// certificate's email addresses must match.
+	EmailAddresses []string
+
+	// Organizations are the allowed subject organizations (O).
+	Organizations []string
+
+	// OrganizationalUnits are the allowed subject organizational
+	// units (OU).
+	OrganizationalUnits []string
+
+	// Fingerprints pins certificates by the hex-encoded SHA-256 hash of
+	// their DER encoding (colons are ignored).
+	Fingerprints []string
+
+	// SPKIHashes pins certificates by the base64-encoded SHA-256 hash of
+	// their subject public key info (optionally prefixed with "sha256/").
+	SPKIHashes []string
+
+	// Permissions, if set, are the only identity, route and method
+	// combinations allowed (see RequestValidator).
+	Permissions []MTLSPermission
+}
+
+// MTLSPermission allows an identity to make requests to a route.
+type MTLSPermission struct {
+	// Identity is a pattern matched against the certificate's SPIFFE ID,
+	// DNS names, email addresses and subject common name.
+	Identity string
+
+	// PathPrefix is the prefix of the allowed request paths. It's matched
+	// against the cleaned request path (see path.Clean) on whole segments,
+	// so "/invoices" allows "/invoices" and "/invoices/1" but not
+	// "/invoices-admin". An empty prefix allows any path.
+	PathPrefix string
+
+	// Methods are the allowed request methods. If empty, any method is
+	// allowed.
+	Methods []string
+}
+
+// mtlsIdentity returns a readable identity for the certificate, for use
+// in error messages: its SPIFFE ID, DNS name, email address or subject
+// common name (whichever is found first).
+func mtlsIdentity(cert *x509.Certificate) string {
+	if id := spiffeID(cert); id != "" {
+		return id
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	return cert.Subject.String()
+}
+
+// spiffeID returns the certificate's SPIFFE ID, if it has one.
+func spiffeID(cert *x509.Certificate) string {
+	for _, u := range cert.URIs {
+		if strings.EqualFold(u.Scheme, "spiffe") {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+// mtlsMatchAny reports whether any of vs match any of the patterns.
+func mtlsMatchAny(patterns, vs []string) bool {
+	for _, p := range patterns {
+		for _, v := range vs {
+			if ok, _ := path.Match(p, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TLSValidator creates a TLSValidator that checks the client certificate
+// against the policy's allow-lists and pins. Permissions are only checked
+// by RequestValidator.
+func (p MTLSPolicy) TLSValidator() TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer("MTLSPolicy", cs)
+		if err != nil {
+			return err
+		}
+		id := mtlsIdentity(cert)
+		fail := func(target string, expected, actual any, format string, args ...any) error {
+			return validationErrorf(target, "MTLSPolicy", CodeNoMatch, expected, actual,
+				"client certificate %q: "+format, append([]any{id}, args...)...)
+		}
+
+		// Check the identities
+		if len(p.SPIFFEIDs) > 0 {
+			sid := spiffeID(cert)
+			if sid == "" {
+				return validationErrorf("tls.peer.san", "MTLSPolicy", CodeMissing, p.SPIFFEIDs, nil,
+					"client certificate %q has no SPIFFE ID", id)
+			}
+			if !mtlsMatchAny(p.SPIFFEIDs, []string{sid}) {
+				return fail("tls.peer.san", p.SPIFFEIDs, sid, "SPIFFE ID %q is not allowed", sid)
+			}
+		}
+		if len(p.DNSNames) > 0 && !mtlsMatchAny(p.DNSNames, cert.DNSNames) {
+			return fail("tls.peer.san", p.DNSNames, cert.DNSNames, "DNS names %q are not allowed", cert.DNSNames)
+		}
+		if len(p.EmailAddresses) > 0 && !mtlsMatchAny(p.EmailAddresses, cert.EmailAddresses) {
+			return fail("tls.peer.san", p.EmailAddresses, cert.EmailAddresses, "email addresses %q are not allowed", cert.EmailAddresses)
+		}
+		if len(p.Organizations) > 0 && !mtlsMatchAny(p.Organizations, cert.Subject.Organization) {
+			return fail("tls.peer.subject", p.Organizations, cert.Subject.Organization, "organizations %q are not allowed", cert.Subject.Organization)
+		}
+		if len(p.OrganizationalUnits) > 0 && !mtlsMatchAny(p.OrganizationalUnits, cert.Subject.OrganizationalUnit) {
+			return fail("tls.peer.subject", p.OrganizationalUnits, cert.Subject.OrganizationalUnit, "organizational units %q are not allowed", cert.Subject.OrganizationalUnit)
+		}
+
+		// Check the pins
+		if len(p.Fingerprints) > 0 || len(p.SPKIHashes) > 0 {
+			fp := sha256.Sum256(cert.Raw)
+			spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			fpHex, spkiB64 := hex.EncodeToString(fp[:]), base64.StdEncoding.EncodeToString(spki[:])
+			pinned := false
+			for _, f := range p.Fingerprints {
+				pinned = pinned || strings.EqualFold(strings.ReplaceAll(f, ":", ""), fpHex)
+			}
+			for _, h := range p.SPKIHashes {
+				pinned = pinned || strings.TrimPrefix(h, "sha256/") == spkiB64
+			}
+			if !pinned {
+				return validationErrorf("tls.peer.public_key", "MTLSPolicy", CodeMismatch, nil, fpHex,
+					"client certificate %q (SHA-256 fingerprint %s) doesn't match any pin", id, fpHex)
+			}
+		}
+		return nil
+	}
+}
+
+// RequestValidator creates a RequestFunc that checks the request's client
+// certificate with the policy's TLSValidator and, if the policy has
+// Permissions, that one of them allows the certificate's identity to make
+// a request with the request's method and path.
+func (p MTLSPolicy) RequestValidator() RequestFunc {
+	check := p.TLSValidator()
+	return func(req *http.Request) error {
+		if err := check(req.TLS); err != nil {
+			return err
+		}
+		if len(p.Permissions) == 0 {
+			return nil
+		}
+
+		// Get the certificate's identities
+		cert := req.TLS.PeerCertificates[0]
+		ids := append([]string{}, cert.DNSNames...)
+		ids = append(ids, cert.EmailAddresses...)
+		if sid := spiffeID(cert); sid != "" {
+			ids = append(ids, sid)
+		}
+		if cert.Subject.CommonName != "" {
+			ids = append(ids, cert.Subject.CommonName)
+		}
+
+		// Find a matching permission
+		var pth string
+		if req.URL != nil {
+			pth = req.URL.Path
+		}
+		for _, perm := range p.Permissions {
+			if !mtlsMatchAny([]string{perm.Identity}, ids) || !mtlsPathHasPrefix(pth, perm.PathPrefix) {
+				continue
+			}
+			if len(perm.Methods) == 0 {
+				return nil
+			}
+			for _, m := range perm.Methods {
+				if strings.EqualFold(m, req.Method) {
+					return nil
+				}
+			}
+		}
+		return validationErrorf("tls.peer", "MTLSPolicy", CodeNoMatch, nil, mtlsIdentity(cert),
+			"client certificate %q is not allowed to %s %s", mtlsIdentity(cert), req.Method, pth)
+	}
+}
+
+// mtlsPathHasPrefix reports whether the cleaned path pth is prefix or is
+// below it.
+func mtlsPathHasPrefix(pth, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	pth = path.Clean("/" + pth)
+	prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+	return pth == prefix || strings.HasPrefix(pth, prefix+"/")
+}
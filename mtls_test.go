@@ -0,0 +1,161 @@
+package vhttp_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestMTLSPolicy(t *testing.T) {
+	ca, caKey := newTestCA(t, "Mesh CA")
+	spiffe, _ := url.Parse("spiffe://example.org/ns/prod/sa/billing")
+	svc, _ := newTestCert(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "billing", Organization: []string{"Example"}, OrganizationalUnit: []string{"Payments"}},
+		URIs:     []*url.URL{spiffe},
+		DNSNames: []string{"billing.prod.svc"},
+	}, ca, caKey)
+	user, _ := newTestCert(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice"},
+		EmailAddresses: []string{"alice@example.com"},
+	}, ca, caKey)
+
+	fp := sha256.Sum256(svc.Raw)
+	var fpHex []string
+	for _, b := range fp {
+		fpHex = append(fpHex, fmt.Sprintf("%02X", b))
+	}
+	spki := sha256.Sum256(svc.RawSubjectPublicKeyInfo)
+
+	cases := []struct {
+		name   string            // Case name
+		policy vhttp.MTLSPolicy  // Policy to check
+		cert   *x509.Certificate // Client certificate (nil for none)
+		method string            // Request method
+		path   string            // Request path
+		code   vhttp.ErrorCode   // Expected error code (empty for success)
+	}{
+		{name: "spiffe", policy: vhttp.MTLSPolicy{SPIFFEIDs: []string{"spiffe://example.org/ns/*/sa/billing"}}, cert: svc},
+		{name: "spiffe-fail", policy: vhttp.MTLSPolicy{SPIFFEIDs: []string{"spiffe://example.org/ns/dev/sa/*"}}, cert: svc, code: vhttp.CodeNoMatch},
+		{name: "spiffe-missing", policy: vhttp.MTLSPolicy{SPIFFEIDs: []string{"spiffe://example.org/*"}}, cert: user, code: vhttp.CodeMissing},
+		{name: "dns", policy: vhttp.MTLSPolicy{DNSNames: []string{"*.prod.svc"}}, cert: svc},
+		{name: "dns-fail", policy: vhttp.MTLSPolicy{DNSNames: []string{"*.dev.svc"}}, cert: svc, code: vhttp.CodeNoMatch},
+		{name: "email", policy: vhttp.MTLSPolicy{EmailAddresses: []string{"*@example.com"}}, cert: user},
+		{name: "email-fail", policy: vhttp.MTLSPolicy{EmailAddresses: []string{"*@example.com"}}, cert: svc, code: vhttp.CodeNoMatch},
+		{name: "org-ou", policy: vhttp.MTLSPolicy{Organizations: []string{"Example"}, OrganizationalUnits: []string{"Payments", "Ops"}}, cert: svc},
+		{name: "ou-fail", policy: vhttp.MTLSPolicy{OrganizationalUnits: []string{"Ops"}}, cert: svc, code: vhttp.CodeNoMatch},
+		{name: "fingerprint", policy: vhttp.MTLSPolicy{Fingerprints: []string{strings.Join(fpHex, ":")}}, cert: svc},
+		{name: "spki", policy: vhttp.MTLSPolicy{SPKIHashes: []string{"sha256/" + base64.StdEncoding.EncodeToString(spki[:])}}, cert: svc},
+		{name: "pin-fail", policy: vhttp.MTLSPolicy{Fingerprints: []string{strings.Join(fpHex, "")}}, cert: user, code: vhttp.CodeMismatch},
+		{name: "no-cert", policy: vhttp.MTLSPolicy{}, code: vhttp.CodeMissing},
+		{
+			name: "permission",
+			policy: vhttp.MTLSPolicy{Permissions: []vhttp.MTLSPermission{
+				{Identity: "spiffe://example.org/ns/prod/sa/billing", PathPrefix: "/invoices", Methods: []string{"GET", "POST"}},
+				{Identity: "*@example.com", PathPrefix: "/invoices"},
+			}},
+			cert:   svc,
+			method: http.MethodPost,
+			path:   "/invoices/1",
+		},
+		{
+			name: "permission-any-method",
+			policy: vhttp.MTLSPolicy{Permissions: []vhttp.MTLSPermission{
+				{Identity: "spiffe://example.org/ns/prod/sa/billing", PathPrefix: "/invoices", Methods: []string{"GET"}},
+				{Identity: "*@example.com", PathPrefix: "/invoices"},
+			}},
+			cert:   user,
+			method: http.MethodDelete,
+			path:   "/invoices/1",
+		},
+		{
+			name: "permission-method-fail",
+			policy: vhttp.MTLSPolicy{Permissions: []vhttp.MTLSPermission{
+				{Identity: "billing", Methods: []string{"GET"}},
+			}},
+			cert:   svc,
+			method: http.MethodDelete,
+			path:   "/invoices/1",
+			code:   vhttp.CodeNoMatch,
+		},
+		{
+			name: "permission-path-fail",
+			policy: vhttp.MTLSPolicy{Permissions: []vhttp.MTLSPermission{
+				{Identity: "billing.prod.svc", PathPrefix: "/invoices"},
+			}},
+			cert:   svc,
+			method: http.MethodGet,
+			path:   "/admin",
+			code:   vhttp.CodeNoMatch,
+		},
+		{
+			name: "permission-path-sibling-fail",
+			policy: vhttp.MTLSPolicy{Permissions: []vhttp.MTLSPermission{
+				{Identity: "billing.prod.svc", PathPrefix: "/invoices"},
+			}},
+			cert:   svc,
+			method: http.MethodGet,
+			path:   "/invoices-admin",
+			code:   vhttp.CodeNoMatch,
+		},
+		{
+			name: "permission-path-traversal-fail",
+			policy: vhttp.MTLSPolicy{Permissions: []vhttp.MTLSPermission{
+				{Identity: "billing.prod.svc", PathPrefix: "/invoices"},
+			}},
+			cert:   svc,
+			method: http.MethodGet,
+			path:   "/invoices/../admin",
+			code:   vhttp.CodeNoMatch,
+		},
+		{
+			name: "permission-path-exact",
+			policy: vhttp.MTLSPolicy{Permissions: []vhttp.MTLSPermission{
+				{Identity: "billing.prod.svc", PathPrefix: "/invoices/"},
+			}},
+			cert:   svc,
+			method: http.MethodGet,
+			path:   "/invoices",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			method := c.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, _ := http.NewRequest(method, "https://api.example.com"+c.path, nil)
+			req.TLS = &tls.ConnectionState{}
+			if c.cert != nil {
+				req.TLS.PeerCertificates = []*x509.Certificate{c.cert}
+			}
+			err := vhttp.ValidateRequest(req, c.policy.RequestValidator())
+			if c.code == "" {
+				checkErrCode(t, err, "")
+				return
+			}
+			if !checkErrCode(t, err, c.code) {
+				return
+			}
+			id := "alice@example.com"
+			if c.cert == svc {
+				id = spiffe.String()
+			}
+			if c.cert != nil && !strings.Contains(err.Error(), id) {
+				t.Errorf("expected the error to name the presented identity, found %v", err)
+			}
+		})
+	}
+
+	// Nil-safe without TLS
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+	checkErrCode(t, vhttp.ValidateRequest(req, vhttp.MTLSPolicy{}.RequestValidator()), vhttp.CodeMissing)
+}
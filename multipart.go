@@ -0,0 +1,235 @@
+package vhttp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// MimeMultipartForm is the media type of multipart form bodies.
+const MimeMultipartForm = "multipart/form-data"
+
+// MultipartMaxMemory is the maximum number of bytes of a multipart body's
+// files that are stored in memory when the body is parsed by a
+// MultipartValidator. The rest are stored in temporary files, which are
+// removed once validation is complete.
+var MultipartMaxMemory int64 = 32 << 20
+
+// MultipartValidator is a validator that validates the multipart form in
+// an http.Request object's body.
+//
+// The body is parsed using the boundary from the request's Content-Type,
+// which must be "multipart/form-data". The body is left readable for later
+// validators and handlers.
+type MultipartValidator func(*multipart.Form) error
+
+func (v MultipartValidator) ValidateRequest(req *http.Request) error {
+	// Get the boundary from the content type
+	ct := req.Header.Get(HeaderContentType)
+	mt, params, err := mime.ParseMediaType(ct)
+	if err != nil || mt != MimeMultipartForm {
+		return validationErrorf(headerTarget(HeaderContentType), "MultipartValidator", CodeMismatch, MimeMultipartForm, ct,
+			"expected content type %q, found %q", MimeMultipartForm, ct)
+	}
+	if params["boundary"] == "" {
+		return validationErrorf(headerTarget(HeaderContentType), "MultipartValidator", CodeMissing, nil, ct,
+			"multipart content type %q has no boundary", ct)
+	}
+
+	// Read and parse the body
+	b, err := readRequestBody(req)
+	if err != nil {
+		return bodyReadErr("failed to read request body", err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(b), params["boundary"]).ReadForm(MultipartMaxMemory)
+	if err != nil {
+		return &ValidationError{
+			Target:    "body",
+			Validator: "MultipartValidator",
+			Code:      CodeInvalid,
+			Message:   fmt.Sprintf("body is not a valid multipart form: %s", err),
+			Err:       err,
+		}
+	}
+	defer form.RemoveAll()
+	return v(form)
+}
+
+// multipartTarget returns the ValidationError target for the multipart
+// field k.
+func multipartTarget(k string) string {
+	return fmt.Sprintf("multipart[%q]", k)
+}
+
+// MultipartHasField creates a MultipartValidator that checks that the form
+// contains a (non-file) value for the field k.
+func MultipartHasField(k string) MultipartValidator {
+	return func(f *multipart.Form) error {
+		if _, ok := f.Value[k]; !ok {
+			return validationErrorf(multipartTarget(k), "MultipartHasField", CodeMissing, nil, nil,
+				"expected value for multipart field %q to be present", k)
+		}
+		return nil
+	}
+}
+
+// MultipartFieldIs creates a MultipartValidator that checks that the form
+// contains the field k with the value v.
+func MultipartFieldIs(k, v string) MultipartValidator {
+	return func(f *multipart.Form) error {
+		for _, s := range f.Value[k] {
+			if s == v {
+				return nil
+			}
+		}
+		return validationErrorf(multipartTarget(k), "MultipartFieldIs", CodeMismatch, v, f.Value[k],
+			"expected at least one value for multipart field %q to be %q", k, v)
+	}
+}
+
+// MultipartFieldMatches creates a MultipartValidator that checks that the
+// form contains the field k with a value that matches the regular
+// expression re.
+func MultipartFieldMatches(k string, re *regexp.Regexp) MultipartValidator {
+	return func(f *multipart.Form) error {
+		for _, s := range f.Value[k] {
+			if re.MatchString(s) {
+				return nil
+			}
+		}
+		return validationErrorf(multipartTarget(k), "MultipartFieldMatches", CodeNoMatch, re.String(), f.Value[k],
+			"expected at least one value for multipart field %q to match %q", k, re)
+	}
+}
+
+// MultipartHasFile creates a MultipartValidator that checks that the form
+// contains at least one file for the field k.
+func MultipartHasFile(k string) MultipartValidator {
+	return func(f *multipart.Form) error {
+		if len(f.File[k]) == 0 {
+			return validationErrorf(multipartTarget(k), "MultipartHasFile", CodeMissing, nil, nil,
+				"expected a file for multipart field %q to be present", k)
+		}
+		return nil
+	}
+}
+
+// MultipartFileCount creates a MultipartValidator that checks that the
+// number of files for the field k is between min and max (inclusive).
+func MultipartFileCount(k string, min, max int) MultipartValidator {
+	return func(f *multipart.Form) error {
+		if n := len(f.File[k]); n < min || n > max {
+			return validationErrorf(multipartTarget(k), "MultipartFileCount", CodeOutOfRange, [2]int{min, max}, n,
+				"expected between %d and %d files for multipart field %q, found %d", min, max, k, n)
+		}
+		return nil
+	}
+}
+
+// MultipartFileMaxSize creates a MultipartValidator that checks that each
+// file for the field k is at most n bytes.
+func MultipartFileMaxSize(k string, n int64) MultipartValidator {
+	return multipartEachFile(k, "MultipartFileMaxSize", func(fh *multipart.FileHeader) error {
+		if fh.Size > n {
+			return validationErrorf(multipartTarget(k), "MultipartFileMaxSize", CodeOutOfRange, n, fh.Size,
+				"expected file %q in multipart field %q to be at most %d bytes, found %d", fh.Filename, k, n, fh.Size)
+		}
+		return nil
+	})
+}
+
+// MultipartFilenameMatches creates a MultipartValidator that checks that
+// the filename of each file for the field k matches the regular
+// expression re.
+func MultipartFilenameMatches(k string, re *regexp.Regexp) MultipartValidator {
+	return multipartEachFile(k, "MultipartFilenameMatches", func(fh *multipart.FileHeader) error {
+		if !re.MatchString(fh.Filename) {
+			return validationErrorf(multipartTarget(k), "MultipartFilenameMatches", CodeNoMatch, re.String(), fh.Filename,
+				"expected filename %q in multipart field %q to match %q", fh.Filename, k, re)
+		}
+		return nil
+	})
+}
+
+// MultipartFileContentTypeIs creates a MultipartValidator that checks that
+// the Content-Type declared by each file part for the field k is one of
+// the media types ts. Parameters (eg "charset") are ignored.
+func MultipartFileContentTypeIs(k string, ts ...string) MultipartValidator {
+	return multipartEachFile(k, "MultipartFileContentTypeIs", func(fh *multipart.FileHeader) error {
+		ct := fh.Header.Get(HeaderContentType)
+		if !mediaTypeIn(ct, ts) {
+			return validationErrorf(multipartTarget(k), "MultipartFileContentTypeIs", CodeMismatch, ts, ct,
+				"expected file %q in multipart field %q to have content type %q, found %q", fh.Filename, k, ts, ct)
+		}
+		return nil
+	})
+}
+
+// MultipartFileDetectedTypeIs creates a MultipartValidator that uses the
+// http.DetectContentType function to guess the content type of each file
+// for the field k and checks that it's one of the media types ts.
+// Parameters (eg "charset") are ignored.
+func MultipartFileDetectedTypeIs(k string, ts ...string) MultipartValidator {
+	return multipartEachFile(k, "MultipartFileDetectedTypeIs", func(fh *multipart.FileHeader) error {
+		// Read the start of the file
+		f, err := fh.Open()
+		if err != nil {
+			return InternalErr(fmt.Errorf("failed to open file %q: %w", fh.Filename, err))
+		}
+		defer f.Close()
+		b := make([]byte, 512)
+		n, err := io.ReadFull(f, b)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return InternalErr(fmt.Errorf("failed to read file %q: %w", fh.Filename, err))
+		}
+
+		// Detect the content type
+		ct := http.DetectContentType(b[:n])
+		if !mediaTypeIn(ct, ts) {
+			return validationErrorf(multipartTarget(k), "MultipartFileDetectedTypeIs", CodeMismatch, ts, ct,
+				"expected file %q in multipart field %q to have detected type %q, found %q", fh.Filename, k, ts, ct)
+		}
+		return nil
+	})
+}
+
+// multipartEachFile creates a MultipartValidator (named name) that checks
+// that the form has at least one file for the field k and runs fn on each
+// of them.
+func multipartEachFile(k, name string, fn func(*multipart.FileHeader) error) MultipartValidator {
+	return func(f *multipart.Form) error {
+		fhs := f.File[k]
+		if len(fhs) == 0 {
+			return validationErrorf(multipartTarget(k), name, CodeMissing, nil, nil,
+				"expected a file for multipart field %q to be present", k)
+		}
+		var merr *multierror.Error
+		for _, fh := range fhs {
+			if err := fn(fh); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// mediaTypeIn reports if the media type of the content type ct (ignoring
+// its parameters) is one of the media types ts.
+func mediaTypeIn(ct string, ts []string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	for _, t := range ts {
+		if tt, _, err := mime.ParseMediaType(t); err == nil && tt == mt {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package vhttp_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+// newMultipartRequest creates a request with a multipart form body
+// containing a "title" field and an "image" field with a PNG file and
+// a text file (declared as a PNG).
+func newMultipartRequest(t *testing.T) (*http.Request, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("title", "My Photos")
+
+	files := []struct {
+		name string
+		ct   string
+		data []byte
+	}{
+		{"photo.png", vhttp.MimeImagePNG, append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 100)...)},
+		{"notes.txt", vhttp.MimeImagePNG, []byte("these are not really a PNG")},
+	}
+	for _, f := range files {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="image"; filename=%q`, f.name))
+		h.Set("Content-Type", f.ct)
+		pw, err := w.CreatePart(h)
+		if err != nil {
+			t.Fatalf("failed to create part: %s", err)
+		}
+		pw.Write(f.data)
+	}
+	w.Close()
+
+	req := newBodyRequest(buf.String())
+	req.Method = http.MethodPost
+	req.Header.Set(vhttp.HeaderContentType, w.FormDataContentType())
+	return req, buf.Bytes()
+}
+
+func TestMultipartValidators(t *testing.T) {
+	cases := []struct {
+		name  string                   // Case name
+		v     vhttp.MultipartValidator // Validator to run
+		nErrs int                      // Number of errors expected
+	}{
+		{"has-field-success", vhttp.MultipartHasField("title"), 0},
+		{"has-field-missing", vhttp.MultipartHasField("description"), 1},
+		{"field-is-success", vhttp.MultipartFieldIs("title", "My Photos"), 0},
+		{"field-is-mismatch", vhttp.MultipartFieldIs("title", "Your Photos"), 1},
+		{"field-matches-success", vhttp.MultipartFieldMatches("title", regexp.MustCompile(`^My `)), 0},
+		{"field-matches-no-match", vhttp.MultipartFieldMatches("title", regexp.MustCompile(`^Your `)), 1},
+		{"has-file-success", vhttp.MultipartHasFile("image"), 0},
+		{"has-file-missing", vhttp.MultipartHasFile("title"), 1},
+		{"file-count-success", vhttp.MultipartFileCount("image", 1, 2), 0},
+		{"file-count-too-many", vhttp.MultipartFileCount("image", 1, 1), 1},
+		{"file-max-size-success", vhttp.MultipartFileMaxSize("image", 1024), 0},
+		{"file-max-size-too-large", vhttp.MultipartFileMaxSize("image", 64), 1},
+		{"filename-matches", vhttp.MultipartFilenameMatches("image", regexp.MustCompile(`\.png$`)), 1},
+		{"content-type-success", vhttp.MultipartFileContentTypeIs("image", vhttp.MimeImagePNG, vhttp.MimeImageJPEG), 0},
+		{"content-type-mismatch", vhttp.MultipartFileContentTypeIs("image", vhttp.MimeImageJPEG), 2},
+		{"detected-type", vhttp.MultipartFileDetectedTypeIs("image", vhttp.MimeImagePNG), 1},
+		{"detected-type-missing", vhttp.MultipartFileDetectedTypeIs("avatar", vhttp.MimeImagePNG), 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, body := newMultipartRequest(t)
+			err := vhttp.ValidateRequest(req, c.v)
+			if n := len(vhttp.ValidationErrors(err)); n != c.nErrs {
+				t.Errorf("expected %d errors, found %d: %v", c.nErrs, n, err)
+			}
+
+			// Was the body left readable?
+			b, _ := io.ReadAll(req.Body)
+			if !bytes.Equal(b, body) {
+				t.Error("expected the body to be left readable")
+			}
+		})
+	}
+}
+
+func TestMultipartValidatorContentType(t *testing.T) {
+	cases := []struct {
+		name string // Case name
+		ct   string // Request's Content-Type
+	}{
+		{"not-multipart", vhttp.MimeJSON},
+		{"no-boundary", vhttp.MimeMultipartForm},
+		{"bad-body", vhttp.MimeMultipartForm + "; boundary=xyz"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := newBodyRequest("title=My+Photos")
+			req.Header.Set(vhttp.HeaderContentType, c.ct)
+			err := vhttp.ValidateRequest(req, vhttp.MultipartHasField("title"))
+			if n := len(vhttp.ValidationErrors(err)); n != 1 {
+				t.Errorf("expected 1 error, found %d: %v", n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,867 @@
+package vhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// OpenAPIUnmarshal is the function used to decode OpenAPI documents.
+//
+// By default, documents are decoded as JSON. To load YAML documents, this
+// can be replaced with a YAML decoder, as long as it decodes into the same
+// types as encoding/json (ie map[string]any, []any, float64, string, bool
+// and nil).
+var OpenAPIUnmarshal func([]byte, any) error = json.Unmarshal
+
+// OpenAPI is a loaded OpenAPI 3.0 or 3.1 document that can be used to
+// validate requests and responses against the operations it describes.
+//
+//	spec, err := vhttp.LoadOpenAPIFile("openapi.json")
+//	if err != nil {
+//		// ...
+//	}
+//	err = vhttp.ValidateRequest(req, spec.RequestValidator())
+//	err = vhttp.ValidateResponse(res, spec.ResponseValidator())
+//
+// Schemas are validated using JSONSchema (with OpenAPI 3.0's "nullable"
+// keyword supported for 3.0 documents). Parameters are decoded according
+// to their schema's type and (for arrays) their style before they're
+// validated. Request and response bodies are validated against their
+// schema when their media type is JSON (eg "application/json" or
+// "application/problem+json").
+type OpenAPI struct {
+	version string
+	c       *jsCompiler
+	bases   []string
+	routes  []*oaRoute
+}
+
+// oaRoute is a path template from the document's "paths" object.
+type oaRoute struct {
+	template string
+	re       *regexp.Regexp
+	names    []string // Names of the path parameters
+	literal  int      // Number of non-templated characters (for ordering)
+	ops      map[string]*oaOperation
+}
+
+// oaOperation is an operation (a path and a method).
+type oaOperation struct {
+	method    string
+	path      string
+	params    []*oaParam
+	body      *oaBody
+	responses map[string]*oaResponse
+}
+
+// String returns the operation's method and path template.
+func (op *oaOperation) String() string {
+	return op.method + " " + op.path
+}
+
+// oaParam is a parameter (or a response header).
+type oaParam struct {
+	name     string
+	in       string
+	required bool
+	style    string
+	explode  bool
+	typ      string // Schema type, used to decode the parameter
+	itemTyp  string // Array item type, used to decode the parameter
+	json     bool   // Is the parameter's value JSON (ie defined with "content")?
+	schema   *jsSchema
+}
+
+// oaBody is a request body or response's content.
+type oaBody struct {
+	required bool
+	content  map[string]*jsSchema // Keyed by media range (the schema may be nil)
+}
+
+// oaResponse is a response.
+type oaResponse struct {
+	headers []*oaParam
+	body    *oaBody
+}
+
+// oaNode is a JSON object in a document, along with its location.
+type oaNode struct {
+	doc string
+	ptr string
+	v   map[string]any
+}
+
+// LoadOpenAPI loads the OpenAPI document b.
+//
+// Since the document isn't loaded from a file system, it can only
+// reference itself.
+func LoadOpenAPI(b []byte) (*OpenAPI, error) {
+	return loadOpenAPI(nil, "openapi.json", b)
+}
+
+// LoadOpenAPIFile loads the OpenAPI document in the file at name. References
+// to other files are resolved relative to it.
+func LoadOpenAPIFile(name string) (*OpenAPI, error) {
+	dir, file := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	return LoadOpenAPIFS(os.DirFS(dir), file)
+}
+
+// LoadOpenAPIFS loads the OpenAPI document at name in the file system fsys.
+// References to other files are resolved relative to it and loaded from fsys.
+func LoadOpenAPIFS(fsys fs.FS, name string) (*OpenAPI, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI document: %w", err)
+	}
+	return loadOpenAPI(fsys, name, b)
+}
+
+// loadOpenAPI decodes the document b and builds the list of routes.
+func loadOpenAPI(fsys fs.FS, name string, b []byte) (*OpenAPI, error) {
+	var doc map[string]any
+	if err := OpenAPIUnmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	// Check the version
+	o := &OpenAPI{}
+	o.version, _ = doc["openapi"].(string)
+	if !strings.HasPrefix(o.version, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", o.version)
+	}
+
+	// Register the document (and component schemas) with the
+	// schema compiler so schemas can reference them
+	o.c = newJSCompiler(fsys)
+	o.c.openAPI30 = strings.HasPrefix(o.version, "3.0")
+	uri := jsFileURI(name)
+	o.c.addDocument(uri, doc)
+	root := oaNode{doc: uri, v: doc}
+	if schemas, ok := o.child(root, "components", "schemas"); ok {
+		for _, k := range jsSortedKeys(schemas.v) {
+			o.c.index(uri, uri, schemas.ptr+"/"+jsEscapePointer(k), schemas.v[k], false)
+		}
+	}
+
+	// Get the server base paths (defaulting to "/" if there are no servers)
+	if servers, ok := doc["servers"].([]any); ok {
+		for _, s := range servers {
+			if base, ok := oaServerBase(s); ok {
+				o.bases = append(o.bases, base)
+			}
+		}
+	}
+	if len(o.bases) == 0 {
+		o.bases = append(o.bases, "")
+	}
+
+	// Build the routes
+	paths, _ := o.child(root, "paths")
+	for _, tmpl := range jsSortedKeys(paths.v) {
+		item, ok := o.child(paths, tmpl)
+		if !ok {
+			continue
+		}
+		r, err := o.buildRoute(tmpl, item)
+		if err != nil {
+			return nil, err
+		}
+		o.routes = append(o.routes, r)
+	}
+
+	// Prefer routes with more literal characters
+	// (eg "/users/me" over "/users/{id}")
+	sort.SliceStable(o.routes, func(i, j int) bool {
+		return o.routes[i].literal > o.routes[j].literal
+	})
+	return o, nil
+}
+
+// oaServerBase returns the path of a server object's URL (with any
+// variables replaced by their default values).
+func oaServerBase(s any) (string, bool) {
+	m, ok := s.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	raw, _ := m["url"].(string)
+	vars, _ := m["variables"].(map[string]any)
+	for k, v := range vars {
+		if vm, ok := v.(map[string]any); ok {
+			def, _ := vm["default"].(string)
+			raw = strings.ReplaceAll(raw, "{"+k+"}", def)
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(u.Path, "/"), true
+}
+
+// oaTemplateParam matches a path template parameter (eg "{id}").
+var oaTemplateParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// buildRoute builds the route for the path item at tmpl.
+func (o *OpenAPI) buildRoute(tmpl string, item oaNode) (*oaRoute, error) {
+	item, err := o.resolve(item)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the path's regular expression
+	r := &oaRoute{template: tmpl, ops: make(map[string]*oaOperation)}
+	var sb strings.Builder
+	sb.WriteString("^")
+	last := 0
+	for _, m := range oaTemplateParam.FindAllStringSubmatchIndex(tmpl, -1) {
+		sb.WriteString(regexp.QuoteMeta(tmpl[last:m[0]]))
+		sb.WriteString("([^/]+)")
+		r.names = append(r.names, tmpl[m[2]:m[3]])
+		r.literal += m[0] - last
+		last = m[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(tmpl[last:]))
+	sb.WriteString("$")
+	r.literal += len(tmpl) - last
+	if r.re, err = regexp.Compile(sb.String()); err != nil {
+		return nil, fmt.Errorf("invalid path template %q: %w", tmpl, err)
+	}
+
+	// Get the parameters shared by all operations
+	shared, err := o.buildParams(item)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the operations
+	for _, method := range []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"} {
+		opNode, ok := o.child(item, method)
+		if !ok {
+			continue
+		}
+		op, err := o.buildOperation(strings.ToUpper(method), tmpl, opNode, shared)
+		if err != nil {
+			return nil, fmt.Errorf("invalid operation %s %s: %w", strings.ToUpper(method), tmpl, err)
+		}
+		r.ops[op.method] = op
+	}
+	return r, nil
+}
+
+// buildOperation builds the operation defined by the node n.
+func (o *OpenAPI) buildOperation(method, tmpl string, n oaNode, shared []*oaParam) (*oaOperation, error) {
+	op := &oaOperation{method: method, path: tmpl, responses: make(map[string]*oaResponse)}
+
+	// Merge the parameters (operation parameters override
+	// path item parameters with the same name and location)
+	params, err := o.buildParams(n)
+	if err != nil {
+		return nil, err
+	}
+	for _, sp := range shared {
+		overridden := false
+		for _, p := range params {
+			if p.name == sp.name && p.in == sp.in {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			op.params = append(op.params, sp)
+		}
+	}
+	op.params = append(op.params, params...)
+
+	// Request body
+	if rb, ok := o.child(n, "requestBody"); ok {
+		if op.body, err = o.buildBody(rb); err != nil {
+			return nil, err
+		}
+	}
+
+	// Responses
+	if rs, ok := o.child(n, "responses"); ok {
+		for _, code := range jsSortedKeys(rs.v) {
+			rn, ok := o.child(rs, code)
+			if !ok {
+				continue
+			}
+			if rn, err = o.resolve(rn); err != nil {
+				return nil, err
+			}
+			res := &oaResponse{}
+			if hs, ok := o.child(rn, "headers"); ok {
+				for _, name := range jsSortedKeys(hs.v) {
+					hn, ok := o.child(hs, name)
+					if !ok {
+						continue
+					}
+					h, err := o.buildParam(hn)
+					if err != nil {
+						return nil, err
+					}
+					h.name, h.in = name, "header"
+					res.headers = append(res.headers, h)
+				}
+			}
+			if res.body, err = o.buildBody(rn); err != nil {
+				return nil, err
+			}
+			op.responses[strings.ToUpper(code)] = res
+		}
+	}
+	return op, nil
+}
+
+// buildParams builds the list of parameters in the "parameters" field
+// of the node n.
+func (o *OpenAPI) buildParams(n oaNode) ([]*oaParam, error) {
+	list, ok := n.v["parameters"].([]any)
+	if !ok {
+		return nil, nil
+	}
+	var params []*oaParam
+	for i := range list {
+		pn, ok := o.child(n, "parameters", strconv.Itoa(i))
+		if !ok {
+			continue
+		}
+		p, err := o.buildParam(pn)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// buildParam builds the parameter (or header) defined by the node n.
+func (o *OpenAPI) buildParam(n oaNode) (*oaParam, error) {
+	n, err := o.resolve(n)
+	if err != nil {
+		return nil, err
+	}
+	p := &oaParam{}
+	p.name, _ = n.v["name"].(string)
+	p.in, _ = n.v["in"].(string)
+	p.required, _ = n.v["required"].(bool)
+
+	// Get the style (and default explode value)
+	p.style, _ = n.v["style"].(string)
+	if p.style == "" {
+		switch p.in {
+		case "query", "cookie":
+			p.style = "form"
+		default:
+			p.style = "simple"
+		}
+	}
+	p.explode = p.style == "form"
+	if e, ok := n.v["explode"].(bool); ok {
+		p.explode = e
+	}
+
+	// Get the schema (either directly or via the content map)
+	sn, ok := o.child(n, "schema")
+	if !ok {
+		if content, ok := o.child(n, "content"); ok {
+			for _, mt := range jsSortedKeys(content.v) {
+				if sn, ok = o.child(content, mt, "schema"); ok {
+					p.json = isJSONMediaType(mt)
+					break
+				}
+			}
+		}
+	}
+	if ok {
+		if p.schema, err = o.schema(sn); err != nil {
+			return nil, err
+		}
+		p.typ = o.schemaType(sn)
+		if items, ok := o.child(sn, "items"); ok {
+			p.itemTyp = o.schemaType(items)
+		}
+	}
+	return p, nil
+}
+
+// buildBody builds the request body or response content defined
+// by the node n.
+func (o *OpenAPI) buildBody(n oaNode) (*oaBody, error) {
+	n, err := o.resolve(n)
+	if err != nil {
+		return nil, err
+	}
+	content, ok := o.child(n, "content")
+	if !ok {
+		return nil, nil
+	}
+	b := &oaBody{content: make(map[string]*jsSchema)}
+	b.required, _ = n.v["required"].(bool)
+	for _, mt := range jsSortedKeys(content.v) {
+		var s *jsSchema
+		if sn, ok := o.child(content, mt, "schema"); ok {
+			if s, err = o.schema(sn); err != nil {
+				return nil, err
+			}
+		}
+		b.content[strings.ToLower(mt)] = s
+	}
+	return b, nil
+}
+
+// child returns the object at the given keys within n (without
+// following references).
+func (o *OpenAPI) child(n oaNode, keys ...string) (oaNode, bool) {
+	for _, k := range keys {
+		v, ok := n.v[k]
+		if !ok {
+			return oaNode{}, false
+		}
+		n.ptr += "/" + jsEscapePointer(k)
+		switch t := v.(type) {
+		case map[string]any:
+			n.v = t
+		case []any:
+			// Convert the array to a map so it can be
+			// indexed using the same function.
+			m := make(map[string]any, len(t))
+			for i, e := range t {
+				m[strconv.Itoa(i)] = e
+			}
+			n.v = m
+		case bool:
+			// A boolean schema
+			n.v = map[string]any{"$bool": t}
+		default:
+			return oaNode{}, false
+		}
+	}
+	return n, true
+}
+
+// resolve follows the "$ref" field of the node n (if any).
+func (o *OpenAPI) resolve(n oaNode) (oaNode, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := n.v["$ref"].(string)
+		if !ok {
+			return n, nil
+		}
+		abs, err := jsResolve(n.doc, ref)
+		if err != nil {
+			return n, fmt.Errorf("invalid $ref %q: %w", ref, err)
+		}
+		u, frag := jsSplitFragment(abs)
+		res, ok := o.c.resources[u]
+		if !ok {
+			if err := o.c.loadDocument(u); err != nil {
+				return n, fmt.Errorf("unresolvable $ref %q: %w", ref, err)
+			}
+			res = o.c.resources[u]
+		}
+		v, err := jsPointerGet(res.node, frag)
+		if err != nil {
+			return n, fmt.Errorf("unresolvable $ref %q: %w", ref, err)
+		}
+		m, ok := v.(map[string]any)
+		if !ok {
+			return n, fmt.Errorf("unresolvable $ref %q: expected an object", ref)
+		}
+		n = oaNode{doc: res.doc, ptr: res.ptr + frag, v: m}
+	}
+	return n, fmt.Errorf("too many nested references at %q", n.ptr)
+}
+
+// schema compiles the schema at the node n.
+func (o *OpenAPI) schema(n oaNode) (*jsSchema, error) {
+	if b, ok := n.v["$bool"].(bool); ok {
+		return &jsSchema{always: &b}, nil
+	}
+	s, err := o.c.compile(n.doc, n.ptr, n.v, n.doc, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.c.checkCycles(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// schemaType returns the (non-null) type of the schema at the node n,
+// used for decoding parameter values.
+func (o *OpenAPI) schemaType(n oaNode) string {
+	n, err := o.resolve(n)
+	if err != nil {
+		return ""
+	}
+	switch t := n.v["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Validator names used in the ValidationErrors returned by the OpenAPI
+// validators.
+const (
+	oaRequestValidator  = "OpenAPI.RequestValidator"
+	oaResponseValidator = "OpenAPI.ResponseValidator"
+)
+
+// findOperation finds the operation matching the request's method and path,
+// returning the path parameter values. Errors are attributed to the
+// named validator.
+func (o *OpenAPI) findOperation(validator string, req *http.Request) (*oaOperation, map[string]string, error) {
+	if req.URL == nil {
+		return nil, nil, validationErrorf("url", validator, CodeMissing, nil, nil, "request URL is nil")
+	}
+	p := req.URL.EscapedPath()
+	pathFound := false
+	for _, base := range o.bases {
+		if !strings.HasPrefix(p, base) {
+			continue
+		}
+		rel := strings.TrimPrefix(p, base)
+		for _, r := range o.routes {
+			m := r.re.FindStringSubmatch(rel)
+			if m == nil {
+				continue
+			}
+			pathFound = true
+			op, ok := r.ops[req.Method]
+			if !ok {
+				continue
+			}
+			vals := make(map[string]string, len(r.names))
+			for i, name := range r.names {
+				v, err := url.PathUnescape(m[i+1])
+				if err != nil {
+					v = m[i+1]
+				}
+				vals[name] = v
+			}
+			return op, vals, nil
+		}
+	}
+	if pathFound {
+		return nil, nil, validationErrorf("method", validator, CodeUndeclared, nil, req.Method,
+			"method %s is not allowed for path %q", req.Method, req.URL.Path)
+	}
+	return nil, nil, validationErrorf("url.path", validator, CodeUndeclared, nil, req.URL.Path,
+		"no operation found for %s %q", req.Method, req.URL.Path)
+}
+
+// RequestValidator creates a RequestValidator that finds the operation
+// matching the request's method and path and validates the request's
+// parameters and body against it.
+//
+// An error is returned if no operation matches the request. Otherwise, an
+// error is returned for each missing required parameter, each parameter
+// that doesn't match its schema, a missing required body, an undeclared
+// Content-Type and each body schema violation.
+func (o *OpenAPI) RequestValidator() RequestFunc {
+	return func(req *http.Request) error {
+		op, pathVals, err := o.findOperation(oaRequestValidator, req)
+		if err != nil {
+			return err
+		}
+
+		var merr *multierror.Error
+		add := func(err error) {
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+
+		// Validate the parameters
+		for _, p := range op.params {
+			var vals []string
+			var present bool
+			switch p.in {
+			case "path":
+				var v string
+				v, present = pathVals[p.name]
+				vals = []string{v}
+			case "query":
+				vals, present = req.URL.Query()[p.name]
+			case "header":
+				switch CanonicalHeaderKey(p.name) {
+				case "Accept", "Content-Type", "Authorization":
+					continue // Ignored, as per the specification
+				}
+				vals = req.Header.Values(p.name)
+				present = len(vals) > 0
+			case "cookie":
+				if c, err := req.Cookie(p.name); err == nil {
+					vals, present = []string{c.Value}, true
+				}
+			}
+			add(p.validate(oaRequestValidator, op, vals, present))
+		}
+
+		// Validate the body
+		if op.body != nil {
+			b, err := readRequestBody(req)
+			if err != nil {
+				return bodyReadErr("failed to read request body", err)
+			}
+			add(op.body.validate(oaRequestValidator, op, "request body", req.Header.Get("Content-Type"), b))
+		}
+
+		return merr.ErrorOrNil()
+	}
+}
+
+// ResponseValidator creates a ResponseValidator that finds the operation
+// matching the response's request (the http.Response's Request field) and
+// validates the response against it.
+//
+// An error is returned if no operation matches the request or if the
+// status code isn't declared (either directly, with a range such as "2XX",
+// or with "default"). Otherwise, an error is returned for each missing
+// required header, each header that doesn't match its schema, an
+// undeclared Content-Type and each body schema violation.
+func (o *OpenAPI) ResponseValidator() ResponseFunc {
+	return func(res *http.Response) error {
+		if res.Request == nil {
+			return InternalErr(fmt.Errorf("response has no request to match an operation"))
+		}
+		op, _, err := o.findOperation(oaResponseValidator, res.Request)
+		if err != nil {
+			return err
+		}
+
+		// Find the response definition
+		code := strconv.Itoa(res.StatusCode)
+		r, ok := op.responses[code]
+		if !ok {
+			r, ok = op.responses[code[:1]+"XX"]
+		}
+		if !ok {
+			r, ok = op.responses["DEFAULT"]
+		}
+		if !ok {
+			return validationErrorf("status", oaResponseValidator, CodeUndeclared, nil, res.StatusCode,
+				"status code %d is not declared for %s", res.StatusCode, op)
+		}
+
+		var merr *multierror.Error
+		add := func(err error) {
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+
+		// Validate the headers
+		for _, h := range r.headers {
+			if CanonicalHeaderKey(h.name) == "Content-Type" {
+				continue // Ignored, as per the specification
+			}
+			vals := res.Header.Values(h.name)
+			add(h.validate(oaResponseValidator, op, vals, len(vals) > 0))
+		}
+
+		// Validate the body
+		if r.body != nil {
+			b, err := readResponseBody(res)
+			if err != nil {
+				return bodyReadErr("failed to read response body", err)
+			}
+			if len(b) > 0 {
+				add(r.body.validate(oaResponseValidator, op, "response body", res.Header.Get("Content-Type"), b))
+			}
+		}
+
+		return merr.ErrorOrNil()
+	}
+}
+
+// validate decodes and validates the parameter's values.
+func (p *oaParam) validate(validator string, op *oaOperation, vals []string, present bool) error {
+	label := fmt.Sprintf("%s parameter %q", p.in, p.name)
+	target := p.target()
+	if !present {
+		if p.required {
+			return validationErrorf(target, validator, CodeMissing, nil, nil,
+				"missing required %s for %s", label, op)
+		}
+		return nil
+	}
+	if p.schema == nil {
+		return nil
+	}
+
+	// Decode the value
+	v, err := p.decode(vals)
+	if err != nil {
+		return &ValidationError{
+			Target:    target,
+			Validator: validator,
+			Code:      CodeInvalid,
+			Actual:    vals,
+			Message:   fmt.Sprintf("invalid %s for %s: %s", label, op, err),
+			Err:       err,
+		}
+	}
+	if v == nil && p.typ == "object" {
+		return nil // Objects are only supported as JSON content
+	}
+
+	// Validate the value
+	prefix := fmt.Sprintf("invalid %s for %s: ", label, op)
+	return schemaValidationErrors(target, validator, prefix, p.schema, v)
+}
+
+// target returns the ValidationError target for the parameter.
+func (p *oaParam) target() string {
+	switch p.in {
+	case "query":
+		return queryTarget(p.name)
+	case "header":
+		return fmt.Sprintf("header[%q]", CanonicalHeaderKey(p.name))
+	}
+	return fmt.Sprintf("%s[%q]", p.in, p.name)
+}
+
+// decode decodes the parameter's values based on its schema type and style.
+func (p *oaParam) decode(vals []string) (any, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	// JSON content?
+	if p.json {
+		var v any
+		if err := json.Unmarshal([]byte(vals[0]), &v); err != nil {
+			return nil, fmt.Errorf("value is not valid JSON: %s", err)
+		}
+		return v, nil
+	}
+
+	switch p.typ {
+	case "array":
+		// Split the values based on the style
+		var parts []string
+		if p.explode && p.style == "form" {
+			parts = vals
+		} else {
+			sep := ","
+			switch p.style {
+			case "spaceDelimited":
+				sep = " "
+			case "pipeDelimited":
+				sep = "|"
+			}
+			parts = strings.Split(vals[0], sep)
+		}
+		out := make([]any, len(parts))
+		for i, s := range parts {
+			out[i] = oaDecodeScalar(p.itemTyp, s)
+		}
+		return out, nil
+	case "object":
+		return nil, nil
+	}
+	return oaDecodeScalar(p.typ, vals[0]), nil
+}
+
+// oaDecodeScalar decodes the string s based on the schema type typ. If s
+// can't be decoded, it's returned as-is so that the schema's type check
+// reports the error.
+func oaDecodeScalar(typ, s string) any {
+	switch typ {
+	case "integer", "number":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+// validate validates the body b (with the content type ct).
+func (b *oaBody) validate(validator string, op *oaOperation, label, ct string, body []byte) error {
+	if len(body) == 0 {
+		if b.required {
+			return validationErrorf("body", validator, CodeMissing, nil, nil,
+				"missing required %s for %s", label, op)
+		}
+		return nil
+	}
+
+	// Find the media type
+	mt, err := ParseMediaType(ct)
+	if err != nil && ct != "" {
+		return &ValidationError{
+			Target:    `header["Content-Type"]`,
+			Validator: validator,
+			Code:      CodeInvalid,
+			Actual:    ct,
+			Message:   fmt.Sprintf("invalid %s content type %q for %s: %s", label, ct, op, err),
+			Err:       err,
+		}
+	}
+	var s *jsSchema
+	found := false
+	for _, rng := range oaSortedRanges(b.content) {
+		if r, err := ParseMediaType(rng); err == nil && r.Match(mt) {
+			s, found = b.content[rng], true
+			break
+		}
+	}
+	if !found {
+		return validationErrorf(`header["Content-Type"]`, validator, CodeUndeclared, nil, ct,
+			"%s content type %q is not declared for %s", label, ct, op)
+	}
+	if s == nil || !isJSONMediaType(mt.Type+"/"+mt.Subtype) {
+		return nil
+	}
+
+	// Decode and validate the body
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return &ValidationError{
+			Target:    "body",
+			Validator: validator,
+			Code:      CodeInvalid,
+			Message:   fmt.Sprintf("%s for %s is not valid JSON: %s", label, op, err),
+			Err:       err,
+		}
+	}
+	prefix := fmt.Sprintf("invalid %s for %s: ", label, op)
+	return schemaValidationErrors("body", validator, prefix, s, v)
+}
+
+// oaSortedRanges returns the media ranges of the content map, ordered
+// from most to least specific.
+func oaSortedRanges(content map[string]*jsSchema) []string {
+	rngs := jsSortedKeys(content)
+	sort.SliceStable(rngs, func(i, j int) bool {
+		return strings.Count(rngs[i], "*") < strings.Count(rngs[j], "*")
+	})
+	return rngs
+}
@@ -0,0 +1,438 @@
+package vhttp_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/a-poor/vhttp"
+	"github.com/hashicorp/go-multierror"
+)
+
+// petstore is a sample OpenAPI 3.1 document used by the OpenAPI tests.
+const petstore = `{
+	"openapi": "3.1.0",
+	"info": {"title": "Petstore", "version": "1.0.0"},
+	"servers": [{"url": "https://{host}/api/{version}", "variables": {"host": {"default": "example.com"}, "version": {"default": "v1"}}}],
+	"paths": {
+		"/pets": {
+			"get": {
+				"parameters": [
+					{"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 100}},
+					{"name": "tags", "in": "query", "schema": {"type": "array", "items": {"type": "string"}}},
+					{"name": "X-Request-Id", "in": "header", "required": true, "schema": {"type": "string", "format": "uuid"}}
+				],
+				"responses": {
+					"200": {
+						"description": "OK",
+						"headers": {"X-Total": {"required": true, "schema": {"type": "integer"}}},
+						"content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Pet"}}}}
+					},
+					"4XX": {"$ref": "#/components/responses/Error"}
+				}
+			},
+			"post": {
+				"requestBody": {
+					"required": true,
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/NewPet"}}}
+				},
+				"responses": {
+					"201": {"description": "Created"},
+					"default": {"$ref": "#/components/responses/Error"}
+				}
+			}
+		},
+		"/pets/{petId}": {
+			"parameters": [{"$ref": "#/components/parameters/PetId"}],
+			"get": {
+				"parameters": [{"name": "session", "in": "cookie", "required": true, "schema": {"type": "string"}}],
+				"responses": {"200": {"description": "OK", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}
+			}
+		},
+		"/pets/mine": {
+			"get": {"responses": {"204": {"description": "No content"}}}
+		}
+	},
+	"components": {
+		"parameters": {
+			"PetId": {"name": "petId", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}}
+		},
+		"schemas": {
+			"NewPet": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {"name": {"type": "string", "minLength": 1}, "tag": {"type": ["string", "null"]}}
+			},
+			"Pet": {
+				"allOf": [{"$ref": "#/components/schemas/NewPet"}, {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}]
+			}
+		},
+		"responses": {
+			"Error": {"description": "Error", "content": {"application/problem+json": {"schema": {"type": "object", "required": ["title"]}}}}
+		}
+	}
+}`
+
+// newOpenAPIRequest creates a request for the OpenAPI tests.
+func newOpenAPIRequest(method, target, body string, headers map[string]string) *http.Request {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestOpenAPIRequestValidator(t *testing.T) {
+	spec, err := vhttp.LoadOpenAPI([]byte(petstore))
+	if err != nil {
+		t.Fatalf("unexpected error loading spec: %s", err)
+	}
+
+	const reqID = "6f1c2c0e-3d4a-4b7e-9a53-2f6f0a1b2c3d"
+	cases := []struct {
+		name    string            // Case name
+		method  string            // Request method
+		target  string            // Request target
+		body    string            // Request body
+		headers map[string]string // Request headers
+		nerrs   int               // Number of errors expected
+	}{
+		{
+			name:    "list-ok",
+			method:  http.MethodGet,
+			target:  "/api/v1/pets?limit=10&tags=a&tags=b",
+			headers: map[string]string{"X-Request-Id": reqID},
+		},
+		{
+			name:    "outside-server-base",
+			method:  http.MethodGet,
+			target:  "/pets",
+			headers: map[string]string{"X-Request-Id": reqID},
+			nerrs:   1,
+		},
+		{
+			name:   "list-missing-header",
+			method: http.MethodGet,
+			target: "/api/v1/pets",
+			nerrs:  1,
+		},
+		{
+			name:    "list-bad-params",
+			method:  http.MethodGet,
+			target:  "/api/v1/pets?limit=1000",
+			headers: map[string]string{"X-Request-Id": "nope"},
+			nerrs:   2,
+		},
+		{
+			name:    "list-bad-type",
+			method:  http.MethodGet,
+			target:  "/api/v1/pets?limit=ten",
+			headers: map[string]string{"X-Request-Id": reqID},
+			nerrs:   1,
+		},
+		{
+			name:    "create-ok",
+			method:  http.MethodPost,
+			target:  "/api/v1/pets",
+			body:    `{"name": "rex", "tag": null}`,
+			headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		},
+		{
+			name:   "create-missing-body",
+			method: http.MethodPost,
+			target: "/api/v1/pets",
+			nerrs:  1,
+		},
+		{
+			name:    "create-bad-body",
+			method:  http.MethodPost,
+			target:  "/api/v1/pets",
+			body:    `{"name": "", "tag": 5}`,
+			headers: map[string]string{"Content-Type": "application/json"},
+			nerrs:   2,
+		},
+		{
+			name:    "create-bad-content-type",
+			method:  http.MethodPost,
+			target:  "/api/v1/pets",
+			body:    `name=rex`,
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			nerrs:   1,
+		},
+		{
+			name:    "get-ok",
+			method:  http.MethodGet,
+			target:  "/api/v1/pets/5",
+			headers: map[string]string{"Cookie": "session=abc"},
+		},
+		{
+			name:   "get-bad-path-param-and-cookie",
+			method: http.MethodGet,
+			target: "/api/v1/pets/0",
+			nerrs:  2,
+		},
+		{
+			name:   "literal-path-preferred",
+			method: http.MethodGet,
+			target: "/api/v1/pets/mine",
+		},
+		{
+			name:   "method-not-allowed",
+			method: http.MethodDelete,
+			target: "/api/v1/pets",
+			nerrs:  1,
+		},
+		{
+			name:   "unknown-path",
+			method: http.MethodGet,
+			target: "/api/v1/owners",
+			nerrs:  1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := newOpenAPIRequest(c.method, c.target, c.body, c.headers)
+			err := vhttp.ValidateRequest(req, spec.RequestValidator())
+			if c.nerrs == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			var merr *multierror.Error
+			if !errors.As(err, &merr) {
+				t.Fatalf("expected a multierror, got %v", err)
+			}
+			if len(merr.Errors) != c.nerrs {
+				t.Errorf("expected %d errors, got %d: %s", c.nerrs, len(merr.Errors), err)
+			}
+		})
+	}
+
+	t.Run("body-still-readable", func(t *testing.T) {
+		body := `{"name": "rex"}`
+		req := newOpenAPIRequest(http.MethodPost, "/api/v1/pets", body, map[string]string{"Content-Type": "application/json"})
+		if err := vhttp.ValidateRequest(req, spec.RequestValidator()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		b, _ := io.ReadAll(req.Body)
+		if string(b) != body {
+			t.Errorf("expected body %q, got %q", body, b)
+		}
+	})
+}
+
+func TestOpenAPIResponseValidator(t *testing.T) {
+	spec, err := vhttp.LoadOpenAPI([]byte(petstore))
+	if err != nil {
+		t.Fatalf("unexpected error loading spec: %s", err)
+	}
+
+	cases := []struct {
+		name    string            // Case name
+		method  string            // Request method
+		target  string            // Request target
+		status  int               // Response status code
+		body    string            // Response body
+		headers map[string]string // Response headers
+		nerrs   int               // Number of errors expected
+	}{
+		{
+			name:    "list-ok",
+			method:  http.MethodGet,
+			target:  "/api/v1/pets",
+			status:  http.StatusOK,
+			body:    `[{"id": 1, "name": "rex"}]`,
+			headers: map[string]string{"Content-Type": "application/json", "X-Total": "1"},
+		},
+		{
+			name:    "list-bad",
+			method:  http.MethodGet,
+			target:  "/api/v1/pets",
+			status:  http.StatusOK,
+			body:    `[{"name": "rex"}]`,
+			headers: map[string]string{"Content-Type": "application/json", "X-Total": "one"},
+			nerrs:   2,
+		},
+		{
+			name:    "list-range-status",
+			method:  http.MethodGet,
+			target:  "/api/v1/pets",
+			status:  http.StatusNotFound,
+			body:    `{"title": "Not Found"}`,
+			headers: map[string]string{"Content-Type": "application/problem+json"},
+		},
+		{
+			name:   "list-undeclared-status",
+			method: http.MethodGet,
+			target: "/api/v1/pets",
+			status: http.StatusInternalServerError,
+			nerrs:  1,
+		},
+		{
+			name:    "create-default-status",
+			method:  http.MethodPost,
+			target:  "/api/v1/pets",
+			status:  http.StatusInternalServerError,
+			body:    `{}`,
+			headers: map[string]string{"Content-Type": "application/problem+json"},
+			nerrs:   1,
+		},
+		{
+			name:    "undeclared-content-type",
+			method:  http.MethodGet,
+			target:  "/api/v1/pets/1",
+			status:  http.StatusOK,
+			body:    `<pet/>`,
+			headers: map[string]string{"Content-Type": "application/xml"},
+			nerrs:   1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &http.Response{
+				StatusCode: c.status,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(c.body)),
+				Request:    newOpenAPIRequest(c.method, c.target, "", nil),
+			}
+			for k, v := range c.headers {
+				res.Header.Set(k, v)
+			}
+
+			err := vhttp.ValidateResponse(res, spec.ResponseValidator())
+			if c.nerrs == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			var merr *multierror.Error
+			if !errors.As(err, &merr) {
+				t.Fatalf("expected a multierror, got %v", err)
+			}
+			if len(merr.Errors) != c.nerrs {
+				t.Errorf("expected %d errors, got %d: %s", c.nerrs, len(merr.Errors), err)
+			}
+		})
+	}
+
+	t.Run("no-request", func(t *testing.T) {
+		err := spec.ResponseValidator()(&http.Response{StatusCode: http.StatusOK})
+		var ierr vhttp.InternalError
+		if !errors.As(err, &ierr) {
+			t.Errorf("expected an InternalError, got %v", err)
+		}
+	})
+}
+
+func TestLoadOpenAPI(t *testing.T) {
+	t.Run("openapi-3.0-nullable", func(t *testing.T) {
+		spec, err := vhttp.LoadOpenAPI([]byte(`{
+			"openapi": "3.0.3",
+			"paths": {"/items": {"post": {
+				"requestBody": {"content": {"application/json": {"schema": {
+					"type": "object",
+					"properties": {"n": {"type": "integer", "nullable": true, "maximum": 10, "exclusiveMaximum": true}}
+				}}}},
+				"responses": {"200": {"description": "OK"}}
+			}}}
+		}`))
+		if err != nil {
+			t.Fatalf("unexpected error loading spec: %s", err)
+		}
+		v := spec.RequestValidator()
+
+		req := newOpenAPIRequest(http.MethodPost, "/items", `{"n": null}`, map[string]string{"Content-Type": "application/json"})
+		if err := v(req); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		req = newOpenAPIRequest(http.MethodPost, "/items", `{"n": 10}`, map[string]string{"Content-Type": "application/json"})
+		if err := v(req); err == nil {
+			t.Errorf("expected an error to be returned")
+		}
+	})
+	t.Run("external-refs", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"api/openapi.json": {Data: []byte(`{
+				"openapi": "3.1.0",
+				"paths": {"/things": {"post": {
+					"requestBody": {"$ref": "components.json#/requestBodies/Thing"},
+					"responses": {"200": {"description": "OK"}}
+				}}}
+			}`)},
+			"api/components.json": {Data: []byte(`{
+				"requestBodies": {"Thing": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/schemas/Thing"}}}}},
+				"schemas": {"Thing": {"type": "object", "required": ["id"]}}
+			}`)},
+		}
+		spec, err := vhttp.LoadOpenAPIFS(fsys, "api/openapi.json")
+		if err != nil {
+			t.Fatalf("unexpected error loading spec: %s", err)
+		}
+		req := newOpenAPIRequest(http.MethodPost, "/things", `{}`, map[string]string{"Content-Type": "application/json"})
+		if err := spec.RequestValidator()(req); err == nil {
+			t.Errorf("expected an error to be returned")
+		}
+	})
+	t.Run("servers", func(t *testing.T) {
+		spec, err := vhttp.LoadOpenAPI([]byte(`{
+			"openapi": "3.1.0",
+			"servers": [{"url": "https://api.example.com"}, {"url": "https://example.com/v2/"}],
+			"paths": {"/items": {"get": {"responses": {"200": {"description": "OK"}}}}}
+		}`))
+		if err != nil {
+			t.Fatalf("unexpected error loading spec: %s", err)
+		}
+		for target, ok := range map[string]bool{"/items": true, "/v2/items": true, "/v3/items": false} {
+			req := newOpenAPIRequest(http.MethodGet, target, "", nil)
+			if err := spec.RequestValidator()(req); (err == nil) != ok {
+				t.Errorf("%s: expected match to be %t, found %v", target, ok, err)
+			}
+		}
+	})
+	t.Run("media-ranges", func(t *testing.T) {
+		spec, err := vhttp.LoadOpenAPI([]byte(`{
+			"openapi": "3.1.0",
+			"paths": {"/items": {"post": {
+				"requestBody": {"content": {"application/*+json": {"schema": {"type": "object"}}}},
+				"responses": {"200": {"description": "OK"}}
+			}}}
+		}`))
+		if err != nil {
+			t.Fatalf("unexpected error loading spec: %s", err)
+		}
+		req := newOpenAPIRequest(http.MethodPost, "/items", `{}`, map[string]string{"Content-Type": "application/vnd.api+json"})
+		if err := spec.RequestValidator()(req); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		req = newOpenAPIRequest(http.MethodPost, "/items", `{}`, map[string]string{"Content-Type": "text/plain"})
+		if err := spec.RequestValidator()(req); err == nil {
+			t.Errorf("expected an error for an undeclared content type")
+		}
+	})
+	t.Run("bad-version", func(t *testing.T) {
+		if _, err := vhttp.LoadOpenAPI([]byte(`{"swagger": "2.0"}`)); err == nil {
+			t.Errorf("expected an error to be returned")
+		}
+	})
+	t.Run("bad-ref", func(t *testing.T) {
+		_, err := vhttp.LoadOpenAPI([]byte(`{
+			"openapi": "3.1.0",
+			"paths": {"/x": {"get": {"parameters": [{"$ref": "#/components/parameters/Missing"}]}}}
+		}`))
+		if err == nil {
+			t.Errorf("expected an error to be returned")
+		}
+	})
+}
@@ -1,15 +1,273 @@
 package vhttp
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderUpgrade is the header used to switch to a different protocol on
+// the same connection.
+const HeaderUpgrade = "Upgrade"
 
 // ProtoValidator is a validator that validates an http.Request or http.Response's
 // Proto field.
+//
+// If the Proto field is empty, the value passed to the validator is built
+// from the ProtoMajor and ProtoMinor fields (eg "HTTP/2.0").
 type ProtoValidator func(string) error
 
 func (v ProtoValidator) ValidateRequest(req *http.Request) error {
-	return v(req.Proto)
+	return v(protoString(req.Proto, req.ProtoMajor, req.ProtoMinor))
 }
 
 func (v ProtoValidator) ValidateResponse(res *http.Response) error {
-	return v(res.Proto)
+	return v(protoString(res.Proto, res.ProtoMajor, res.ProtoMinor))
+}
+
+// protoString returns proto, or (if it's empty) the protocol version
+// built from major and minor.
+func protoString(proto string, major, minor int) string {
+	if proto == "" && (major != 0 || minor != 0) {
+		return fmt.Sprintf("HTTP/%d.%d", major, minor)
+	}
+	return proto
+}
+
+// ProtoIs creates a ProtoValidator that checks that the protocol
+// is p (eg "HTTP/1.1").
+func ProtoIs(p string) ProtoValidator {
+	return func(proto string) error {
+		if proto != p {
+			return validationErrorf("proto", "ProtoIs", CodeMismatch, p, proto,
+				"expected protocol %q, found %q", p, proto)
+		}
+		return nil
+	}
+}
+
+// ProtoVersionValidator is a validator that validates an http.Request or
+// http.Response's protocol version. It's passed the Proto, ProtoMajor and
+// ProtoMinor fields.
+type ProtoVersionValidator func(proto string, major, minor int) error
+
+func (v ProtoVersionValidator) ValidateRequest(req *http.Request) error {
+	return v(req.Proto, req.ProtoMajor, req.ProtoMinor)
+}
+
+func (v ProtoVersionValidator) ValidateResponse(res *http.Response) error {
+	return v(res.Proto, res.ProtoMajor, res.ProtoMinor)
+}
+
+// protoVersion returns the protocol version from major and minor, or (if
+// they're both zero) parsed from proto.
+func protoVersion(proto string, major, minor int) (int, int, bool) {
+	if major != 0 || minor != 0 {
+		return major, minor, true
+	}
+	return http.ParseHTTPVersion(proto)
+}
+
+// ProtoAtLeast creates a ProtoVersionValidator that checks that the
+// protocol's version is at least major.minor.
+func ProtoAtLeast(major, minor int) ProtoVersionValidator {
+	want := fmt.Sprintf("HTTP/%d.%d", major, minor)
+	return func(proto string, gotMajor, gotMinor int) error {
+		gotMajor, gotMinor, ok := protoVersion(proto, gotMajor, gotMinor)
+		if !ok {
+			return validationErrorf("proto", "ProtoAtLeast", CodeInvalid, want, proto,
+				"invalid protocol %q", proto)
+		}
+		if gotMajor < major || (gotMajor == major && gotMinor < minor) {
+			got := protoString(proto, gotMajor, gotMinor)
+			return validationErrorf("proto", "ProtoAtLeast", CodeOutOfRange, want, got,
+				"expected protocol of at least %s, found %q", want, got)
+		}
+		return nil
+	}
+}
+
+// protoVersionIs creates a ProtoVersionValidator that checks that the
+// protocol's version is major.minor.
+func protoVersionIs(validator string, major, minor int) ProtoVersionValidator {
+	want := fmt.Sprintf("HTTP/%d.%d", major, minor)
+	return func(proto string, gotMajor, gotMinor int) error {
+		gotMajor, gotMinor, ok := protoVersion(proto, gotMajor, gotMinor)
+		if !ok || gotMajor != major || gotMinor != minor {
+			got := protoString(proto, gotMajor, gotMinor)
+			return validationErrorf("proto", validator, CodeMismatch, want, got,
+				"expected protocol %s, found %q", want, got)
+		}
+		return nil
+	}
+}
+
+// ProtoIsHTTP11 creates a ProtoVersionValidator that checks that the protocol
+// is HTTP/1.1.
+func ProtoIsHTTP11() ProtoVersionValidator {
+	return protoVersionIs("ProtoIsHTTP11", 1, 1)
+}
+
+// ProtoIsHTTP2 creates a ProtoVersionValidator that checks that the protocol
+// is HTTP/2 (including h2c).
+func ProtoIsHTTP2() ProtoVersionValidator {
+	return protoVersionIs("ProtoIsHTTP2", 2, 0)
+}
+
+// Connection is the connection-level information of an http.Request or
+// http.Response.
+type Connection struct {
+	ProtoMajor       int         // The protocol's major version
+	ProtoMinor       int         // The protocol's minor version
+	Close            bool        // The Close field
+	TransferEncoding []string    // The TransferEncoding field
+	Header           http.Header // The message's headers
+}
+
+// tokens returns the lowercase tokens in the header h.
+func (c Connection) tokens(h string) []string {
+	var ts []string
+	for _, v := range c.Header.Values(h) {
+		for _, t := range splitHeaderList(v) {
+			ts = append(ts, strings.ToLower(t))
+		}
+	}
+	return ts
+}
+
+// hasToken reports whether the header h has the token t.
+func (c Connection) hasToken(h, t string) bool {
+	for _, s := range c.tokens(h) {
+		if strings.EqualFold(s, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeepAlive reports whether the connection will be kept open after the
+// message: HTTP/1.1 (and later) connections persist unless the Close flag
+// or a "close" connection option is set, while HTTP/1.0 connections only
+// persist with a "keep-alive" connection option.
+func (c Connection) KeepAlive() bool {
+	if c.Close || c.hasToken(HeaderConnection, "close") {
+		return false
+	}
+	if c.ProtoMajor == 1 && c.ProtoMinor == 0 {
+		return c.hasToken(HeaderConnection, "keep-alive")
+	}
+	return true
+}
+
+// ConnectionValidator is a validator that validates an http.Request or
+// http.Response's connection-level fields.
+type ConnectionValidator func(Connection) error
+
+func (v ConnectionValidator) ValidateRequest(req *http.Request) error {
+	return v(Connection{
+		ProtoMajor:       req.ProtoMajor,
+		ProtoMinor:       req.ProtoMinor,
+		Close:            req.Close,
+		TransferEncoding: req.TransferEncoding,
+		Header:           req.Header,
+	})
+}
+
+func (v ConnectionValidator) ValidateResponse(res *http.Response) error {
+	return v(Connection{
+		ProtoMajor:       res.ProtoMajor,
+		ProtoMinor:       res.ProtoMinor,
+		Close:            res.Close,
+		TransferEncoding: res.TransferEncoding,
+		Header:           res.Header,
+	})
+}
+
+// ConnectionKeepAlive creates a ConnectionValidator that checks that the
+// connection will be kept open (see Connection.KeepAlive).
+func ConnectionKeepAlive() ConnectionValidator {
+	return func(c Connection) error {
+		if !c.KeepAlive() {
+			return validationErrorf(headerTarget(HeaderConnection), "ConnectionKeepAlive", CodeMismatch, "keep-alive", c.tokens(HeaderConnection),
+				"expected the connection to be kept alive")
+		}
+		return nil
+	}
+}
+
+// ConnectionClose creates a ConnectionValidator that checks that the
+// connection will be closed (see Connection.KeepAlive).
+func ConnectionClose() ConnectionValidator {
+	return func(c Connection) error {
+		if c.KeepAlive() {
+			return validationErrorf(headerTarget(HeaderConnection), "ConnectionClose", CodeMismatch, "close", c.tokens(HeaderConnection),
+				"expected the connection to be closed")
+		}
+		return nil
+	}
+}
+
+// ConnectionHasOption creates a ConnectionValidator that checks that the
+// "Connection" header has the option o (compared case-insensitively).
+func ConnectionHasOption(o string) ConnectionValidator {
+	return func(c Connection) error {
+		if !c.hasToken(HeaderConnection, o) {
+			return validationErrorf(headerTarget(HeaderConnection), "ConnectionHasOption", CodeMissing, o, c.tokens(HeaderConnection),
+				"expected the %q header to have option %q", HeaderConnection, o)
+		}
+		return nil
+	}
+}
+
+// TransferEncodingIs creates a ConnectionValidator that checks that the
+// transfer encodings are exactly encs, in order. With no encs, it checks
+// that there are no transfer encodings (ie the identity encoding).
+func TransferEncodingIs(encs ...string) ConnectionValidator {
+	return func(c Connection) error {
+		match := len(c.TransferEncoding) == len(encs)
+		for i := 0; match && i < len(encs); i++ {
+			match = strings.EqualFold(c.TransferEncoding[i], encs[i])
+		}
+		if !match {
+			return validationErrorf("transfer_encoding", "TransferEncodingIs", CodeMismatch, encs, c.TransferEncoding,
+				"expected transfer encodings %q, found %q", encs, c.TransferEncoding)
+		}
+		return nil
+	}
+}
+
+// TransferEncodingChunked creates a ConnectionValidator that checks that
+// the message body is chunked (ie "chunked" is the final transfer
+// encoding).
+func TransferEncodingChunked() ConnectionValidator {
+	return func(c Connection) error {
+		n := len(c.TransferEncoding)
+		if n == 0 || !strings.EqualFold(c.TransferEncoding[n-1], "chunked") {
+			return validationErrorf("transfer_encoding", "TransferEncodingChunked", CodeMismatch, "chunked", c.TransferEncoding,
+				"expected a chunked transfer encoding, found %q", c.TransferEncoding)
+		}
+		return nil
+	}
+}
+
+// UpgradeTo creates a ConnectionValidator that checks that the message
+// asks to upgrade the connection to the protocol p (eg "websocket" or
+// "h2c"): the "Upgrade" header must list p and the "Connection" header
+// must have the "upgrade" option.
+func UpgradeTo(p string) ConnectionValidator {
+	return func(c Connection) error {
+		if !c.hasToken(HeaderConnection, "upgrade") {
+			return validationErrorf(headerTarget(HeaderConnection), "UpgradeTo", CodeMissing, "upgrade", c.tokens(HeaderConnection),
+				"expected the %q header to have option %q", HeaderConnection, "upgrade")
+		}
+		for _, t := range c.tokens(HeaderUpgrade) {
+			// Ignore the protocol version (eg "websocket/13")
+			name, _, _ := strings.Cut(t, "/")
+			if strings.EqualFold(name, p) || strings.EqualFold(t, p) {
+				return nil
+			}
+		}
+		return validationErrorf(headerTarget(HeaderUpgrade), "UpgradeTo", CodeMissing, p, c.tokens(HeaderUpgrade),
+			"expected the %q header to list %q", HeaderUpgrade, p)
+	}
 }
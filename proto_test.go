@@ -1,7 +1,140 @@
 package vhttp_test
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
 
 func TestProtoValidator(t *testing.T) {
-	t.Errorf("not implemented")
+	cases := []struct {
+		name  string               // Case name
+		proto string               // Proto field
+		major int                  // ProtoMajor field
+		minor int                  // ProtoMinor field
+		v     vhttp.ProtoValidator // Validator to run
+		isErr bool                 // Should an error be returned
+	}{
+		{"is", "HTTP/1.1", 1, 1, vhttp.ProtoIs("HTTP/1.1"), false},
+		{"is-fail", "HTTP/1.0", 1, 0, vhttp.ProtoIs("HTTP/1.1"), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := &http.Request{Proto: c.proto, ProtoMajor: c.major, ProtoMinor: c.minor}
+			if err := vhttp.ValidateRequest(req, c.v); (err != nil) != c.isErr {
+				t.Errorf("expected error to be %t, found %v", c.isErr, err)
+			}
+			res := &http.Response{Proto: c.proto, ProtoMajor: c.major, ProtoMinor: c.minor}
+			if err := vhttp.ValidateResponse(res, c.v); (err != nil) != c.isErr {
+				t.Errorf("expected error to be %t, found %v", c.isErr, err)
+			}
+		})
+	}
+}
+
+func TestProtoVersionValidator(t *testing.T) {
+	cases := []struct {
+		name  string                      // Case name
+		proto string                      // Proto field
+		major int                         // ProtoMajor field
+		minor int                         // ProtoMinor field
+		v     vhttp.ProtoVersionValidator // Validator to run
+		isErr bool                        // Should an error be returned
+	}{
+		{"at-least", "HTTP/2.0", 2, 0, vhttp.ProtoAtLeast(1, 1), false},
+		{"at-least-equal", "HTTP/1.1", 1, 1, vhttp.ProtoAtLeast(1, 1), false},
+		{"at-least-fail", "HTTP/1.0", 1, 0, vhttp.ProtoAtLeast(1, 1), true},
+		{"at-least-invalid", "SPDY/3", 0, 0, vhttp.ProtoAtLeast(1, 0), true},
+		{"http11", "HTTP/1.1", 1, 1, vhttp.ProtoIsHTTP11(), false},
+		{"http11-fail", "HTTP/2.0", 2, 0, vhttp.ProtoIsHTTP11(), true},
+		{"http2", "HTTP/2.0", 2, 0, vhttp.ProtoIsHTTP2(), false},
+		{"http2-from-major-minor", "", 2, 0, vhttp.ProtoIsHTTP2(), false},
+		{"http2-fail", "HTTP/1.1", 1, 1, vhttp.ProtoIsHTTP2(), true},
+		{"http2-short-proto", "HTTP/2", 2, 0, vhttp.ProtoIsHTTP2(), false},
+		{"at-least-short-proto", "HTTP/2", 2, 0, vhttp.ProtoAtLeast(1, 1), false},
+		{"at-least-fields-only", "", 1, 0, vhttp.ProtoAtLeast(1, 1), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := &http.Request{Proto: c.proto, ProtoMajor: c.major, ProtoMinor: c.minor}
+			if err := vhttp.ValidateRequest(req, c.v); (err != nil) != c.isErr {
+				t.Errorf("expected error to be %t, found %v", c.isErr, err)
+			}
+			res := &http.Response{Proto: c.proto, ProtoMajor: c.major, ProtoMinor: c.minor}
+			if err := vhttp.ValidateResponse(res, c.v); (err != nil) != c.isErr {
+				t.Errorf("expected error to be %t, found %v", c.isErr, err)
+			}
+		})
+	}
+}
+
+func TestConnectionValidator(t *testing.T) {
+	cases := []struct {
+		name  string                    // Case name
+		conn  vhttp.Connection          // Connection info
+		v     vhttp.ConnectionValidator // Validator to run
+		isErr bool                      // Should an error be returned
+	}{
+		{"keep-alive-http11", vhttp.Connection{ProtoMajor: 1, ProtoMinor: 1}, vhttp.ConnectionKeepAlive(), false},
+		{"keep-alive-close-flag", vhttp.Connection{ProtoMajor: 1, ProtoMinor: 1, Close: true}, vhttp.ConnectionKeepAlive(), true},
+		{"keep-alive-close-header", vhttp.Connection{ProtoMajor: 1, ProtoMinor: 1, Header: http.Header{"Connection": {"Close"}}}, vhttp.ConnectionKeepAlive(), true},
+		{"keep-alive-http10", vhttp.Connection{ProtoMajor: 1, ProtoMinor: 0}, vhttp.ConnectionKeepAlive(), true},
+		{"keep-alive-http10-header", vhttp.Connection{ProtoMajor: 1, ProtoMinor: 0, Header: http.Header{"Connection": {"Keep-Alive"}}}, vhttp.ConnectionKeepAlive(), false},
+		{"close", vhttp.Connection{ProtoMajor: 1, ProtoMinor: 0}, vhttp.ConnectionClose(), false},
+		{"close-fail", vhttp.Connection{ProtoMajor: 2}, vhttp.ConnectionClose(), true},
+		{"has-option", vhttp.Connection{Header: http.Header{"Connection": {"keep-alive, X-Trace"}}}, vhttp.ConnectionHasOption("x-trace"), false},
+		{"has-option-fail", vhttp.Connection{Header: http.Header{}}, vhttp.ConnectionHasOption("x-trace"), true},
+		{"te-is", vhttp.Connection{TransferEncoding: []string{"gzip", "chunked"}}, vhttp.TransferEncodingIs("gzip", "chunked"), false},
+		{"te-is-fail", vhttp.Connection{TransferEncoding: []string{"chunked"}}, vhttp.TransferEncodingIs("gzip", "chunked"), true},
+		{"te-is-identity", vhttp.Connection{}, vhttp.TransferEncodingIs(), false},
+		{"chunked", vhttp.Connection{TransferEncoding: []string{"chunked"}}, vhttp.TransferEncodingChunked(), false},
+		{"chunked-fail", vhttp.Connection{}, vhttp.TransferEncodingChunked(), true},
+		{"upgrade", vhttp.Connection{Header: http.Header{"Connection": {"Upgrade, HTTP2-Settings"}, "Upgrade": {"h2c"}}}, vhttp.UpgradeTo("h2c"), false},
+		{"upgrade-versioned", vhttp.Connection{Header: http.Header{"Connection": {"upgrade"}, "Upgrade": {"websocket/13, foo"}}}, vhttp.UpgradeTo("WebSocket"), false},
+		{"upgrade-no-option", vhttp.Connection{Header: http.Header{"Upgrade": {"h2c"}}}, vhttp.UpgradeTo("h2c"), true},
+		{"upgrade-other", vhttp.Connection{Header: http.Header{"Connection": {"upgrade"}, "Upgrade": {"websocket"}}}, vhttp.UpgradeTo("h2c"), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.v(c.conn); (err != nil) != c.isErr {
+				t.Errorf("expected error to be %t, found %v", c.isErr, err)
+			}
+		})
+	}
+}
+
+func TestConnectionValidatorServer(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(", world"))
+	})
+
+	// HTTP/1.1 streams the response with chunked encoding
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	res, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if err := vhttp.ValidateResponse(res, vhttp.ProtoIsHTTP11(), vhttp.TransferEncodingChunked(), vhttp.ConnectionKeepAlive()); err != nil {
+		t.Errorf("expected no error, found %v", err)
+	}
+
+	// HTTP/2 is negotiated over TLS
+	ts2 := httptest.NewUnstartedServer(h)
+	ts2.EnableHTTP2 = true
+	ts2.StartTLS()
+	defer ts2.Close()
+	res, err = ts2.Client().Get(ts2.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if err := vhttp.ValidateResponse(res, vhttp.ProtoIsHTTP2(), vhttp.ProtoAtLeast(2, 0), vhttp.TLSNegotiatedProtocolIs("h2")); err != nil {
+		t.Errorf("expected no error, found %v", err)
+	}
 }
@@ -0,0 +1,351 @@
+package vhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Security headers
+const (
+	HeaderStrictTransportSecurity   = "Strict-Transport-Security"
+	HeaderContentSecurityPolicy     = "Content-Security-Policy"
+	HeaderXContentTypeOptions       = "X-Content-Type-Options"
+	HeaderXFrameOptions             = "X-Frame-Options"
+	HeaderReferrerPolicy            = "Referrer-Policy"
+	HeaderPermissionsPolicy         = "Permissions-Policy"
+	HeaderCrossOriginOpenerPolicy   = "Cross-Origin-Opener-Policy"
+	HeaderCrossOriginEmbedderPolicy = "Cross-Origin-Embedder-Policy"
+	HeaderCrossOriginResourcePolicy = "Cross-Origin-Resource-Policy"
+)
+
+// HSTS is a parsed "Strict-Transport-Security" header.
+type HSTS struct {
+	// MaxAge is the value of the "max-age" directive.
+	MaxAge time.Duration
+
+	// IncludeSubDomains reports if the "includeSubDomains" directive
+	// is present.
+	IncludeSubDomains bool
+
+	// Preload reports if the "preload" directive is present.
+	Preload bool
+}
+
+// ParseHSTS parses the value of a "Strict-Transport-Security" header. An
+// error is returned if the "max-age" directive is missing or invalid, or
+// if a directive appears more than once.
+func ParseHSTS(s string) (HSTS, error) {
+	var h HSTS
+	seen := map[string]bool{}
+	hasMaxAge := false
+	for _, d := range strings.Split(s, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(d), "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" {
+			continue
+		}
+		if seen[k] {
+			return HSTS{}, fmt.Errorf("duplicate directive %q", k)
+		}
+		seen[k] = true
+		switch k {
+		case "max-age":
+			n, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(v), `"`), 10, 64)
+			if err != nil || n < 0 {
+				return HSTS{}, fmt.Errorf("invalid max-age %q", v)
+			}
+			if n > maxDeltaSeconds {
+				n = maxDeltaSeconds
+			}
+			h.MaxAge, hasMaxAge = time.Duration(n)*time.Second, true
+		case "includesubdomains":
+			h.IncludeSubDomains = true
+		case "preload":
+			h.Preload = true
+		}
+	}
+	if !hasMaxAge {
+		return HSTS{}, fmt.Errorf("missing max-age directive")
+	}
+	return h, nil
+}
+
+// CSP is a parsed "Content-Security-Policy" header, mapping each
+// directive's name (in lower case) to its source list.
+type CSP map[string][]string
+
+// ParseCSP parses the value of a "Content-Security-Policy" header. If a
+// directive appears more than once, the first one is used.
+func ParseCSP(s string) CSP {
+	csp := CSP{}
+	for _, d := range strings.Split(s, ";") {
+		fs := strings.Fields(d)
+		if len(fs) == 0 {
+			continue
+		}
+		k := strings.ToLower(fs[0])
+		if _, ok := csp[k]; ok {
+			continue
+		}
+		csp[k] = fs[1:]
+	}
+	return csp
+}
+
+// Sources returns the source list that applies to the directive d,
+// falling back to "default-src" for fetch directives (eg "script-src")
+// that aren't set. The second return value reports if either
+// directive is set.
+func (c CSP) Sources(d string) ([]string, bool) {
+	d = strings.ToLower(d)
+	if v, ok := c[d]; ok {
+		return v, true
+	}
+	if strings.Contains(d, "-src") {
+		// script-src-elem falls back to script-src, etc.
+		if base, _, ok := strings.Cut(d, "-src-"); ok {
+			if v, ok := c[base+"-src"]; ok {
+				return v, true
+			}
+		}
+		if v, ok := c["default-src"]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Allows reports if the directive d's source list (see Sources) contains
+// the keyword or source s (eg "'unsafe-inline'"), compared
+// case-insensitively.
+func (c CSP) Allows(d, s string) bool {
+	srcs, _ := c.Sources(d)
+	for _, src := range srcs {
+		if strings.EqualFold(src, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsUnsafeInline reports if the directive d allows inline code. As
+// per CSP level 2, 'unsafe-inline' is ignored if a nonce or hash
+// source is present.
+func (c CSP) allowsUnsafeInline(d string) bool {
+	if !c.Allows(d, "'unsafe-inline'") {
+		return false
+	}
+	srcs, _ := c.Sources(d)
+	for _, src := range srcs {
+		s := strings.ToLower(src)
+		if strings.HasPrefix(s, "'nonce-") || strings.HasPrefix(s, "'sha256-") ||
+			strings.HasPrefix(s, "'sha384-") || strings.HasPrefix(s, "'sha512-") {
+			return false
+		}
+	}
+	return true
+}
+
+// SecurityLevel is how strictly a SecurityProfile audits a response's
+// security headers.
+type SecurityLevel int
+
+// Security levels, from least to most strict.
+const (
+	// SecurityLevelBasic requires HSTS (with a max-age of at least 180
+	// days), "X-Content-Type-Options: nosniff" and framing protection
+	// (CSP "frame-ancestors" or "X-Frame-Options").
+	SecurityLevelBasic SecurityLevel = iota + 1
+
+	// SecurityLevelStandard also requires a HSTS max-age of at least a
+	// year, a Content-Security-Policy that restricts scripts without
+	// 'unsafe-inline' or 'unsafe-eval', and a Referrer-Policy that
+	// doesn't leak full URLs cross-origin.
+	SecurityLevelStandard
+
+	// SecurityLevelStrict also requires HSTS "includeSubDomains" and
+	// "preload", CSP "object-src 'none'" and "base-uri", no 'unsafe-inline'
+	// styles, a strict Referrer-Policy, a Permissions-Policy, and
+	// cross-origin isolation (COOP, COEP and CORP).
+	SecurityLevelStrict
+)
+
+// SecurityProfile audits a response's security headers.
+//
+//	err := vhttp.ValidateResponse(res, vhttp.SecurityProfile{Level: vhttp.SecurityLevelStandard})
+type SecurityProfile struct {
+	// Level is how strict the audit is. Defaults to SecurityLevelStandard.
+	Level SecurityLevel
+
+	// HSTSMinMaxAge, if set, overrides the minimum HSTS max-age required
+	// by the level.
+	HSTSMinMaxAge time.Duration
+}
+
+// SecurityHeaders creates a ResponseValidator that audits the response's
+// security headers at the level l (see SecurityProfile).
+func SecurityHeaders(l SecurityLevel) SecurityProfile {
+	return SecurityProfile{Level: l}
+}
+
+// ValidateResponse audits the response's security headers, returning a
+// ValidationError for each finding.
+func (p SecurityProfile) ValidateResponse(res *http.Response) error {
+	var merr *multierror.Error
+	for _, f := range p.Audit(res.Header) {
+		merr = multierror.Append(merr, f)
+	}
+	return merr.ErrorOrNil()
+}
+
+// Audit audits the security headers hs and returns a ValidationError for
+// each finding, targeting the header it's about.
+func (p SecurityProfile) Audit(hs http.Header) []*ValidationError {
+	level := p.Level
+	if level == 0 {
+		level = SecurityLevelStandard
+	}
+	var out []*ValidationError
+	find := func(h string, code ErrorCode, expected, actual any, format string, args ...any) {
+		out = append(out, &ValidationError{
+			Target:    headerTarget(h),
+			Validator: "SecurityHeaders",
+			Code:      code,
+			Expected:  expected,
+			Actual:    actual,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+	missing := func(h string) {
+		find(h, CodeMissing, nil, nil, "security header %q not found", h)
+	}
+
+	// Strict-Transport-Security
+	if v := hs.Get(HeaderStrictTransportSecurity); v == "" {
+		missing(HeaderStrictTransportSecurity)
+	} else if hsts, err := ParseHSTS(v); err != nil {
+		find(HeaderStrictTransportSecurity, CodeInvalid, nil, v, "invalid %s header %q: %s", HeaderStrictTransportSecurity, v, err)
+	} else {
+		min := p.HSTSMinMaxAge
+		if min == 0 {
+			min = 180 * 24 * time.Hour
+			if level >= SecurityLevelStandard {
+				min = 365 * 24 * time.Hour
+			}
+		}
+		if hsts.MaxAge < min {
+			find(HeaderStrictTransportSecurity, CodeOutOfRange, min, hsts.MaxAge,
+				"expected %s max-age to be at least %d seconds, found %d", HeaderStrictTransportSecurity, int64(min/time.Second), int64(hsts.MaxAge/time.Second))
+		}
+		if level >= SecurityLevelStrict && !hsts.IncludeSubDomains {
+			find(HeaderStrictTransportSecurity, CodeMissing, "includeSubDomains", v, "expected %s to have the includeSubDomains directive", HeaderStrictTransportSecurity)
+		}
+		if level >= SecurityLevelStrict && !hsts.Preload {
+			find(HeaderStrictTransportSecurity, CodeMissing, "preload", v, "expected %s to have the preload directive", HeaderStrictTransportSecurity)
+		}
+	}
+
+	// X-Content-Type-Options
+	if v := hs.Get(HeaderXContentTypeOptions); v == "" {
+		missing(HeaderXContentTypeOptions)
+	} else if !strings.EqualFold(strings.TrimSpace(v), "nosniff") {
+		find(HeaderXContentTypeOptions, CodeMismatch, "nosniff", v, "expected %s to be %q, found %q", HeaderXContentTypeOptions, "nosniff", v)
+	}
+
+	// Content-Security-Policy
+	cspVal := strings.Join(hs.Values(HeaderContentSecurityPolicy), "; ")
+	csp := ParseCSP(cspVal)
+	if level >= SecurityLevelStandard {
+		if cspVal == "" {
+			missing(HeaderContentSecurityPolicy)
+		} else {
+			if _, ok := csp.Sources("script-src"); !ok {
+				find(HeaderContentSecurityPolicy, CodeMissing, "script-src", cspVal, "expected %s to restrict scripts with script-src or default-src", HeaderContentSecurityPolicy)
+			}
+			if csp.allowsUnsafeInline("script-src") {
+				find(HeaderContentSecurityPolicy, CodeUnexpected, nil, "'unsafe-inline'", "expected %s script-src not to allow 'unsafe-inline'", HeaderContentSecurityPolicy)
+			}
+			if csp.Allows("script-src", "'unsafe-eval'") {
+				find(HeaderContentSecurityPolicy, CodeUnexpected, nil, "'unsafe-eval'", "expected %s script-src not to allow 'unsafe-eval'", HeaderContentSecurityPolicy)
+			}
+		}
+	}
+	if level >= SecurityLevelStrict && cspVal != "" {
+		if srcs, _ := csp.Sources("object-src"); len(srcs) != 1 || srcs[0] != "'none'" {
+			find(HeaderContentSecurityPolicy, CodeMismatch, "'none'", srcs, "expected %s object-src to be 'none'", HeaderContentSecurityPolicy)
+		}
+		if _, ok := csp["base-uri"]; !ok {
+			find(HeaderContentSecurityPolicy, CodeMissing, "base-uri", cspVal, "expected %s to have the base-uri directive", HeaderContentSecurityPolicy)
+		}
+		if csp.allowsUnsafeInline("style-src") {
+			find(HeaderContentSecurityPolicy, CodeUnexpected, nil, "'unsafe-inline'", "expected %s style-src not to allow 'unsafe-inline'", HeaderContentSecurityPolicy)
+		}
+	}
+
+	// Framing protection
+	if _, ok := csp["frame-ancestors"]; !ok {
+		switch v := strings.ToUpper(strings.TrimSpace(hs.Get(HeaderXFrameOptions))); v {
+		case "DENY", "SAMEORIGIN":
+		case "":
+			find(HeaderXFrameOptions, CodeMissing, nil, nil, "expected %s frame-ancestors or %s to prevent framing", HeaderContentSecurityPolicy, HeaderXFrameOptions)
+		default:
+			find(HeaderXFrameOptions, CodeInvalid, []string{"DENY", "SAMEORIGIN"}, v, "expected %s to be DENY or SAMEORIGIN, found %q", HeaderXFrameOptions, v)
+		}
+	}
+
+	// Referrer-Policy (the last recognized value is used)
+	if level >= SecurityLevelStandard {
+		policy := ""
+		for _, v := range hs.Values(HeaderReferrerPolicy) {
+			for _, t := range splitHeaderList(v) {
+				switch t = strings.ToLower(t); t {
+				case "no-referrer", "no-referrer-when-downgrade", "same-origin", "origin",
+					"strict-origin", "origin-when-cross-origin", "strict-origin-when-cross-origin", "unsafe-url":
+					policy = t
+				}
+			}
+		}
+		switch policy {
+		case "":
+			missing(HeaderReferrerPolicy)
+		case "unsafe-url", "no-referrer-when-downgrade":
+			find(HeaderReferrerPolicy, CodeUnexpected, nil, policy, "expected %s not to be %q", HeaderReferrerPolicy, policy)
+		case "origin", "origin-when-cross-origin":
+			if level >= SecurityLevelStrict {
+				find(HeaderReferrerPolicy, CodeUnexpected, nil, policy, "expected %s not to be %q", HeaderReferrerPolicy, policy)
+			}
+		}
+	}
+
+	// Strict-only headers
+	if level >= SecurityLevelStrict {
+		if strings.TrimSpace(hs.Get(HeaderPermissionsPolicy)) == "" {
+			missing(HeaderPermissionsPolicy)
+		}
+		checkToken := func(h string, allowed ...string) {
+			v := strings.ToLower(strings.TrimSpace(hs.Get(h)))
+			if i := strings.IndexByte(v, ';'); i >= 0 {
+				v = strings.TrimSpace(v[:i]) // Ignore parameters (eg report-to)
+			}
+			if v == "" {
+				missing(h)
+				return
+			}
+			for _, a := range allowed {
+				if v == a {
+					return
+				}
+			}
+			find(h, CodeMismatch, allowed, v, "expected %s to be one of %q, found %q", h, allowed, v)
+		}
+		checkToken(HeaderCrossOriginOpenerPolicy, "same-origin")
+		checkToken(HeaderCrossOriginEmbedderPolicy, "require-corp", "credentialless")
+		checkToken(HeaderCrossOriginResourcePolicy, "same-origin", "same-site")
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package vhttp_test
+
+import (
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestParseHSTS(t *testing.T) {
+	cases := []struct {
+		value string     // Header value
+		hsts  vhttp.HSTS // Expected result
+		isErr bool       // Should an error be returned
+	}{
+		{"max-age=31536000", vhttp.HSTS{MaxAge: 365 * 24 * time.Hour}, false},
+		{`max-age="600"; includeSubDomains; preload`, vhttp.HSTS{MaxAge: 10 * time.Minute, IncludeSubDomains: true, Preload: true}, false},
+		{"includeSubDomains", vhttp.HSTS{}, true},
+		{"max-age=abc", vhttp.HSTS{}, true},
+		{"max-age=1; max-age=2", vhttp.HSTS{}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			hsts, err := vhttp.ParseHSTS(c.value)
+			if (err != nil) != c.isErr {
+				t.Fatalf("expected error to be %t, found %v", c.isErr, err)
+			}
+			if hsts != c.hsts {
+				t.Errorf("expected %+v, found %+v", c.hsts, hsts)
+			}
+		})
+	}
+}
+
+func TestParseCSP(t *testing.T) {
+	csp := vhttp.ParseCSP("default-src 'self'; script-src 'self' 'nonce-abc' 'unsafe-inline'; img-src *; script-src 'none'")
+	if srcs, _ := csp.Sources("script-src"); len(srcs) != 3 {
+		t.Errorf("expected the first script-src to be used, found %v", srcs)
+	}
+	if srcs, ok := csp.Sources("style-src"); !ok || len(srcs) != 1 || srcs[0] != "'self'" {
+		t.Errorf("expected style-src to fall back to default-src, found %v", srcs)
+	}
+	if srcs, _ := csp.Sources("script-src-elem"); len(srcs) != 3 {
+		t.Errorf("expected script-src-elem to fall back to script-src, found %v", srcs)
+	}
+	if _, ok := csp.Sources("base-uri"); ok {
+		t.Error("expected base-uri not to fall back to default-src")
+	}
+	if !csp.Allows("script-src", "'UNSAFE-INLINE'") || csp.Allows("img-src", "'self'") {
+		t.Error("unexpected Allows result")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	strict := http.Header{
+		"Strict-Transport-Security":    {"max-age=63072000; includeSubDomains; preload"},
+		"Content-Security-Policy":      {"default-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'"},
+		"X-Content-Type-Options":       {"nosniff"},
+		"Referrer-Policy":              {"no-referrer, strict-origin-when-cross-origin"},
+		"Permissions-Policy":           {"geolocation=(), camera=()"},
+		"Cross-Origin-Opener-Policy":   {"same-origin"},
+		"Cross-Origin-Embedder-Policy": {"require-corp"},
+		"Cross-Origin-Resource-Policy": {"same-site"},
+	}
+	with := func(h http.Header, k, v string) http.Header {
+		h = h.Clone()
+		if v == "" {
+			h.Del(k)
+		} else {
+			h.Set(k, v)
+		}
+		return h
+	}
+	cases := []struct {
+		name    string              // Case name
+		level   vhttp.SecurityLevel // Audit level
+		headers http.Header         // Response headers
+		targets []string            // Expected finding targets (sorted)
+	}{
+		{
+			name:    "strict-success",
+			level:   vhttp.SecurityLevelStrict,
+			headers: strict,
+		},
+		{
+			name:    "empty-basic",
+			level:   vhttp.SecurityLevelBasic,
+			headers: http.Header{},
+			targets: []string{`header["Strict-Transport-Security"]`, `header["X-Content-Type-Options"]`, `header["X-Frame-Options"]`},
+		},
+		{
+			name:  "basic-success",
+			level: vhttp.SecurityLevelBasic,
+			headers: http.Header{
+				"Strict-Transport-Security": {"max-age=15552000"},
+				"X-Content-Type-Options":    {"nosniff"},
+				"X-Frame-Options":           {"deny"},
+			},
+		},
+		{
+			name:  "standard-short-hsts",
+			level: vhttp.SecurityLevelStandard,
+			headers: http.Header{
+				"Strict-Transport-Security": {"max-age=15552000"},
+				"Content-Security-Policy":   {"script-src 'self'"},
+				"X-Content-Type-Options":    {"nosniff"},
+				"X-Frame-Options":           {"SAMEORIGIN"},
+				"Referrer-Policy":           {"same-origin"},
+			},
+			targets: []string{`header["Strict-Transport-Security"]`},
+		},
+		{
+			name:    "unsafe-inline-and-eval",
+			level:   vhttp.SecurityLevelStandard,
+			headers: with(strict, "Content-Security-Policy", "default-src 'self' 'unsafe-inline' 'unsafe-eval'; frame-ancestors 'self'"),
+			targets: []string{`header["Content-Security-Policy"]`, `header["Content-Security-Policy"]`},
+		},
+		{
+			name:    "unsafe-inline-with-nonce",
+			level:   vhttp.SecurityLevelStandard,
+			headers: with(strict, "Content-Security-Policy", "script-src 'nonce-abc123' 'unsafe-inline'; frame-ancestors 'self'"),
+		},
+		{
+			name:    "csp-without-script-restriction",
+			level:   vhttp.SecurityLevelStandard,
+			headers: with(strict, "Content-Security-Policy", "img-src 'self'; frame-ancestors 'self'"),
+			targets: []string{`header["Content-Security-Policy"]`},
+		},
+		{
+			name:    "strict-csp",
+			level:   vhttp.SecurityLevelStrict,
+			headers: with(strict, "Content-Security-Policy", "default-src 'self'; style-src 'unsafe-inline'; frame-ancestors 'self'"),
+			targets: []string{`header["Content-Security-Policy"]`, `header["Content-Security-Policy"]`, `header["Content-Security-Policy"]`},
+		},
+		{
+			name:    "allow-from-frame-options",
+			level:   vhttp.SecurityLevelBasic,
+			headers: with(with(strict, "Content-Security-Policy", ""), "X-Frame-Options", "ALLOW-FROM https://example.com"),
+			targets: []string{`header["X-Frame-Options"]`},
+		},
+		{
+			name:    "unsafe-referrer",
+			level:   vhttp.SecurityLevelStandard,
+			headers: with(strict, "Referrer-Policy", "unknown-policy, unsafe-url"),
+			targets: []string{`header["Referrer-Policy"]`},
+		},
+		{
+			name:    "origin-referrer",
+			level:   vhttp.SecurityLevelStrict,
+			headers: with(strict, "Referrer-Policy", "origin"),
+			targets: []string{`header["Referrer-Policy"]`},
+		},
+		{
+			name:    "strict-cross-origin",
+			level:   vhttp.SecurityLevelStrict,
+			headers: with(with(with(strict, "Cross-Origin-Opener-Policy", "unsafe-none"), "Cross-Origin-Embedder-Policy", ""), "Permissions-Policy", ""),
+			targets: []string{`header["Cross-Origin-Embedder-Policy"]`, `header["Cross-Origin-Opener-Policy"]`, `header["Permissions-Policy"]`},
+		},
+		{
+			name:    "strict-hsts",
+			level:   vhttp.SecurityLevelStrict,
+			headers: with(strict, "Strict-Transport-Security", "max-age=63072000"),
+			targets: []string{`header["Strict-Transport-Security"]`, `header["Strict-Transport-Security"]`},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: http.StatusOK, Header: c.headers}
+			errs := vhttp.ValidationErrors(vhttp.ValidateResponse(res, vhttp.SecurityHeaders(c.level)))
+			var targets []string
+			for _, e := range errs {
+				targets = append(targets, e.Target)
+			}
+			sort.Strings(targets)
+			if len(targets) != len(c.targets) {
+				t.Fatalf("expected findings for %v, found %v", c.targets, errs)
+			}
+			for i := range targets {
+				if targets[i] != c.targets[i] {
+					t.Errorf("expected findings for %v, found %v", c.targets, errs)
+					break
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package vhttp
 
 import (
-	"fmt"
 	"net/http"
 )
 
@@ -16,7 +15,8 @@ func (v StatusCodeValidator) ValidateResponse(res *http.Response) error {
 func StatusIs(code int) StatusCodeValidator {
 	return func(c int) error {
 		if c != code {
-			return fmt.Errorf("expected status code is %d, got %d", code, c)
+			return validationErrorf("status", "StatusIs", CodeMismatch, code, c,
+				"expected status code is %d, got %d", code, c)
 		}
 		return nil
 	}
@@ -26,7 +26,8 @@ func StatusIs(code int) StatusCodeValidator {
 func StatusIsNot(code int) StatusCodeValidator {
 	return func(c int) error {
 		if c == code {
-			return fmt.Errorf("expected status code to not be %d", code)
+			return validationErrorf("status", "StatusIsNot", CodeUnexpected, code, c,
+				"expected status code to not be %d", code)
 		}
 		return nil
 	}
@@ -41,7 +42,8 @@ func StatusIsOK() StatusCodeValidator {
 func StatusInRange(min, max int) StatusCodeValidator {
 	return func(c int) error {
 		if c < min || c >= max {
-			return fmt.Errorf("expected status code to be in range [%d, %d), got %d", min, max, c)
+			return validationErrorf("status", "StatusInRange", CodeOutOfRange, [2]int{min, max}, c,
+				"expected status code to be in range [%d, %d), got %d", min, max, c)
 		}
 		return nil
 	}
@@ -51,7 +53,8 @@ func StatusInRange(min, max int) StatusCodeValidator {
 func StatusNotInRange(min, max int) StatusCodeValidator {
 	return func(c int) error {
 		if c >= min && c < max {
-			return fmt.Errorf("expected status code to not be in range [%d, %d)", min, max)
+			return validationErrorf("status", "StatusNotInRange", CodeUnexpected, [2]int{min, max}, c,
+				"expected status code to not be in range [%d, %d)", min, max)
 		}
 		return nil
 	}
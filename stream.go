@@ -0,0 +1,239 @@
+package vhttp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// StreamValidator is a validator that validates an http.Request or
+// http.Response's body as a stream, reading it from r rather than
+// buffering all of it in memory (unlike a BodyValidator). This makes it
+// suitable for large bodies, such as file downloads.
+//
+// Because the body isn't buffered, it can't be read again afterwards: it's
+// closed and replaced with http.NoBody. When CacheBodyReads is set, the
+// validators that run after it in the same call return an InternalError
+// instead of reading an empty body. The exception is a body that has
+// already been read into memory (when CacheBodyReads is set and a
+// BodyValidator has run first), which is streamed from memory and left as
+// it is.
+//
+// To run more than one StreamValidator over a single read of the body,
+// combine them with StreamBody.
+type StreamValidator func(r io.Reader) error
+
+func (v StreamValidator) ValidateRequest(req *http.Request) error {
+	body, err := v.stream(req.Body)
+	req.Body = body
+	return err
+}
+
+func (v StreamValidator) ValidateResponse(res *http.Response) error {
+	body, err := v.stream(res.Body)
+	res.Body = body
+	return err
+}
+
+// stream runs the validator over body and returns the body that should
+// replace it.
+func (v StreamValidator) stream(body io.ReadCloser) (io.ReadCloser, error) {
+	// Is there anything to read?
+	if body == nil || body == http.NoBody {
+		return body, v(http.NoBody)
+	}
+
+	// Is the body being shared?
+	if sb, ok := body.(*sharedBody); ok {
+		if sb.loaded && sb.err == nil {
+			return sb, v(bytes.NewReader(sb.b))
+		}
+		if !sb.loaded {
+			// Stream the underlying body, so that later reads fail
+			src := sb.src
+			sb.loaded, sb.r, sb.err = true, http.NoBody, errBodyStreamed
+			err := v(src)
+			src.Close()
+			return sb, err
+		}
+
+		// It was too large to be read fully (or failed), so stream the rest
+		err := v(sb)
+		sb.r.Close()
+		return http.NoBody, err
+	}
+
+	err := v(body)
+	body.Close()
+	return http.NoBody, err
+}
+
+// errBodyStreamed is the error from reading a shared body (see
+// CacheBodyReads) after a StreamValidator has consumed it.
+var errBodyStreamed = errors.New("body was already read by a StreamValidator")
+
+// streamReadErr returns the InternalError for a failed read of a body.
+func streamReadErr(err error) error {
+	return InternalErr(fmt.Errorf("failed to read body: %w", err))
+}
+
+// StreamBody creates a StreamValidator that reads the body once, passing it
+// to each of the validators vs at the same time.
+//
+// Each validator reads from its own copy of the stream, so one that stops
+// reading early doesn't affect the others.
+//
+//	v := vhttp.StreamBody(
+//		vhttp.StreamMaxSize(1<<30),
+//		vhttp.StreamChecksum(sha256.New, "9f86d0..."),
+//	)
+func StreamBody(vs ...StreamValidator) StreamValidator {
+	return func(r io.Reader) error {
+		errs := make([]error, len(vs))
+		ws := make([]io.Writer, len(vs))
+		pws := make([]*io.PipeWriter, len(vs))
+		var wg sync.WaitGroup
+		for i, v := range vs {
+			pr, pw := io.Pipe()
+			ws[i], pws[i] = pw, pw
+			wg.Add(1)
+			go func(i int, v StreamValidator) {
+				defer wg.Done()
+				errs[i] = v(pr)
+
+				// Discard whatever the validator didn't read so that
+				// the others aren't blocked
+				io.Copy(io.Discard, pr)
+			}(i, v)
+		}
+
+		_, err := io.Copy(io.MultiWriter(ws...), r)
+		for _, pw := range pws {
+			pw.CloseWithError(err)
+		}
+		wg.Wait()
+		if err != nil {
+			return streamReadErr(err)
+		}
+
+		var merr *multierror.Error
+		for _, err := range errs {
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+		return merr.ErrorOrNil()
+	}
+}
+
+// StreamChecksum creates a StreamValidator that hashes the body with the
+// hash function returned by newHash and checks that the digest is sum,
+// hex-encoded (compared case-insensitively).
+//
+//	v := vhttp.StreamChecksum(sha256.New, "9f86d081884c7d65...")
+func StreamChecksum(newHash func() hash.Hash, sum string) StreamValidator {
+	return func(r io.Reader) error {
+		h := newHash()
+		if _, err := io.Copy(h, r); err != nil {
+			return streamReadErr(err)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, sum) {
+			return validationErrorf("body", "StreamChecksum", CodeMismatch, sum, got,
+				"expected body checksum %s, found %s", sum, got)
+		}
+		return nil
+	}
+}
+
+// StreamMaxSize creates a StreamValidator that checks that the body is at
+// most n bytes. It stops reading once the limit is exceeded.
+func StreamMaxSize(n int64) StreamValidator {
+	return func(r io.Reader) error {
+		size, err := io.Copy(io.Discard, io.LimitReader(r, n+1))
+		if err != nil {
+			return streamReadErr(err)
+		}
+		if size > n {
+			return validationErrorf("body", "StreamMaxSize", CodeTooLarge, n, nil,
+				"expected body to be at most %d bytes", n)
+		}
+		return nil
+	}
+}
+
+// StreamMinSize creates a StreamValidator that checks that the body is at
+// least n bytes. It stops reading once the minimum has been reached.
+func StreamMinSize(n int64) StreamValidator {
+	return func(r io.Reader) error {
+		size, err := io.CopyN(io.Discard, r, n)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return streamReadErr(err)
+		}
+		if size < n {
+			return validationErrorf("body", "StreamMinSize", CodeOutOfRange, n, size,
+				"expected body to be at least %d bytes, found %d", n, size)
+		}
+		return nil
+	}
+}
+
+// StreamLineCount creates a StreamValidator that checks that the number of
+// lines in the body is between min and max (inclusive). Lines are separated
+// by "\n" and a final line doesn't need to end with one. An empty body has
+// no lines.
+func StreamLineCount(min, max int) StreamValidator {
+	return func(r io.Reader) error {
+		var n int
+		var last byte
+		var read bool
+		buf := make([]byte, 32*1024)
+		for {
+			m, err := r.Read(buf)
+			if m > 0 {
+				n += bytes.Count(buf[:m], []byte("\n"))
+				last, read = buf[m-1], true
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return streamReadErr(err)
+			}
+		}
+		if read && last != '\n' {
+			n++
+		}
+		if n < min || n > max {
+			return validationErrorf("body", "StreamLineCount", CodeOutOfRange, [2]int{min, max}, n,
+				"expected between %d and %d lines in body, found %d", min, max, n)
+		}
+		return nil
+	}
+}
+
+// StreamDetectedTypeIs creates a StreamValidator that uses the
+// http.DetectContentType function to guess the content type of the body and
+// returns an error if it does not match the expected type t. Only the first
+// 512 bytes of the body are read.
+func StreamDetectedTypeIs(t string) StreamValidator {
+	return func(r io.Reader) error {
+		buf := make([]byte, 512)
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return streamReadErr(err)
+		}
+		if res := http.DetectContentType(buf[:n]); res != t {
+			return validationErrorf("body", "StreamDetectedTypeIs", CodeMismatch, t, res,
+				"body detected type is not %s", t)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package vhttp_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+	"github.com/hashicorp/go-multierror"
+)
+
+// errReader is an io.Reader that returns n bytes and then fails.
+type errReader struct{ n int }
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+func TestStreamValidator(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello, world\n"))
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 1024)
+	cases := []struct {
+		name string                // Case name
+		body string                // Body to validate
+		v    vhttp.StreamValidator // Validator to run
+		code vhttp.ErrorCode       // Expected error code (empty for success)
+	}{
+		{"checksum", "hello, world\n", vhttp.StreamChecksum(sha256.New, hex.EncodeToString(sum[:])), ""},
+		{"checksum-upper", "hello, world\n", vhttp.StreamChecksum(sha256.New, strings.ToUpper(hex.EncodeToString(sum[:]))), ""},
+		{"checksum-fail", "hello, world", vhttp.StreamChecksum(sha256.New, hex.EncodeToString(sum[:])), vhttp.CodeMismatch},
+		{"max-size", "hello", vhttp.StreamMaxSize(5), ""},
+		{"max-size-fail", "hello, world", vhttp.StreamMaxSize(5), vhttp.CodeTooLarge},
+		{"min-size", "hello", vhttp.StreamMinSize(5), ""},
+		{"min-size-fail", "hey", vhttp.StreamMinSize(5), vhttp.CodeOutOfRange},
+		{"line-count", "a\nb\nc", vhttp.StreamLineCount(3, 3), ""},
+		{"line-count-trailing-newline", "a\nb\nc\n", vhttp.StreamLineCount(3, 3), ""},
+		{"line-count-empty", "", vhttp.StreamLineCount(0, 0), ""},
+		{"line-count-fail", "a\nb", vhttp.StreamLineCount(3, 10), vhttp.CodeOutOfRange},
+		{"detected-type", png, vhttp.StreamDetectedTypeIs("image/png"), ""},
+		{"detected-type-short", "hello", vhttp.StreamDetectedTypeIs("text/plain; charset=utf-8"), ""},
+		{"detected-type-fail", "hello", vhttp.StreamDetectedTypeIs("image/png"), vhttp.CodeMismatch},
+		{"combined", "hello, world\n", vhttp.StreamBody(
+			vhttp.StreamDetectedTypeIs("text/plain; charset=utf-8"),
+			vhttp.StreamMinSize(1),
+			vhttp.StreamMaxSize(1024),
+			vhttp.StreamChecksum(sha256.New, hex.EncodeToString(sum[:])),
+			vhttp.StreamLineCount(1, 1),
+		), ""},
+		{"combined-fail", "hello, world\n", vhttp.StreamBody(
+			vhttp.StreamDetectedTypeIs("image/png"),
+			vhttp.StreamMaxSize(1024),
+		), vhttp.CodeMismatch},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &http.Response{Body: io.NopCloser(strings.NewReader(c.body))}
+			err := vhttp.ValidateResponse(res, c.v)
+			checkErrCode(t, err, c.code)
+		})
+	}
+}
+
+func TestStreamValidatorBody(t *testing.T) {
+	body := []byte("hello, world")
+	v := vhttp.StreamMaxSize(int64(len(body)))
+
+	// The body is consumed
+	req := &http.Request{Body: io.NopCloser(bytes.NewReader(body))}
+	if err := vhttp.ValidateRequest(req, v); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if req.Body != http.NoBody {
+		t.Errorf("expected the body to be replaced with http.NoBody")
+	}
+
+	// A cached body is streamed from memory and left readable
+	vhttp.CacheBodyReads = true
+	defer func() { vhttp.CacheBodyReads = false }()
+	req = &http.Request{Body: io.NopCloser(bytes.NewReader(body))}
+	if err := vhttp.ValidateRequest(req, vhttp.BodyIs(body), v); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, _ := io.ReadAll(req.Body); !bytes.Equal(b, body) {
+		t.Errorf("expected body %q, got %q", body, b)
+	}
+
+	// Body validators after a streamed body fail rather than see it empty
+	req = &http.Request{Body: io.NopCloser(bytes.NewReader(body))}
+	err := vhttp.ValidateRequest(req, v, vhttp.BodyIsNil(), vhttp.BodyIsValidJSON())
+	var merr *multierror.Error
+	if !errors.As(err, &merr) || len(merr.Errors) != 2 {
+		t.Fatalf("expected 2 errors, found %v", err)
+	}
+	for _, err := range merr.Errors {
+		var ierr vhttp.InternalError
+		if !errors.As(err, &ierr) || !strings.Contains(err.Error(), "already read") {
+			t.Errorf("expected an internal error for the streamed body, found %v", err)
+		}
+	}
+	if req.Body != http.NoBody {
+		t.Errorf("expected the body to be replaced with http.NoBody")
+	}
+	res := &http.Response{Body: io.NopCloser(bytes.NewReader(body))}
+	var ierr vhttp.InternalError
+	if err := vhttp.ValidateResponse(res, v, vhttp.BodyIs(body)); !errors.As(err, &ierr) {
+		t.Errorf("expected an internal error for the streamed body, found %v", err)
+	}
+
+	// Streaming validators work on bodies over MaxBodyBytes
+	vhttp.MaxBodyBytes = 5
+	defer func() { vhttp.MaxBodyBytes = 0 }()
+	req = &http.Request{Body: io.NopCloser(bytes.NewReader(body))}
+	err = vhttp.ValidateRequest(req, vhttp.BodyIs(body), v)
+	if errs := vhttp.ValidationErrors(err); len(errs) != 1 || errs[0].Validator != "MaxBodyBytes" {
+		t.Errorf("expected only the MaxBodyBytes error, found %v", err)
+	}
+
+	// Read errors are internal errors
+	res = &http.Response{Body: io.NopCloser(&errReader{n: 100})}
+	err = vhttp.ValidateResponse(res, vhttp.StreamBody(v, vhttp.StreamLineCount(0, 1)))
+	if !errors.As(err, &ierr) {
+		t.Errorf("expected an internal error, found %v", err)
+	}
+}
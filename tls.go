@@ -1,13 +1,22 @@
 package vhttp
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
+	"regexp"
+	"time"
 )
 
 // TLSValidator is a validator that validates an http.Request or http.Response
 // object's TLS connection.
+//
+// The connection state is nil for connections that didn't use TLS. Unless
+// otherwise noted, TLSValidators fail (rather than panic) if it is nil.
 type TLSValidator func(*tls.ConnectionState) error
 
 func (v TLSValidator) ValidateRequest(req *http.Request) error {
@@ -18,32 +27,392 @@ func (v TLSValidator) ValidateResponse(res *http.Response) error {
 	return v(res.TLS)
 }
 
+// tlsState returns an error if the connection state cs is nil.
+func tlsState(validator string, cs *tls.ConnectionState) error {
+	if cs == nil {
+		return validationErrorf("tls", validator, CodeMissing, nil, nil,
+			"tls is nil")
+	}
+	return nil
+}
+
+// tlsVersionName returns a readable name for the TLS version v.
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04X", v)
+}
+
+// TLSIsNil creates a TLSValidator that checks that the connection
+// didn't use TLS.
 func TLSIsNil() TLSValidator {
 	return func(tls *tls.ConnectionState) error {
 		if tls != nil {
-			return fmt.Errorf("tls is not nil")
+			return validationErrorf("tls", "TLSIsNil", CodeUnexpected, nil, tls,
+				"tls is not nil")
 		}
 
 		return nil
 	}
 }
 
+// TLSIsNotNil creates a TLSValidator that checks that the connection
+// used TLS.
 func TLSIsNotNil() TLSValidator {
 	return func(tls *tls.ConnectionState) error {
-		if tls != nil {
-			return fmt.Errorf("tls is nil")
+		if tls == nil {
+			return validationErrorf("tls", "TLSIsNotNil", CodeMissing, nil, nil,
+				"tls is nil")
 		}
 
 		return nil
 	}
 }
 
+// TLSVersionIs creates a TLSValidator that checks that the connection's
+// TLS version is v (eg tls.VersionTLS13).
 func TLSVersionIs(v uint16) TLSValidator {
 	return func(tls *tls.ConnectionState) error {
+		if err := tlsState("TLSVersionIs", tls); err != nil {
+			return err
+		}
 		if tls.Version != v {
-			return fmt.Errorf("tls version is not %d", v)
+			return validationErrorf("tls.version", "TLSVersionIs", CodeMismatch, v, tls.Version,
+				"tls version is not %s, found %s", tlsVersionName(v), tlsVersionName(tls.Version))
+		}
+
+		return nil
+	}
+}
+
+// TLSMinVersion creates a TLSValidator that checks that the connection's
+// TLS version is at least v (eg tls.VersionTLS12).
+func TLSMinVersion(v uint16) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		if err := tlsState("TLSMinVersion", cs); err != nil {
+			return err
+		}
+		if cs.Version < v {
+			return validationErrorf("tls.version", "TLSMinVersion", CodeOutOfRange, v, cs.Version,
+				"expected tls version to be at least %s, found %s", tlsVersionName(v), tlsVersionName(cs.Version))
 		}
+		return nil
+	}
+}
+
+// TLSCipherSuiteIn creates a TLSValidator that checks that the
+// connection's cipher suite is one of ids (eg
+// tls.TLS_AES_128_GCM_SHA256).
+func TLSCipherSuiteIn(ids ...uint16) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		if err := tlsState("TLSCipherSuiteIn", cs); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if cs.CipherSuite == id {
+				return nil
+			}
+		}
+		return validationErrorf("tls.cipher_suite", "TLSCipherSuiteIn", CodeNoMatch, ids, cs.CipherSuite,
+			"cipher suite %s is not allowed", tls.CipherSuiteName(cs.CipherSuite))
+	}
+}
+
+// TLSCipherSuiteNotIn creates a TLSValidator that checks that the
+// connection's cipher suite isn't one of ids.
+func TLSCipherSuiteNotIn(ids ...uint16) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		if err := tlsState("TLSCipherSuiteNotIn", cs); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if cs.CipherSuite == id {
+				return validationErrorf("tls.cipher_suite", "TLSCipherSuiteNotIn", CodeUnexpected, nil, cs.CipherSuite,
+					"cipher suite %s is not allowed", tls.CipherSuiteName(cs.CipherSuite))
+			}
+		}
+		return nil
+	}
+}
 
+// TLSCipherSuiteIsSecure creates a TLSValidator that checks that the
+// connection's cipher suite isn't one of those returned by
+// tls.InsecureCipherSuites.
+func TLSCipherSuiteIsSecure() TLSValidator {
+	var ids []uint16
+	for _, s := range tls.InsecureCipherSuites() {
+		ids = append(ids, s.ID)
+	}
+	return TLSCipherSuiteNotIn(ids...)
+}
+
+// TLSNegotiatedProtocolIs creates a TLSValidator that checks that the
+// application protocol negotiated with ALPN is p (eg "h2").
+func TLSNegotiatedProtocolIs(p string) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		if err := tlsState("TLSNegotiatedProtocolIs", cs); err != nil {
+			return err
+		}
+		if cs.NegotiatedProtocol != p {
+			return validationErrorf("tls.negotiated_protocol", "TLSNegotiatedProtocolIs", CodeMismatch, p, cs.NegotiatedProtocol,
+				"expected negotiated protocol %q, found %q", p, cs.NegotiatedProtocol)
+		}
+		return nil
+	}
+}
+
+// TLSServerNameIs creates a TLSValidator that checks that the server name
+// sent by the client with SNI is name.
+func TLSServerNameIs(name string) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		if err := tlsState("TLSServerNameIs", cs); err != nil {
+			return err
+		}
+		if cs.ServerName != name {
+			return validationErrorf("tls.server_name", "TLSServerNameIs", CodeMismatch, name, cs.ServerName,
+				"expected server name %q, found %q", name, cs.ServerName)
+		}
+		return nil
+	}
+}
+
+// TLSDidResume creates a TLSValidator that checks whether the connection
+// resumed a previous session.
+func TLSDidResume(resumed bool) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		if err := tlsState("TLSDidResume", cs); err != nil {
+			return err
+		}
+		if cs.DidResume != resumed {
+			return validationErrorf("tls.did_resume", "TLSDidResume", CodeMismatch, resumed, cs.DidResume,
+				"expected did resume to be %t", resumed)
+		}
+		return nil
+	}
+}
+
+// TLSHasOCSPStaple creates a TLSValidator that checks that the server
+// stapled an OCSP response.
+func TLSHasOCSPStaple() TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		if err := tlsState("TLSHasOCSPStaple", cs); err != nil {
+			return err
+		}
+		if len(cs.OCSPResponse) == 0 {
+			return validationErrorf("tls.ocsp_response", "TLSHasOCSPStaple", CodeMissing, nil, nil,
+				"expected a stapled OCSP response")
+		}
+		return nil
+	}
+}
+
+// tlsPeer returns the connection's leaf peer certificate.
+func tlsPeer(validator string, cs *tls.ConnectionState) (*x509.Certificate, error) {
+	if err := tlsState(validator, cs); err != nil {
+		return nil, err
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return nil, validationErrorf("tls.peer_certificates", validator, CodeMissing, nil, nil,
+			"no peer certificates")
+	}
+	return cs.PeerCertificates[0], nil
+}
+
+// TLSPeerCertificate creates a TLSValidator that runs fn on the
+// connection's leaf peer certificate.
+func TLSPeerCertificate(fn func(*x509.Certificate) error) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer("TLSPeerCertificate", cs)
+		if err != nil {
+			return err
+		}
+		return fn(cert)
+	}
+}
+
+// TLSPeerSubjectCNIs creates a TLSValidator that checks that the leaf
+// peer certificate's subject common name is cn.
+func TLSPeerSubjectCNIs(cn string) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer("TLSPeerSubjectCNIs", cs)
+		if err != nil {
+			return err
+		}
+		if got := cert.Subject.CommonName; got != cn {
+			return validationErrorf("tls.peer.subject", "TLSPeerSubjectCNIs", CodeMismatch, cn, got,
+				"expected peer certificate subject CN %q, found %q", cn, got)
+		}
+		return nil
+	}
+}
+
+// TLSPeerSubjectMatches creates a TLSValidator that checks that the leaf
+// peer certificate's subject (as a RFC 2253 string, eg
+// "CN=api,O=Example") matches the regular expression re.
+func TLSPeerSubjectMatches(re *regexp.Regexp) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer("TLSPeerSubjectMatches", cs)
+		if err != nil {
+			return err
+		}
+		if got := cert.Subject.String(); !re.MatchString(got) {
+			return validationErrorf("tls.peer.subject", "TLSPeerSubjectMatches", CodeNoMatch, re.String(), got,
+				"expected peer certificate subject to match %q, found %q", re, got)
+		}
+		return nil
+	}
+}
+
+// TLSPeerIssuerCNIs creates a TLSValidator that checks that the leaf
+// peer certificate's issuer common name is cn.
+func TLSPeerIssuerCNIs(cn string) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer("TLSPeerIssuerCNIs", cs)
+		if err != nil {
+			return err
+		}
+		if got := cert.Issuer.CommonName; got != cn {
+			return validationErrorf("tls.peer.issuer", "TLSPeerIssuerCNIs", CodeMismatch, cn, got,
+				"expected peer certificate issuer CN %q, found %q", cn, got)
+		}
+		return nil
+	}
+}
+
+// tlsSANs returns the certificate's subject alternative names as strings.
+func tlsSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+// TLSPeerHasSAN creates a TLSValidator that checks that the leaf peer
+// certificate has the subject alternative name san. It's compared
+// against the certificate's DNS names, email addresses, IP addresses
+// and URIs.
+func TLSPeerHasSAN(san string) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer("TLSPeerHasSAN", cs)
+		if err != nil {
+			return err
+		}
+		sans := tlsSANs(cert)
+		for _, s := range sans {
+			if s == san {
+				return nil
+			}
+		}
+		return validationErrorf("tls.peer.san", "TLSPeerHasSAN", CodeMissing, san, sans,
+			"expected peer certificate to have SAN %q, found %q", san, sans)
+	}
+}
+
+// TLSPeerValidFor creates a TLSValidator that checks that the leaf peer
+// certificate is currently valid and won't expire for at least d.
+func TLSPeerValidFor(d time.Duration) TLSValidator {
+	return tlsPeerValidFor("TLSPeerValidFor", d, time.Now)
+}
+
+// TLSPeerValidForAt is like TLSPeerValidFor, but gets the current time
+// from now (eg a fixed clock in tests).
+func TLSPeerValidForAt(d time.Duration, now func() time.Time) TLSValidator {
+	return tlsPeerValidFor("TLSPeerValidForAt", d, now)
+}
+
+// tlsPeerValidFor creates a TLSValidator that checks that the leaf peer
+// certificate is valid at now() and won't expire for at least d.
+func tlsPeerValidFor(validator string, d time.Duration, now func() time.Time) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer(validator, cs)
+		if err != nil {
+			return err
+		}
+		t := now()
+		if t.Before(cert.NotBefore) {
+			return validationErrorf("tls.peer.not_before", validator, CodeOutOfRange, nil, cert.NotBefore,
+				"peer certificate is not valid until %s", cert.NotBefore.UTC().Format(time.RFC3339))
+		}
+		if left := cert.NotAfter.Sub(t); left < d {
+			return validationErrorf("tls.peer.not_after", validator, CodeOutOfRange, d.String(), left.String(),
+				"peer certificate expires at %s, less than %s from now", cert.NotAfter.UTC().Format(time.RFC3339), d)
+		}
+		return nil
+	}
+}
+
+// TLSPeerKeyIs creates a TLSValidator that checks that the leaf peer
+// certificate's public key uses the algorithm alg with a size of at
+// least bits (eg the RSA modulus or ECDSA curve size, where Ed25519
+// keys are 256 bits).
+func TLSPeerKeyIs(alg x509.PublicKeyAlgorithm, bits int) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer("TLSPeerKeyIs", cs)
+		if err != nil {
+			return err
+		}
+		if cert.PublicKeyAlgorithm != alg {
+			return validationErrorf("tls.peer.public_key", "TLSPeerKeyIs", CodeMismatch, alg.String(), cert.PublicKeyAlgorithm.String(),
+				"expected peer certificate key algorithm %s, found %s", alg, cert.PublicKeyAlgorithm)
+		}
+		var size int
+		switch k := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			size = k.N.BitLen()
+		case *ecdsa.PublicKey:
+			size = k.Curve.Params().BitSize
+		case ed25519.PublicKey:
+			size = 256
+		}
+		if size < bits {
+			return validationErrorf("tls.peer.public_key", "TLSPeerKeyIs", CodeOutOfRange, bits, size,
+				"expected peer certificate key size of at least %d bits, found %d", bits, size)
+		}
+		return nil
+	}
+}
+
+// TLSPeerVerifies creates a TLSValidator that checks that the peer
+// certificate chain verifies against the root certificates in roots,
+// using any intermediates presented by the peer.
+func TLSPeerVerifies(roots *x509.CertPool) TLSValidator {
+	return func(cs *tls.ConnectionState) error {
+		cert, err := tlsPeer("TLSPeerVerifies", cs)
+		if err != nil {
+			return err
+		}
+		inters := x509.NewCertPool()
+		for _, c := range cs.PeerCertificates[1:] {
+			inters.AddCert(c)
+		}
+		_, err = cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: inters,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return &ValidationError{
+				Target:    "tls.peer.chain",
+				Validator: "TLSPeerVerifies",
+				Code:      CodeInvalid,
+				Actual:    cert.Subject.String(),
+				Message:   fmt.Sprintf("peer certificate %q failed verification: %s", cert.Subject, err),
+				Err:       err,
+			}
+		}
 		return nil
 	}
 }
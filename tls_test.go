@@ -1,15 +1,177 @@
 package vhttp_test
 
-import "testing"
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/a-poor/vhttp"
+)
+
+// newTestCert creates a certificate from tmpl, signed by parent (or
+// self-signed if parent is nil).
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.SerialNumber == nil {
+		tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(90 * 24 * time.Hour)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// newTestCA creates a self-signed CA certificate.
+func newTestCA(t *testing.T, cn string) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	return newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+}
 
 func TestTLSIsNil(t *testing.T) {
-	t.Errorf("not implemented")
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	checkErrCode(t, vhttp.ValidateRequest(req, vhttp.TLSIsNil()), "")
+	req.TLS = &tls.ConnectionState{}
+	checkErrCode(t, vhttp.ValidateRequest(req, vhttp.TLSIsNil()), vhttp.CodeUnexpected)
 }
 
 func TestTLSIsNotNil(t *testing.T) {
-	t.Errorf("not implemented")
+	res := &http.Response{}
+	checkErrCode(t, vhttp.ValidateResponse(res, vhttp.TLSIsNotNil()), vhttp.CodeMissing)
+	res.TLS = &tls.ConnectionState{}
+	checkErrCode(t, vhttp.ValidateResponse(res, vhttp.TLSIsNotNil()), "")
 }
 
 func TestTLSVersionIs(t *testing.T) {
-	t.Errorf("not implemented")
+	v := vhttp.TLSVersionIs(tls.VersionTLS13)
+	checkErrCode(t, v(nil), vhttp.CodeMissing)
+	checkErrCode(t, v(&tls.ConnectionState{Version: tls.VersionTLS13}), "")
+	checkErrCode(t, v(&tls.ConnectionState{Version: tls.VersionTLS12}), vhttp.CodeMismatch)
+}
+
+func TestTLSConnectionValidators(t *testing.T) {
+	cs := &tls.ConnectionState{
+		Version:            tls.VersionTLS12,
+		CipherSuite:        tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "h2",
+		ServerName:         "api.example.com",
+		DidResume:          true,
+	}
+	cases := []struct {
+		name string             // Case name
+		v    vhttp.TLSValidator // Validator to run
+		code vhttp.ErrorCode    // Expected error code (empty for success)
+	}{
+		{"min-version", vhttp.TLSMinVersion(tls.VersionTLS12), ""},
+		{"min-version-fail", vhttp.TLSMinVersion(tls.VersionTLS13), vhttp.CodeOutOfRange},
+		{"cipher-in", vhttp.TLSCipherSuiteIn(tls.TLS_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256), ""},
+		{"cipher-in-fail", vhttp.TLSCipherSuiteIn(tls.TLS_AES_128_GCM_SHA256), vhttp.CodeNoMatch},
+		{"cipher-not-in", vhttp.TLSCipherSuiteNotIn(tls.TLS_RSA_WITH_RC4_128_SHA), ""},
+		{"cipher-not-in-fail", vhttp.TLSCipherSuiteNotIn(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256), vhttp.CodeUnexpected},
+		{"cipher-secure", vhttp.TLSCipherSuiteIsSecure(), ""},
+		{"alpn", vhttp.TLSNegotiatedProtocolIs("h2"), ""},
+		{"alpn-fail", vhttp.TLSNegotiatedProtocolIs("http/1.1"), vhttp.CodeMismatch},
+		{"sni", vhttp.TLSServerNameIs("api.example.com"), ""},
+		{"sni-fail", vhttp.TLSServerNameIs("example.com"), vhttp.CodeMismatch},
+		{"did-resume", vhttp.TLSDidResume(true), ""},
+		{"did-resume-fail", vhttp.TLSDidResume(false), vhttp.CodeMismatch},
+		{"ocsp-fail", vhttp.TLSHasOCSPStaple(), vhttp.CodeMissing},
+		{"no-peer", vhttp.TLSPeerSubjectCNIs("api"), vhttp.CodeMissing},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkErrCode(t, c.v(cs), c.code)
+			checkErrCode(t, c.v(nil), vhttp.CodeMissing)
+		})
+	}
+}
+
+func TestTLSPeerValidators(t *testing.T) {
+	ca, caKey := newTestCA(t, "Test Root CA")
+	inter, interKey := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, ca, caKey)
+	leaf, _ := newTestCert(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "api", Organization: []string{"Example"}},
+		DNSNames:       []string{"api.example.com"},
+		EmailAddresses: []string{"ops@example.com"},
+		NotAfter:       time.Now().Add(10 * 24 * time.Hour),
+	}, inter, interKey)
+	otherCA, _ := newTestCA(t, "Other Root CA")
+
+	roots, otherRoots := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(ca)
+	otherRoots.AddCert(otherCA)
+
+	cs := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, inter}}
+	cases := []struct {
+		name string             // Case name
+		v    vhttp.TLSValidator // Validator to run
+		code vhttp.ErrorCode    // Expected error code (empty for success)
+	}{
+		{"subject-cn", vhttp.TLSPeerSubjectCNIs("api"), ""},
+		{"subject-cn-fail", vhttp.TLSPeerSubjectCNIs("web"), vhttp.CodeMismatch},
+		{"subject-matches", vhttp.TLSPeerSubjectMatches(regexp.MustCompile(`^CN=api,O=Example$`)), ""},
+		{"subject-matches-fail", vhttp.TLSPeerSubjectMatches(regexp.MustCompile(`O=Other`)), vhttp.CodeNoMatch},
+		{"issuer", vhttp.TLSPeerIssuerCNIs("Test Intermediate CA"), ""},
+		{"issuer-fail", vhttp.TLSPeerIssuerCNIs("Test Root CA"), vhttp.CodeMismatch},
+		{"san-dns", vhttp.TLSPeerHasSAN("api.example.com"), ""},
+		{"san-email", vhttp.TLSPeerHasSAN("ops@example.com"), ""},
+		{"san-fail", vhttp.TLSPeerHasSAN("web.example.com"), vhttp.CodeMissing},
+		{"valid-for", vhttp.TLSPeerValidFor(7 * 24 * time.Hour), ""},
+		{"valid-for-fail", vhttp.TLSPeerValidFor(30 * 24 * time.Hour), vhttp.CodeOutOfRange},
+		{"valid-for-at", vhttp.TLSPeerValidForAt(9*24*time.Hour, func() time.Time { return leaf.NotBefore }), ""},
+		{"valid-for-at-not-yet", vhttp.TLSPeerValidForAt(0, func() time.Time { return leaf.NotBefore.Add(-time.Minute) }), vhttp.CodeOutOfRange},
+		{"valid-for-at-expired", vhttp.TLSPeerValidForAt(0, func() time.Time { return leaf.NotAfter.Add(time.Minute) }), vhttp.CodeOutOfRange},
+		{"key", vhttp.TLSPeerKeyIs(x509.ECDSA, 256), ""},
+		{"key-size-fail", vhttp.TLSPeerKeyIs(x509.ECDSA, 384), vhttp.CodeOutOfRange},
+		{"key-alg-fail", vhttp.TLSPeerKeyIs(x509.RSA, 2048), vhttp.CodeMismatch},
+		{"verifies", vhttp.TLSPeerVerifies(roots), ""},
+		{"verifies-fail", vhttp.TLSPeerVerifies(otherRoots), vhttp.CodeInvalid},
+		{"custom", vhttp.TLSPeerCertificate(func(c *x509.Certificate) error { return nil }), ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkErrCode(t, c.v(cs), c.code)
+			checkErrCode(t, c.v(nil), vhttp.CodeMissing)
+			checkErrCode(t, c.v(&tls.ConnectionState{}), vhttp.CodeMissing)
+		})
+	}
+
+	// The chain doesn't verify without the intermediate
+	checkErrCode(t, vhttp.TLSPeerVerifies(roots)(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}), vhttp.CodeInvalid)
 }
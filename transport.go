@@ -0,0 +1,111 @@
+package vhttp
+
+import (
+	"net/http"
+)
+
+// Transport is an http.RoundTripper that validates outgoing requests and
+// their responses. It can be used as an http.Client's Transport to check
+// the traffic sent by code that can't otherwise be instrumented (eg a
+// third-party SDK) in integration tests.
+//
+//	client := &http.Client{
+//		Transport: &vhttp.Transport{
+//			Request:  []vhttp.RequestValidator{vhttp.HeaderAuthorizationMatchesBearer()},
+//			Response: []vhttp.ResponseValidator{vhttp.StatusIsOK()},
+//		},
+//	}
+//
+// If a request fails validation it isn't sent. If a response fails
+// validation, its body is closed. In both cases, a *TransportError is
+// returned (wrapped in a *url.Error by the http.Client). If ObserveOnly is
+// set, failures are only reported to OnError and the traffic is left
+// untouched.
+type Transport struct {
+	// Base is the underlying RoundTripper used to send requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// Request are the validators run on each request before it's sent.
+	Request []RequestValidator
+
+	// Response are the validators run on each response returned
+	// by Base.
+	Response []ResponseValidator
+
+	// ObserveOnly, if set, reports validation failures to OnError
+	// without failing the request.
+	ObserveOnly bool
+
+	// OnError, if set, is called with each *TransportError.
+	OnError func(err *TransportError)
+}
+
+// TransportError is the error returned by a Transport when a request or
+// its response fails validation.
+type TransportError struct {
+	// Request is the request that was (or would have been) sent.
+	Request *http.Request
+
+	// Response is the response that failed validation. It's nil if the
+	// request failed validation.
+	Response *http.Response
+
+	// Err is the validation error.
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	if e.Response != nil {
+		return "response failed validation: " + e.Err.Error()
+	}
+	return "request failed validation: " + e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// RoundTrip validates and sends the request, then validates the
+// response returned by the underlying RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Validate a copy of the request, since a RoundTripper
+	// shouldn't modify the request it's given
+	r := req.Clone(req.Context())
+	if err := ValidateRequest(r, t.Request...); err != nil {
+		terr := &TransportError{Request: req, Err: err}
+		if t.OnError != nil {
+			t.OnError(terr)
+		}
+		if !t.ObserveOnly {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, terr
+		}
+	}
+
+	// Send the request
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	res, err := base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	res.Request = req
+
+	// Validate the response
+	if err := ValidateResponse(res, t.Response...); err != nil {
+		terr := &TransportError{Request: req, Response: res, Err: err}
+		if t.OnError != nil {
+			t.OnError(terr)
+		}
+		if !t.ObserveOnly {
+			res.Body.Close()
+			return nil, terr
+		}
+	}
+	return res, nil
+}
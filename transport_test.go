@@ -0,0 +1,113 @@
+package vhttp_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing" {
+			http.NotFound(w, req)
+			return
+		}
+		io.Copy(w, req.Body)
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name        string // Case name
+		path        string // Request path
+		auth        string // Authorization header
+		observeOnly bool   // Run the transport in observe-only mode
+		isErr       bool   // Should the client return an error
+		isResErr    bool   // Should the failure be for the response
+		observed    bool   // Should OnError be called
+	}{
+		{
+			name: "success",
+			path: "/echo",
+			auth: "Bearer abc123",
+		},
+		{
+			name:  "request-error",
+			path:  "/echo",
+			isErr: true,
+		},
+		{
+			name:     "response-error",
+			path:     "/missing",
+			auth:     "Bearer abc123",
+			isErr:    true,
+			isResErr: true,
+		},
+		{
+			name:        "observe-only",
+			path:        "/missing",
+			observeOnly: true,
+			observed:    true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var observed []*vhttp.TransportError
+			client := &http.Client{
+				Transport: &vhttp.Transport{
+					Request:     []vhttp.RequestValidator{vhttp.HeaderAuthorizationMatchesBearer(), vhttp.BodyIsValidJSON()},
+					Response:    []vhttp.ResponseValidator{vhttp.StatusIsOK(), vhttp.BodyIsValidJSON()},
+					ObserveOnly: c.observeOnly,
+					OnError: func(err *vhttp.TransportError) {
+						observed = append(observed, err)
+					},
+				},
+			}
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL+c.path, strings.NewReader(`{"id":1}`))
+			if err != nil {
+				t.Fatalf("failed to create request: %s", err)
+			}
+			if c.auth != "" {
+				req.Header.Set(vhttp.HeaderAuthorization, c.auth)
+			}
+			res, err := client.Do(req)
+
+			// Check the error
+			if err == nil && c.isErr {
+				t.Fatal("expected an error to be returned")
+			}
+			if err != nil && !c.isErr {
+				t.Fatalf("unexpected error returned: %s", err)
+			}
+			if err != nil {
+				var terr *vhttp.TransportError
+				if !errors.As(err, &terr) {
+					t.Fatalf("expected a *TransportError, found %T", err)
+				}
+				if (terr.Response != nil) != c.isResErr {
+					t.Errorf("expected response error to be %t, found %t", c.isResErr, terr.Response != nil)
+				}
+				return
+			}
+			defer res.Body.Close()
+
+			// Check the observed errors
+			if (len(observed) > 0) != c.observed {
+				t.Errorf("expected observed errors to be %t, found %v", c.observed, observed)
+			}
+
+			// Was the request body sent intact?
+			if c.path == "/echo" {
+				b, _ := io.ReadAll(res.Body)
+				if string(b) != `{"id":1}` {
+					t.Errorf("expected echoed body %q, found %q", `{"id":1}`, b)
+				}
+			}
+		})
+	}
+}
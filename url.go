@@ -15,12 +15,18 @@ func (v URLValidator) ValidateRequest(req *http.Request) error {
 	return v(req.URL)
 }
 
+// queryTarget returns the ValidationError target for the URL query key k.
+func queryTarget(k string) string {
+	return fmt.Sprintf("url.query[%q]", k)
+}
+
 // URLIs creates a url validator that checks that the
 // URL exactly matches the given string s.
 func URLIs(s string) URLValidator {
 	return func(u *url.URL) error {
 		if u.String() != s {
-			return fmt.Errorf("expected URL %q, found %q", s, u.String())
+			return validationErrorf("url", "URLIs", CodeMismatch, s, u.String(),
+				"expected URL %q, found %q", s, u.String())
 		}
 		return nil
 	}
@@ -31,7 +37,8 @@ func URLIs(s string) URLValidator {
 func URLSchemeIs(s string) URLValidator {
 	return func(u *url.URL) error {
 		if u.Scheme != s {
-			return fmt.Errorf("expected URL scheme %q, found %q", s, u.Scheme)
+			return validationErrorf("url.scheme", "URLSchemeIs", CodeMismatch, s, u.Scheme,
+				"expected URL scheme %q, found %q", s, u.Scheme)
 		}
 		return nil
 	}
@@ -54,7 +61,8 @@ func URLSchemeIsHTTPS() URLValidator {
 func URLPathIs(p string) URLValidator {
 	return func(u *url.URL) error {
 		if u.Path != p {
-			return fmt.Errorf("expected URL path %q, found %q", p, u.Path)
+			return validationErrorf("url.path", "URLPathIs", CodeMismatch, p, u.Path,
+				"expected URL path %q, found %q", p, u.Path)
 		}
 		return nil
 	}
@@ -67,7 +75,8 @@ func URLPathIs(p string) URLValidator {
 func URLUserinfoIs(ui string) URLValidator {
 	return func(u *url.URL) error {
 		if u.User.String() != ui {
-			return fmt.Errorf("expected URL userinfo %q, found %q", ui, u.User.String())
+			return validationErrorf("url.userinfo", "URLUserinfoIs", CodeMismatch, ui, u.User.String(),
+				"expected URL userinfo %q, found %q", ui, u.User.String())
 		}
 		return nil
 	}
@@ -78,7 +87,8 @@ func URLUserinfoIs(ui string) URLValidator {
 func URLHostIs(h string) URLValidator {
 	return func(u *url.URL) error {
 		if u.Host != h {
-			return fmt.Errorf("expected URL host %q, found %q", h, u.Host)
+			return validationErrorf("url.host", "URLHostIs", CodeMismatch, h, u.Host,
+				"expected URL host %q, found %q", h, u.Host)
 		}
 		return nil
 	}
@@ -98,7 +108,8 @@ func URLPathGlob(p string) URLValidator {
 
 		// If the path does not match, return an error
 		if !m {
-			return fmt.Errorf("path %q does not match pattern %q", u.Path, p)
+			return validationErrorf("url.path", "URLPathGlob", CodeNoMatch, p, u.Path,
+				"path %q does not match pattern %q", u.Path, p)
 		}
 		return nil
 	}
@@ -109,7 +120,8 @@ func URLPathGlob(p string) URLValidator {
 func URLQueryHas(k string) URLValidator {
 	return func(u *url.URL) error {
 		if !u.Query().Has(k) {
-			return fmt.Errorf("expected value for URL query key %q to be present", k)
+			return validationErrorf(queryTarget(k), "URLQueryHas", CodeMissing, nil, nil,
+				"expected value for URL query key %q to be present", k)
 		}
 		return nil
 	}
@@ -131,7 +143,8 @@ func URLQueryIs(k, v string) URLValidator {
 		}
 
 		// Not found...
-		return fmt.Errorf("expected at least one value for URL query %q to be %q", k, v)
+		return validationErrorf(queryTarget(k), "URLQueryIs", CodeMismatch, v, vs,
+			"expected at least one value for URL query %q to be %q", k, v)
 	}
 }
 
@@ -145,7 +158,14 @@ func URLQueryValueValidator(k string, vfn func(string) error) URLValidator {
 		// Run the validator function
 		err := vfn(v)
 		if err != nil {
-			return fmt.Errorf("error validating URL query %q=%q: %v", k, v, err)
+			return &ValidationError{
+				Target:    queryTarget(k),
+				Validator: "URLQueryValueValidator",
+				Code:      CodeInvalid,
+				Actual:    v,
+				Message:   fmt.Sprintf("error validating URL query %q=%q: %v", k, v, err),
+				Err:       err,
+			}
 		}
 		return nil
 	}
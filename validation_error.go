@@ -0,0 +1,127 @@
+package vhttp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// ErrorCode is a stable, machine-readable code describing why a
+// validation failed.
+type ErrorCode string
+
+// Error codes used by the built-in validators.
+const (
+	// CodeMismatch means the value wasn't equal to the expected value.
+	CodeMismatch ErrorCode = "mismatch"
+
+	// CodeMissing means the value wasn't present.
+	CodeMissing ErrorCode = "missing"
+
+	// CodeUnexpected means the value was present (or equal to a value)
+	// when it shouldn't have been.
+	CodeUnexpected ErrorCode = "unexpected"
+
+	// CodeNoMatch means the value didn't match a pattern.
+	CodeNoMatch ErrorCode = "no_match"
+
+	// CodeOutOfRange means the value was outside of the expected range.
+	CodeOutOfRange ErrorCode = "out_of_range"
+
+	// CodeInvalid means the value couldn't be parsed or was malformed.
+	CodeInvalid ErrorCode = "invalid"
+
+	// CodeSchema means the value didn't match a schema.
+	CodeSchema ErrorCode = "schema"
+
+	// CodeUndeclared means the value (eg an operation, status code or
+	// content type) isn't declared by a specification.
+	CodeUndeclared ErrorCode = "undeclared"
+
+	// CodeNonePassed means none of a group of alternative
+	// validators passed.
+	CodeNonePassed ErrorCode = "none_passed"
+
+	// CodeTooLarge means the body was larger than the maximum size
+	// allowed (eg MaxBodyBytes).
+	CodeTooLarge ErrorCode = "too_large"
+)
+
+// ValidationError is the error returned by the built-in validators when
+// a request or response fails validation. It describes which part of the
+// request or response failed, why, and how.
+//
+// Validation errors can be found using errors.As, even after they've been
+// combined with multierror (as ValidateRequest and ValidateResponse do),
+// or all of them can be listed using ValidationErrors.
+//
+//	var verr *vhttp.ValidationError
+//	if errors.As(err, &verr) {
+//		fmt.Println(verr.Target, verr.Code)
+//	}
+type ValidationError struct {
+	// Target is the part of the request or response that failed validation
+	// (eg "method", "url.path", `header["Content-Type"]`, "body" or "status").
+	Target string
+
+	// Validator is the name of the validator that failed (eg "MethodIs").
+	Validator string
+
+	// Code is a stable code describing the failure.
+	Code ErrorCode
+
+	// Expected is the expected value, if any.
+	Expected any
+
+	// Actual is the value that was found, if any.
+	Actual any
+
+	// Message is the human-readable error message.
+	Message string
+
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// validationErrorf creates a new ValidationError with a message
+// formatted using fmt.Sprintf.
+func validationErrorf(target, validator string, code ErrorCode, expected, actual any, format string, args ...any) error {
+	return &ValidationError{
+		Target:    target,
+		Validator: validator,
+		Code:      code,
+		Expected:  expected,
+		Actual:    actual,
+		Message:   fmt.Sprintf(format, args...),
+	}
+}
+
+// ValidationErrors returns all of the ValidationErrors contained in err,
+// including those combined with multierror.
+func ValidationErrors(err error) []*ValidationError {
+	var out []*ValidationError
+	var walk func(error)
+	walk = func(err error) {
+		if merr, ok := err.(*multierror.Error); ok {
+			for _, e := range merr.Errors {
+				walk(e)
+			}
+			return
+		}
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			out = append(out, verr)
+		}
+	}
+	walk(err)
+	return out
+}
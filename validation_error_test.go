@@ -0,0 +1,119 @@
+package vhttp_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+)
+
+func TestValidationErrorAs(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/api", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err)
+	}
+
+	err = vhttp.ValidateRequest(req,
+		vhttp.MethodIs(http.MethodGet),
+		vhttp.HeaderMatches(vhttp.HeaderAuthorization, regexp.MustCompile(`^Bearer .+$`)),
+	)
+	if err == nil {
+		t.Fatal("expected an error to be returned")
+	}
+
+	var verr *vhttp.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *ValidationError, found %T", err)
+	}
+	if verr.Target != "method" || verr.Validator != "MethodIs" || verr.Code != vhttp.CodeMismatch {
+		t.Errorf("unexpected first validation error: %+v", verr)
+	}
+	if verr.Expected != http.MethodGet || verr.Actual != http.MethodPost {
+		t.Errorf("expected %q and actual %q, found %v and %v", http.MethodGet, http.MethodPost, verr.Expected, verr.Actual)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	cases := []struct {
+		name    string                   // Case name
+		vs      []vhttp.RequestValidator // Validators to run
+		targets []string                 // Expected error targets
+		codes   []vhttp.ErrorCode        // Expected error codes
+	}{
+		{
+			name:    "no-errors",
+			vs:      []vhttp.RequestValidator{vhttp.MethodIs(http.MethodPost)},
+			targets: nil,
+			codes:   nil,
+		},
+		{
+			name: "flattened",
+			vs: []vhttp.RequestValidator{
+				vhttp.MethodIs(http.MethodGet),
+				vhttp.HasHeaderAuthorization(),
+				vhttp.URLQueryHas("page"),
+				vhttp.BodyIsValidJSON(),
+			},
+			targets: []string{"method", `header["Authorization"]`, `url.query["page"]`, "body"},
+			codes:   []vhttp.ErrorCode{vhttp.CodeMismatch, vhttp.CodeMissing, vhttp.CodeMissing, vhttp.CodeInvalid},
+		},
+		{
+			name: "nested-all",
+			vs: []vhttp.RequestValidator{
+				vhttp.All(vhttp.URLPathIs("/api/v2"), vhttp.URLSchemeIs("http")),
+			},
+			targets: []string{"url.path", "url.scheme"},
+			codes:   []vhttp.ErrorCode{vhttp.CodeMismatch, vhttp.CodeMismatch},
+		},
+		{
+			name: "any",
+			vs: []vhttp.RequestValidator{
+				vhttp.Any(vhttp.MethodIs(http.MethodGet), vhttp.MethodIs(http.MethodPut)),
+			},
+			targets: []string{"method"},
+			codes:   []vhttp.ErrorCode{vhttp.CodeNonePassed},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := newBodyRequest("not json")
+			req.Method = http.MethodPost
+			req.URL = &url.URL{Scheme: "https", Host: "example.com", Path: "/api"}
+
+			errs := vhttp.ValidationErrors(vhttp.ValidateRequest(req, c.vs...))
+			if len(errs) != len(c.targets) {
+				t.Fatalf("expected %d validation errors, found %d: %v", len(c.targets), len(errs), errs)
+			}
+			for i, e := range errs {
+				if e.Target != c.targets[i] {
+					t.Errorf("error %d: expected target %q, found %q", i, c.targets[i], e.Target)
+				}
+				if e.Code != c.codes[i] {
+					t.Errorf("error %d: expected code %q, found %q", i, c.codes[i], e.Code)
+				}
+			}
+		})
+	}
+}
+
+// checkErrCode checks that err is a single validation error with the code
+// (or is nil if code is empty), reporting whether it is.
+func checkErrCode(t *testing.T, err error, code vhttp.ErrorCode) bool {
+	t.Helper()
+	if code == "" {
+		if err != nil {
+			t.Errorf("expected no error, found %v", err)
+			return false
+		}
+		return true
+	}
+	errs := vhttp.ValidationErrors(err)
+	if len(errs) != 1 || errs[0].Code != code {
+		t.Errorf("expected a single %q error, found %v", code, err)
+		return false
+	}
+	return true
+}
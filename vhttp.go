@@ -92,6 +92,12 @@ func ValidateRequest(req *http.Request, vs ...RequestValidator) error {
 		return fmt.Errorf("request is nil")
 	}
 
+	// Share a single read of the body, if enabled.
+	defer shareRequestBody(req)()
+
+	// Let later validators see the claims verified by BearerJWT.
+	defer holdJWTClaims(req)()
+
 	// Iterate through the request validators.
 	var merr *multierror.Error
 	for _, v := range vs {
@@ -119,6 +125,12 @@ func ValidateRequestFF(req *http.Request, vs ...RequestValidator) error {
 		return fmt.Errorf("request is nil")
 	}
 
+	// Share a single read of the body, if enabled.
+	defer shareRequestBody(req)()
+
+	// Let later validators see the claims verified by BearerJWT.
+	defer holdJWTClaims(req)()
+
 	// Iterate through the request validators.
 	for _, v := range vs {
 		if err := v.ValidateRequest(req); err != nil {
@@ -137,6 +149,9 @@ func ValidateResponse(res *http.Response, vs ...ResponseValidator) error {
 		return fmt.Errorf("response is nil")
 	}
 
+	// Share a single read of the body, if enabled.
+	defer shareResponseBody(res)()
+
 	// Iterate through the response validators.
 	var merr *multierror.Error
 	for _, v := range vs {
@@ -164,6 +179,9 @@ func ValidateResponseFF(res *http.Response, vs ...ResponseValidator) error {
 		return fmt.Errorf("response is nil")
 	}
 
+	// Share a single read of the body, if enabled.
+	defer shareResponseBody(res)()
+
 	// Iterate through the response validators.
 	for _, v := range vs {
 		if err := v.ValidateResponse(res); err != nil {
@@ -0,0 +1,234 @@
+// Package vhttptest integrates vhttp validators with the testing package.
+//
+// The Assert functions report each validation failure (along with a dump
+// of the offending request or response, with secrets redacted) using
+// t.Errorf, while the Require functions also stop the test with
+// t.FailNow.
+//
+//	func TestGetUser(t *testing.T) {
+//		rec := httptest.NewRecorder()
+//		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+//
+//		vhttptest.RequireRecorder(t, rec,
+//			vhttp.StatusIsOK(),
+//			vhttp.HeaderContentTypeJSON(),
+//			vhttp.BodyIsValidJSON(),
+//		)
+//	}
+package vhttptest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/a-poor/vhttp"
+	"github.com/hashicorp/go-multierror"
+)
+
+// RedactedHeaders are the headers whose values are replaced with
+// Redacted when a request or response is dumped.
+var RedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+}
+
+// RedactedQueryParams are the URL query parameters whose values are
+// replaced with Redacted when a request is dumped. They're compared
+// case-insensitively.
+//
+// Only the request's URL (and request URI) are redacted: secrets in other
+// places, such as the body or a "Referer" header, are dumped as-is.
+var RedactedQueryParams = []string{
+	"access_token",
+	"id_token",
+	"refresh_token",
+	"token",
+	"api_key",
+	"apikey",
+	"key",
+	"client_secret",
+	"password",
+	"sig",
+	"signature",
+	"X-Amz-Signature",
+	"X-Amz-Credential",
+	"X-Amz-Security-Token",
+}
+
+// Redacted is the value that secrets are replaced with when a request
+// or response is dumped.
+const Redacted = "[REDACTED]"
+
+// AssertRequest validates the request req against the validators vs and
+// reports each failure with t.Errorf. It returns true if the request
+// is valid.
+func AssertRequest(t testing.TB, req *http.Request, vs ...vhttp.RequestValidator) bool {
+	t.Helper()
+	err := vhttp.ValidateRequest(req, vs...)
+	if err == nil {
+		return true
+	}
+	t.Errorf("%s", failureMessage("request", err, dumpRequest(req)))
+	return false
+}
+
+// RequireRequest is like AssertRequest but stops the test with t.FailNow
+// if the request is invalid.
+func RequireRequest(t testing.TB, req *http.Request, vs ...vhttp.RequestValidator) {
+	t.Helper()
+	if !AssertRequest(t, req, vs...) {
+		t.FailNow()
+	}
+}
+
+// AssertResponse validates the response res against the validators vs and
+// reports each failure with t.Errorf. It returns true if the response
+// is valid.
+func AssertResponse(t testing.TB, res *http.Response, vs ...vhttp.ResponseValidator) bool {
+	t.Helper()
+	err := vhttp.ValidateResponse(res, vs...)
+	if err == nil {
+		return true
+	}
+	t.Errorf("%s", failureMessage("response", err, dumpResponse(res)))
+	return false
+}
+
+// RequireResponse is like AssertResponse but stops the test with
+// t.FailNow if the response is invalid.
+func RequireResponse(t testing.TB, res *http.Response, vs ...vhttp.ResponseValidator) {
+	t.Helper()
+	if !AssertResponse(t, res, vs...) {
+		t.FailNow()
+	}
+}
+
+// AssertRecorder validates the response recorded by rec (as returned by
+// rec.Result) against the validators vs and reports each failure with
+// t.Errorf. It returns true if the response is valid.
+func AssertRecorder(t testing.TB, rec *httptest.ResponseRecorder, vs ...vhttp.ResponseValidator) bool {
+	t.Helper()
+	return AssertResponse(t, rec.Result(), vs...)
+}
+
+// RequireRecorder is like AssertRecorder but stops the test with
+// t.FailNow if the response is invalid.
+func RequireRecorder(t testing.TB, rec *httptest.ResponseRecorder, vs ...vhttp.ResponseValidator) {
+	t.Helper()
+	if !AssertRecorder(t, rec, vs...) {
+		t.FailNow()
+	}
+}
+
+// failureMessage formats the validation error err, with each failure on
+// its own line, followed by the dump of the request or response.
+func failureMessage(kind string, err error, dump string) string {
+	var sb strings.Builder
+	sb.WriteString(kind + " failed validation:\n")
+	errs := []error{err}
+	if merr, ok := err.(*multierror.Error); ok {
+		errs = merr.Errors
+	}
+	for _, err := range errs {
+		sb.WriteString("\t- " + err.Error() + "\n")
+	}
+	if dump != "" {
+		sb.WriteString(kind + ":\n")
+		for _, line := range strings.Split(strings.TrimRight(dump, "\r\n"), "\n") {
+			sb.WriteString("\t" + strings.TrimSuffix(line, "\r") + "\n")
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// redactHeader returns a copy of the header h with the values of the
+// RedactedHeaders replaced.
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range RedactedHeaders {
+		k = vhttp.CanonicalHeaderKey(k)
+		if vs, ok := h[k]; ok {
+			for i := range vs {
+				vs[i] = Redacted
+			}
+		}
+	}
+	return h
+}
+
+// redactQuery returns the raw query q with the values of the
+// RedactedQueryParams replaced, keeping the parameters' order.
+func redactQuery(q string) string {
+	if q == "" {
+		return q
+	}
+	ps := strings.Split(q, "&")
+	for i, p := range ps {
+		k, _, ok := strings.Cut(p, "=")
+		if !ok {
+			continue
+		}
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			name = k
+		}
+		for _, r := range RedactedQueryParams {
+			if strings.EqualFold(name, r) {
+				ps[i] = k + "=" + Redacted
+				break
+			}
+		}
+	}
+	return strings.Join(ps, "&")
+}
+
+// dumpRequest dumps the request with secrets redacted, leaving its
+// body readable.
+func dumpRequest(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	r := *req
+	r.Header = redactHeader(req.Header)
+	if req.URL != nil {
+		u := *req.URL
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), Redacted)
+		}
+		u.RawQuery = redactQuery(u.RawQuery)
+		r.URL = &u
+	}
+	if p, q, ok := strings.Cut(r.RequestURI, "?"); ok {
+		r.RequestURI = p + "?" + redactQuery(q)
+	}
+	b, err := httputil.DumpRequest(&r, true)
+	req.Body = r.Body
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// dumpResponse dumps the response with secrets redacted, leaving its
+// body readable.
+func dumpResponse(res *http.Response) string {
+	if res == nil {
+		return ""
+	}
+	r := *res
+	r.Header = redactHeader(res.Header)
+	b, err := httputil.DumpResponse(&r, true)
+	res.Body = r.Body
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,309 @@
+package vhttp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers used by common webhook signature schemes.
+const (
+	HeaderGitHubSignature256    = "X-Hub-Signature-256"
+	HeaderStripeSignature       = "Stripe-Signature"
+	HeaderSlackSignature        = "X-Slack-Signature"
+	HeaderSlackRequestTimestamp = "X-Slack-Request-Timestamp"
+)
+
+// WebhookEncoding is the encoding of a webhook's signature.
+type WebhookEncoding int
+
+const (
+	// WebhookHex is lowercase (or uppercase) hexadecimal encoding.
+	WebhookHex WebhookEncoding = iota
+
+	// WebhookBase64 is standard base64 encoding, with padding.
+	WebhookBase64
+)
+
+// decode decodes the signature s.
+func (e WebhookEncoding) decode(s string) ([]byte, error) {
+	if e == WebhookBase64 {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return hex.DecodeString(s)
+}
+
+// WebhookHMAC verifies HMAC-signed webhook requests.
+//
+// The signed payload is built from the Payload template, where "{body}"
+// is replaced with the request body, "{header:Name}" with the value of
+// the header Name and "{timestamp}" with the webhook's timestamp. For
+// example, Slack's payload template is
+// "v0:{header:X-Slack-Request-Timestamp}:{body}".
+type WebhookHMAC struct {
+	// Secret is the shared HMAC secret.
+	Secret []byte
+
+	// Header is the header containing the signature.
+	Header string
+
+	// Prefix is the required prefix of the signature header's value
+	// (eg "sha256="), which is removed before decoding.
+	Prefix string
+
+	// SignatureElement, if set, means the signature header is a list of
+	// comma-separated "key=value" elements, and is the key of the
+	// elements containing signatures (eg "v1" for Stripe's
+	// "t=1492774577,v1=5257a8..."). The webhook is valid if any of the
+	// signatures match.
+	SignatureElement string
+
+	// TimestampElement, if set, is the key of the signature header's
+	// element containing the time (in Unix seconds) the webhook was sent
+	// (eg "t" for Stripe). Only used with SignatureElement.
+	TimestampElement string
+
+	// Encoding is the signature's encoding. Defaults to WebhookHex.
+	Encoding WebhookEncoding
+
+	// Hash is the HMAC hash function. Defaults to sha256.New.
+	Hash func() hash.Hash
+
+	// Payload is the signed payload template. Defaults to "{body}".
+	Payload string
+
+	// TimestampHeader, if set, is a header containing the time (in Unix
+	// seconds) the webhook was sent.
+	TimestampHeader string
+
+	// Tolerance, if non-zero, is the maximum difference between the
+	// webhook's timestamp (from TimestampHeader or TimestampElement) and
+	// the current time, to prevent replays.
+	Tolerance time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	name string // Validator name used in errors
+}
+
+// GitHubWebhook creates a WebhookHMAC that verifies GitHub's
+// "X-Hub-Signature-256" webhook signatures.
+func GitHubWebhook(secret []byte) WebhookHMAC {
+	return WebhookHMAC{
+		Secret: secret,
+		Header: HeaderGitHubSignature256,
+		Prefix: "sha256=",
+		name:   "GitHubWebhook",
+	}
+}
+
+// SlackWebhook creates a WebhookHMAC that verifies Slack's "v0" webhook
+// signatures, rejecting requests whose "X-Slack-Request-Timestamp" is
+// more than tolerance away from the current time. A zero tolerance
+// disables the replay check (the timestamp is still required, since
+// it's signed).
+func SlackWebhook(secret []byte, tolerance time.Duration) WebhookHMAC {
+	return WebhookHMAC{
+		Secret:          secret,
+		Header:          HeaderSlackSignature,
+		Prefix:          "v0=",
+		Payload:         "v0:{header:" + HeaderSlackRequestTimestamp + "}:{body}",
+		TimestampHeader: HeaderSlackRequestTimestamp,
+		Tolerance:       tolerance,
+		name:            "SlackWebhook",
+	}
+}
+
+// RequestValidator creates a RequestFunc that verifies the request's
+// webhook signature.
+//
+// The body is read the same way as by BodyValidator, so it can still
+// be read by the webhook's handler.
+func (w WebhookHMAC) RequestValidator() RequestFunc {
+	name := w.name
+	if name == "" {
+		name = "WebhookHMAC"
+	}
+	return func(req *http.Request) error {
+		target := headerTarget(w.Header)
+
+		// Get the signatures (and timestamp)
+		v := req.Header.Get(w.Header)
+		if v == "" {
+			return validationErrorf(target, name, CodeMissing, nil, nil,
+				"expected a webhook signature in the %q header", w.Header)
+		}
+		sigs, ts, err := w.parseHeader(name, v)
+		if err != nil {
+			return err
+		}
+
+		// Check the timestamp
+		tsHeader := w.TimestampHeader
+		if w.TimestampElement != "" {
+			tsHeader = w.Header
+		} else if tsHeader != "" {
+			ts = req.Header.Get(tsHeader)
+		}
+		if tsHeader != "" {
+			if err := checkWebhookTimestamp(name, tsHeader, ts, w.Tolerance, w.Now); err != nil {
+				return err
+			}
+		}
+
+		// Build the payload and check the signatures
+		b, err := readRequestBody(req)
+		if err != nil {
+			return bodyReadErr("failed to read request body", err)
+		}
+		payload, err := expandWebhookPayload(w.Payload, req, b, ts)
+		if err != nil {
+			return validationErrorf(target, name, CodeMissing, nil, nil,
+				"failed to build the signed webhook payload: %s", err)
+		}
+		h := w.Hash
+		if h == nil {
+			h = sha256.New
+		}
+		mac := hmac.New(h, w.Secret)
+		mac.Write(payload)
+		want := mac.Sum(nil)
+		for _, sig := range sigs {
+			if hmac.Equal(want, sig) {
+				return nil
+			}
+		}
+		return validationErrorf(target, name, CodeMismatch, nil, nil,
+			"webhook signature in the %q header doesn't match the payload", w.Header)
+	}
+}
+
+// parseHeader parses the signature header's value v, returning the
+// decoded signatures and the timestamp element (if any).
+func (w WebhookHMAC) parseHeader(name, v string) ([][]byte, string, error) {
+	target := headerTarget(w.Header)
+	if w.SignatureElement == "" {
+		if !strings.HasPrefix(v, w.Prefix) {
+			return nil, "", validationErrorf(target, name, CodeInvalid, w.Prefix, v,
+				"expected the %q header to start with %q", w.Header, w.Prefix)
+		}
+		sig, err := w.Encoding.decode(strings.TrimPrefix(v, w.Prefix))
+		if err != nil {
+			return nil, "", validationErrorf(target, name, CodeInvalid, nil, v,
+				"invalid signature encoding in the %q header: %s", w.Header, err)
+		}
+		return [][]byte{sig}, "", nil
+	}
+
+	// Parse the "key=value" elements, ignoring signatures
+	// that can't be decoded (eg from other schemes)
+	var sigs [][]byte
+	var ts string
+	for _, el := range strings.Split(v, ",") {
+		k, val, _ := strings.Cut(strings.TrimSpace(el), "=")
+		switch {
+		case k == w.SignatureElement:
+			if sig, err := w.Encoding.decode(strings.TrimPrefix(val, w.Prefix)); err == nil {
+				sigs = append(sigs, sig)
+			}
+		case k == w.TimestampElement:
+			ts = val
+		}
+	}
+	if len(sigs) == 0 {
+		return nil, "", validationErrorf(target, name, CodeInvalid, nil, v,
+			"expected a %q signature in the %q header", w.SignatureElement, w.Header)
+	}
+	if w.TimestampElement != "" && ts == "" {
+		return nil, "", validationErrorf(target, name, CodeInvalid, nil, v,
+			"expected a %q timestamp in the %q header", w.TimestampElement, w.Header)
+	}
+	return sigs, ts, nil
+}
+
+// StripeWebhook creates a WebhookHMAC that verifies Stripe's
+// "Stripe-Signature" webhook signatures, rejecting requests whose
+// timestamp is more than tolerance away from the current time. A zero
+// tolerance disables the replay check.
+func StripeWebhook(secret []byte, tolerance time.Duration) WebhookHMAC {
+	return WebhookHMAC{
+		Secret:           secret,
+		Header:           HeaderStripeSignature,
+		SignatureElement: "v1",
+		TimestampElement: "t",
+		Payload:          "{timestamp}.{body}",
+		Tolerance:        tolerance,
+		name:             "StripeWebhook",
+	}
+}
+
+// checkWebhookTimestamp checks that the Unix timestamp ts (from the
+// header h) is within tolerance of the current time.
+func checkWebhookTimestamp(validator, h, ts string, tolerance time.Duration, now func() time.Time) error {
+	target := headerTarget(h)
+	if ts == "" {
+		return validationErrorf(target, validator, CodeMissing, nil, nil,
+			"expected a webhook timestamp in the %q header", h)
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return validationErrorf(target, validator, CodeInvalid, nil, ts,
+			"invalid webhook timestamp %q in the %q header", ts, h)
+	}
+	if tolerance <= 0 {
+		return nil
+	}
+	if now == nil {
+		now = time.Now
+	}
+	t := time.Unix(sec, 0)
+	if d := now().Sub(t); math.Abs(float64(d)) > float64(tolerance) {
+		return validationErrorf(target, validator, CodeOutOfRange, tolerance.String(), d.String(),
+			"webhook timestamp %s is more than %s from the current time", t.UTC().Format(time.RFC3339), tolerance)
+	}
+	return nil
+}
+
+// expandWebhookPayload builds a signed payload from the template tmpl.
+func expandWebhookPayload(tmpl string, req *http.Request, body []byte, ts string) ([]byte, error) {
+	if tmpl == "" {
+		return body, nil
+	}
+	var b bytes.Buffer
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		n := strings.IndexByte(tmpl[start+1:], '}')
+		if start < 0 || n < 0 {
+			b.WriteString(tmpl)
+			return b.Bytes(), nil
+		}
+		end := start + 1 + n
+		b.WriteString(tmpl[:start])
+		switch key := tmpl[start+1 : end]; {
+		case key == "body":
+			b.Write(body)
+		case key == "timestamp":
+			b.WriteString(ts)
+		case strings.HasPrefix(key, "header:"):
+			h := strings.TrimPrefix(key, "header:")
+			v := req.Header.Get(h)
+			if v == "" {
+				return nil, fmt.Errorf("header %q not found", h)
+			}
+			b.WriteString(v)
+		default:
+			b.WriteString(tmpl[start : end+1])
+		}
+		tmpl = tmpl[end+1:]
+	}
+}
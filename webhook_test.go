@@ -0,0 +1,174 @@
+package vhttp_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-poor/vhttp"
+)
+
+// hmacSHA256 returns the HMAC-SHA256 of the payload parts.
+func hmacSHA256(secret string, parts ...string) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	for _, p := range parts {
+		m.Write([]byte(p))
+	}
+	return m.Sum(nil)
+}
+
+// newWebhookRequest creates a webhook request with the body and headers
+// (given as key-value pairs).
+func newWebhookRequest(body string, kvs ...string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/webhook", strings.NewReader(body))
+	for i := 0; i < len(kvs); i += 2 {
+		req.Header.Set(kvs[i], kvs[i+1])
+	}
+	return req
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	// Example from GitHub's webhook documentation
+	v := vhttp.GitHubWebhook([]byte("It's a Secret to Everybody")).RequestValidator()
+	cases := []struct {
+		name string          // Case name
+		body string          // Request body
+		sig  string          // X-Hub-Signature-256 header
+		code vhttp.ErrorCode // Expected error code (empty for success)
+	}{
+		{"success", "Hello, World!", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", ""},
+		{"wrong-body", "Hello, World?", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", vhttp.CodeMismatch},
+		{"missing", "Hello, World!", "", vhttp.CodeMissing},
+		{"sha1-prefix", "Hello, World!", "sha1=01dc10d0c83e72ed246219cdd91669667fe2ca59", vhttp.CodeInvalid},
+		{"not-hex", "Hello, World!", "sha256=zz", vhttp.CodeInvalid},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := newWebhookRequest(c.body)
+			if c.sig != "" {
+				req.Header.Set(vhttp.HeaderGitHubSignature256, c.sig)
+			}
+			checkErrCode(t, vhttp.ValidateRequest(req, v), c.code)
+
+			// The handler can still read the body
+			if b, _ := io.ReadAll(req.Body); string(b) != c.body {
+				t.Errorf("expected the body to be readable after validation, found %q", b)
+			}
+		})
+	}
+}
+
+func TestStripeWebhook(t *testing.T) {
+	secret, body := "whsec_test", `{"id":"evt_1","type":"charge.succeeded"}`
+	clock := time.Unix(1492774577, 0)
+	now := strconv.FormatInt(clock.Unix(), 10)
+	old := strconv.FormatInt(clock.Add(-time.Hour).Unix(), 10)
+	sign := func(ts string) string {
+		return hex.EncodeToString(hmacSHA256(secret, ts, ".", body))
+	}
+	w := vhttp.StripeWebhook([]byte(secret), 5*time.Minute)
+	w.Now = func() time.Time { return clock }
+	v := w.RequestValidator()
+	cases := []struct {
+		name   string          // Case name
+		header string          // Stripe-Signature header
+		code   vhttp.ErrorCode // Expected error code (empty for success)
+	}{
+		{"success", fmt.Sprintf("t=%s,v1=%s", now, sign(now)), ""},
+		{"rotated-secrets", fmt.Sprintf("t=%s,v1=%s,v1=%s,v0=abc", now, strings.Repeat("00", 32), sign(now)), ""},
+		{"missing", "", vhttp.CodeMissing},
+		{"no-v1", fmt.Sprintf("t=%s,v0=%s", now, sign(now)), vhttp.CodeInvalid},
+		{"bad-timestamp", fmt.Sprintf("t=abc,v1=%s", sign(now)), vhttp.CodeInvalid},
+		{"too-old", fmt.Sprintf("t=%s,v1=%s", old, sign(old)), vhttp.CodeOutOfRange},
+		{"no-timestamp", fmt.Sprintf("v1=%s", sign(now)), vhttp.CodeInvalid},
+		{"timestamp-mismatch", fmt.Sprintf("t=%s,v1=%s", now, sign(old)), vhttp.CodeMismatch},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := newWebhookRequest(body)
+			if c.header != "" {
+				req.Header.Set(vhttp.HeaderStripeSignature, c.header)
+			}
+			checkErrCode(t, vhttp.ValidateRequest(req, v), c.code)
+		})
+	}
+
+	// A zero tolerance disables the replay check
+	w.Tolerance = 0
+	req := newWebhookRequest(body, vhttp.HeaderStripeSignature, fmt.Sprintf("t=%s,v1=%s", old, sign(old)))
+	checkErrCode(t, vhttp.ValidateRequest(req, w.RequestValidator()), "")
+}
+
+func TestSlackWebhook(t *testing.T) {
+	secret, body := "8f742231b10e8888abcd99yyyzzz85a5", "token=xyz&team_id=T1DC2JH3J&command=%2Fweather"
+	now := time.Unix(1531420618, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := "v0=" + hex.EncodeToString(hmacSHA256(secret, "v0:", ts, ":", body))
+
+	w := vhttp.SlackWebhook([]byte(secret), 5*time.Minute)
+	cases := []struct {
+		name string          // Case name
+		kvs  []string        // Request headers
+		now  time.Time       // Current time
+		code vhttp.ErrorCode // Expected error code (empty for success)
+	}{
+		{"success", []string{vhttp.HeaderSlackSignature, sig, vhttp.HeaderSlackRequestTimestamp, ts}, now, ""},
+		{"missing-timestamp", []string{vhttp.HeaderSlackSignature, sig}, now, vhttp.CodeMissing},
+		{"replayed", []string{vhttp.HeaderSlackSignature, sig, vhttp.HeaderSlackRequestTimestamp, ts}, now.Add(time.Hour), vhttp.CodeOutOfRange},
+		{"wrong-timestamp", []string{vhttp.HeaderSlackSignature, sig, vhttp.HeaderSlackRequestTimestamp, strconv.FormatInt(now.Unix()+1, 10)}, now, vhttp.CodeMismatch},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w.Now = func() time.Time { return c.now }
+			req := newWebhookRequest(body, c.kvs...)
+			checkErrCode(t, vhttp.ValidateRequest(req, w.RequestValidator()), c.code)
+		})
+	}
+
+	// A zero tolerance disables the replay check
+	w.Tolerance = 0
+	w.Now = func() time.Time { return now.Add(time.Hour) }
+	req := newWebhookRequest(body, vhttp.HeaderSlackSignature, sig, vhttp.HeaderSlackRequestTimestamp, ts)
+	checkErrCode(t, vhttp.ValidateRequest(req, w.RequestValidator()), "")
+}
+
+func TestWebhookHMAC(t *testing.T) {
+	secret, body := "s3cret", `{"event":"ping"}`
+	m := hmac.New(sha1.New, []byte(secret))
+	m.Write([]byte("POST https://example.com/webhook " + "id-1" + "\n" + body))
+	sig := base64.StdEncoding.EncodeToString(m.Sum(nil))
+
+	w := vhttp.WebhookHMAC{
+		Secret:   []byte(secret),
+		Header:   "X-Signature",
+		Encoding: vhttp.WebhookBase64,
+		Hash:     sha1.New,
+		Payload:  "POST https://example.com/webhook {header:X-Delivery-Id}\n{body}",
+	}
+	req := newWebhookRequest(body, "X-Signature", sig, "X-Delivery-Id", "id-1")
+	checkErrCode(t, vhttp.ValidateRequest(req, w.RequestValidator()), "")
+
+	req = newWebhookRequest(body, "X-Signature", sig)
+	checkErrCode(t, vhttp.ValidateRequest(req, w.RequestValidator()), vhttp.CodeMissing)
+
+	req = newWebhookRequest(body, "X-Signature", sig, "X-Delivery-Id", "id-2")
+	checkErrCode(t, vhttp.ValidateRequest(req, w.RequestValidator()), vhttp.CodeMismatch)
+
+	// Works with cached body reads, too
+	vhttp.CacheBodyReads = true
+	defer func() { vhttp.CacheBodyReads = false }()
+	req = newWebhookRequest(body, "X-Signature", sig, "X-Delivery-Id", "id-1")
+	checkErrCode(t, vhttp.ValidateRequest(req, w.RequestValidator(), vhttp.BodyIsValidJSON()), "")
+	if b, _ := io.ReadAll(req.Body); string(b) != body {
+		t.Errorf("expected the body to be readable after validation, found %q", b)
+	}
+}